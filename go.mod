@@ -5,6 +5,7 @@ go 1.12
 require (
 	github.com/davecgh/go-spew v1.1.1
 	github.com/evanphx/json-patch v4.5.0+incompatible
+	github.com/flant/libjq-go v1.6.2-0.20200616114952-907039e8a02a
 	github.com/flant/shell-operator v1.0.0-beta.12.0.20200903102652-4e8b8ad0bb3e // branch: master
 	github.com/go-chi/chi v4.0.3+incompatible
 	github.com/go-openapi/spec v0.19.3
@@ -39,6 +39,10 @@ func RegisterHookMetrics(metricStorage *metric_storage.MetricStorage) {
 	// modules
 	metricStorage.RegisterCounter("{PREFIX}modules_discover_errors_total", map[string]string{})
 	metricStorage.RegisterCounter("{PREFIX}module_delete_errors_total", map[string]string{"module": ""})
+	metricStorage.RegisterCounter("{PREFIX}module_reload_errors_total", map[string]string{"module": ""})
+	metricStorage.RegisterCounter("{PREFIX}global_hooks_reload_errors_total", map[string]string{})
+	metricStorage.RegisterCounter("{PREFIX}module_enabled_cache_hits_total", map[string]string{"module": ""})
+	metricStorage.RegisterCounter("{PREFIX}module_enabled_cache_misses_total", map[string]string{"module": ""})
 
 	// module
 	metricStorage.RegisterHistogramWithBuckets(
@@ -102,6 +106,13 @@ func RegisterHookMetrics(metricStorage *metric_storage.MetricStorage) {
 		},
 		buckets_1msTo10s)
 
+	// broken sections in the config
+	metricStorage.RegisterGauge("{PREFIX}config_section_errors", map[string]string{"section": ""})
+
+	// dynamic values patches
+	metricStorage.RegisterGauge("{PREFIX}values_patches_operations", map[string]string{"module": ""})
+	metricStorage.RegisterCounter("{PREFIX}values_patches_compactions_total", map[string]string{"module": ""})
+
 	// task age
 	// hook_run task waiting time
 	metricStorage.RegisterCounter(
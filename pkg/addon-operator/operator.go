@@ -1,6 +1,7 @@
 package addon_operator
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"path"
 	"runtime/trace"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/go-chi/chi"
@@ -30,13 +32,16 @@ import (
 	. "github.com/flant/shell-operator/pkg/utils/measure"
 
 	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/config_webhook"
 	"github.com/flant/addon-operator/pkg/helm"
 	"github.com/flant/addon-operator/pkg/helm_resources_manager"
 	. "github.com/flant/addon-operator/pkg/hook/types"
 	"github.com/flant/addon-operator/pkg/kube_config_manager"
 	"github.com/flant/addon-operator/pkg/module_manager"
+	"github.com/flant/addon-operator/pkg/module_status"
 	"github.com/flant/addon-operator/pkg/task"
 	"github.com/flant/addon-operator/pkg/utils"
+	"github.com/flant/addon-operator/pkg/values_patches_storage"
 )
 
 // AddonOperator extends ShellOperator with modules and global hooks
@@ -57,6 +62,12 @@ type AddonOperator struct {
 
 	HelmResourcesManager helm_resources_manager.HelmResourcesManager
 
+	// ConfigWebhook validates changes in values. It is nil if the webhook is disabled.
+	ConfigWebhook *config_webhook.WebhookServer
+
+	// ModuleStatusReporter writes statuses of modules into a ConfigMap. It is nil if reporting is disabled.
+	ModuleStatusReporter *module_status.StatusReporter
+
 	// converge state
 	StartupConvergeStarted bool
 	StartupConvergeDone    bool
@@ -129,6 +140,9 @@ func (op *AddonOperator) InitModuleManager() error {
 
 	var err error
 
+	// Patterns from the command line. Patterns from schemas are added by ModuleManager.
+	utils.AddSensitivePaths(strings.Split(app.SensitivePaths, ",")...)
+
 	cwd, err := os.Getwd()
 	if err != nil {
 		return fmt.Errorf("get working directory of process: %s", err)
@@ -143,8 +157,8 @@ func (op *AddonOperator) InitModuleManager() error {
 	if op.GlobalHooksDir == "" {
 		op.GlobalHooksDir = path.Join(cwd, app.GlobalHooksDir)
 	}
-	logEntry.Infof("Global hooks directory: %s", op.GlobalHooksDir)
-	logEntry.Infof("Modules directory: %s", op.ModulesDir)
+	logEntry.Infof("Global hooks directories: %s", op.GlobalHooksDir)
+	logEntry.Infof("Modules directories: %s", op.ModulesDir)
 
 	logEntry.Infof("Addon-operator namespace: %s", app.Namespace)
 
@@ -154,18 +168,26 @@ func (op *AddonOperator) InitModuleManager() error {
 		return err
 	}
 
-	// Initializing ConfigMap storage for values
-	op.KubeConfigManager = kube_config_manager.NewKubeConfigManager()
+	// Initializing ConfigMap, ModuleConfig or files storage for values
+	op.KubeConfigManager, err = kube_config_manager.NewKubeConfigManagerWithBackend(app.ConfigBackend)
+	if err != nil {
+		return err
+	}
 	op.KubeConfigManager.WithKubeClient(op.KubeClient)
 	op.KubeConfigManager.WithContext(op.ctx)
 	op.KubeConfigManager.WithNamespace(app.Namespace)
 	op.KubeConfigManager.WithConfigMapName(app.ConfigMapName)
+	op.KubeConfigManager.WithConfigMapLayers(strings.Split(app.ConfigMapLayers, ","))
 	op.KubeConfigManager.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
+	op.KubeConfigManager.WithSecretName(app.ConfigSecretName)
+	op.KubeConfigManager.WithConfigDir(app.ConfigDir)
+	op.KubeConfigManager.WithMetricStorage(op.MetricStorage)
 
 	err = op.KubeConfigManager.Init()
 	if err != nil {
 		return fmt.Errorf("init kube config manager: %s", err)
 	}
+	logEntry.Infof("Values are stored in %s objects", app.ConfigBackend)
 
 	op.ModuleManager = module_manager.NewMainModuleManager()
 	op.ModuleManager.WithContext(op.ctx)
@@ -175,11 +197,49 @@ func (op *AddonOperator) InitModuleManager() error {
 	op.ModuleManager.WithKubeEventManager(op.KubeEventsManager)
 	op.ModuleManager.WithMetricStorage(op.MetricStorage)
 	op.ModuleManager.WithHookMetricStorage(op.HookMetricStorage)
+	op.ModuleManager.WithValuesPatchesLimits(app.ValuesPatchesMaxOperations, app.ValuesPatchesMaxSize)
+	op.ModuleManager.WithDirsWatchInterval(app.WatchDirsInterval)
+	if app.ModuleStatusConfigMapName != "" {
+		op.ModuleStatusReporter = module_status.NewStatusReporter()
+		op.ModuleStatusReporter.WithKubeClient(op.KubeClient)
+		op.ModuleStatusReporter.WithNamespace(app.Namespace)
+		op.ModuleStatusReporter.WithConfigMapName(app.ModuleStatusConfigMapName)
+		op.ModuleManager.WithModuleStatusReporter(op.ModuleStatusReporter)
+		logEntry.Infof("Module statuses are reported to ConfigMap/%s", app.ModuleStatusConfigMapName)
+	}
+	if app.ValuesPatchesStorage != values_patches_storage.NoStorage {
+		valuesPatchesStorage, err := values_patches_storage.NewValuesPatchesStorage(app.ValuesPatchesStorage)
+		if err != nil {
+			return err
+		}
+		valuesPatchesStorage.WithKubeClient(op.KubeClient)
+		valuesPatchesStorage.WithNamespace(app.Namespace)
+		valuesPatchesStorage.WithNamePrefix(app.ConfigMapName)
+		op.ModuleManager.WithValuesPatchesStorage(valuesPatchesStorage)
+		logEntry.Infof("Dynamic values patches are persisted in %s objects", app.ValuesPatchesStorage)
+	}
 	err = op.ModuleManager.Init()
 	if err != nil {
 		return fmt.Errorf("init module manager: %s", err)
 	}
 
+	// Validating webhook uses schemas and modules loaded by the module manager.
+	if app.ValidatingWebhookCertFile != "" {
+		op.ConfigWebhook = config_webhook.NewWebhookServer()
+		op.ConfigWebhook.WithListenAddress(app.ValidatingWebhookListenAddress, app.ValidatingWebhookListenPort)
+		op.ConfigWebhook.WithTLSFiles(app.ValidatingWebhookCertFile, app.ValidatingWebhookKeyFile)
+		op.ConfigWebhook.WithKubeClient(op.KubeClient)
+		op.ConfigWebhook.WithNamespace(app.Namespace)
+		op.ConfigWebhook.WithConfigMapName(app.ConfigMapName)
+		op.ConfigWebhook.WithConfigMapLayers(strings.Split(app.ConfigMapLayers, ","))
+		op.ConfigWebhook.WithSecretName(app.ConfigSecretName)
+		op.ConfigWebhook.WithValidator(op.ModuleManager)
+		err = op.ConfigWebhook.Start()
+		if err != nil {
+			return fmt.Errorf("start validating webhook: %s", err)
+		}
+	}
+
 	op.DefineEventHandlers()
 
 	// Init helm resources manager
@@ -366,24 +426,46 @@ func (op *AddonOperator) PrepopulateMainQueue(tqs *queue.TaskQueueSet) {
 	onStartupLabels := map[string]string{}
 	onStartupLabels["event.type"] = "OperatorStartup"
 
-	// create onStartup for global hooks
-	logEntry := log.WithFields(utils.LabelsToLogFields(onStartupLabels))
-
 	// Prepopulate main queue with 'onStartup' and 'enable kubernetes bindings' tasks for
 	// global hooks and add a task to discover modules state.
 	tqs.WithMainName("main")
 	tqs.NewNamedQueue("main", op.TaskHandler)
 
+	for _, tsk := range op.CreateGlobalHooksStartupTasks(onStartupLabels, "PrepopulateMainQueue") {
+		op.TaskQueues.GetMain().AddLast(tsk.WithQueuedAt(time.Now()))
+	}
+
+	// Create "ReloadAllModules" task with onStartup flag turned on to discover modules state for the first time.
+	logLabels := utils.MergeLabels(onStartupLabels, map[string]string{
+		"queue":   "main",
+		"binding": string(task.ReloadAllModules),
+	})
+	reloadAllModulesTask := sh_task.NewTask(task.ReloadAllModules).
+		WithLogLabels(logLabels).
+		WithQueueName("main").
+		WithMetadata(task.HookMetadata{
+			EventDescription: "PrepopulateMainQueue",
+			OnStartupHooks:   true,
+		})
+	op.TaskQueues.GetMain().AddLast(reloadAllModulesTask.WithQueuedAt(time.Now()))
+}
+
+// CreateGlobalHooksStartupTasks returns tasks to run global hooks with OnStartup bindings,
+// tasks to enable schedule and kubernetes bindings and a task to wait for Synchronization.
+func (op *AddonOperator) CreateGlobalHooksStartupTasks(logLabels map[string]string, eventDescription string) []sh_task.Task {
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+	var tasks = make([]sh_task.Task, 0)
+
 	onStartupHooks := op.ModuleManager.GetGlobalHooksInOrder(OnStartup)
 
 	for _, hookName := range onStartupHooks {
-		hookLogLabels := utils.MergeLabels(onStartupLabels, map[string]string{
+		hookLogLabels := utils.MergeLabels(logLabels, map[string]string{
 			"hook":      hookName,
 			"hook.type": "global",
 			"queue":     "main",
 			"binding":   string(OnStartup),
 		})
-		//delete(hookLogLabels, "task.id")
+		delete(hookLogLabels, "task.id")
 
 		onStartupBindingContext := BindingContext{Binding: string(OnStartup)}
 		onStartupBindingContext.Metadata.BindingType = OnStartup
@@ -392,13 +474,13 @@ func (op *AddonOperator) PrepopulateMainQueue(tqs *queue.TaskQueueSet) {
 			WithLogLabels(hookLogLabels).
 			WithQueueName("main").
 			WithMetadata(task.HookMetadata{
-				EventDescription:         "PrepopulateMainQueue",
+				EventDescription:         eventDescription,
 				HookName:                 hookName,
 				BindingType:              OnStartup,
 				BindingContext:           []BindingContext{onStartupBindingContext},
 				ReloadAllOnValuesChanges: false,
 			})
-		op.TaskQueues.GetMain().AddLast(newTask.WithQueuedAt(time.Now()))
+		tasks = append(tasks, newTask)
 
 		logEntry.WithFields(utils.LabelsToLogFields(newTask.LogLabels)).
 			Infof("queue task %s", newTask.GetDescription())
@@ -406,21 +488,22 @@ func (op *AddonOperator) PrepopulateMainQueue(tqs *queue.TaskQueueSet) {
 
 	schedHooks := op.ModuleManager.GetGlobalHooksInOrder(Schedule)
 	for _, hookName := range schedHooks {
-		hookLogLabels := utils.MergeLabels(onStartupLabels, map[string]string{
+		hookLogLabels := utils.MergeLabels(logLabels, map[string]string{
 			"hook":      hookName,
 			"hook.type": "global",
 			"queue":     "main",
 			"binding":   string(task.GlobalHookEnableScheduleBindings),
 		})
+		delete(hookLogLabels, "task.id")
 
 		newTask := sh_task.NewTask(task.GlobalHookEnableScheduleBindings).
 			WithLogLabels(hookLogLabels).
 			WithQueueName("main").
 			WithMetadata(task.HookMetadata{
-				EventDescription: "PrepopulateMainQueue",
+				EventDescription: eventDescription,
 				HookName:         hookName,
 			})
-		op.TaskQueues.GetMain().AddLast(newTask.WithQueuedAt(time.Now()))
+		tasks = append(tasks, newTask)
 
 		logEntry.WithFields(utils.LabelsToLogFields(newTask.LogLabels)).
 			Infof("queue task %s", newTask.GetDescription())
@@ -429,56 +512,45 @@ func (op *AddonOperator) PrepopulateMainQueue(tqs *queue.TaskQueueSet) {
 	// create tasks to enable kubernetes events for all global hooks with kubernetes bindings
 	kubeHooks := op.ModuleManager.GetGlobalHooksInOrder(OnKubernetesEvent)
 	for _, hookName := range kubeHooks {
-		hookLogLabels := utils.MergeLabels(onStartupLabels, map[string]string{
+		hookLogLabels := utils.MergeLabels(logLabels, map[string]string{
 			"hook":      hookName,
 			"hook.type": "global",
 			"queue":     "main",
 			"binding":   string(task.GlobalHookEnableKubernetesBindings),
 		})
-		//delete(hookLogLabels, "task.id")
+		delete(hookLogLabels, "task.id")
 
 		newTask := sh_task.NewTask(task.GlobalHookEnableKubernetesBindings).
 			WithLogLabels(hookLogLabels).
 			WithQueueName("main").
 			WithMetadata(task.HookMetadata{
-				EventDescription: "PrepopulateMainQueue",
+				EventDescription: eventDescription,
 				HookName:         hookName,
 			})
-		op.TaskQueues.GetMain().AddLast(newTask.WithQueuedAt(time.Now()))
+		tasks = append(tasks, newTask)
 
 		logEntry.WithFields(utils.LabelsToLogFields(newTask.LogLabels)).
 			Infof("queue task %s", newTask.GetDescription())
 	}
 
 	// wait for kubernetes.Synchronization
-	waitLogLabels := utils.MergeLabels(onStartupLabels, map[string]string{
+	waitLogLabels := utils.MergeLabels(logLabels, map[string]string{
 		"queue":   "main",
 		"binding": string(task.GlobalHookWaitKubernetesSynchronization),
 	})
+	delete(waitLogLabels, "task.id")
 	waitTask := sh_task.NewTask(task.GlobalHookWaitKubernetesSynchronization).
 		WithLogLabels(waitLogLabels).
 		WithQueueName("main").
 		WithMetadata(task.HookMetadata{
-			EventDescription: "PrepopulateMainQueue",
+			EventDescription: eventDescription,
 		})
-	op.TaskQueues.GetMain().AddLast(waitTask.WithQueuedAt(time.Now()))
+	tasks = append(tasks, waitTask)
 
 	logEntry.WithFields(utils.LabelsToLogFields(waitTask.LogLabels)).
 		Infof("queue task %s", waitTask.GetDescription())
 
-	// Create "ReloadAllModules" task with onStartup flag turned on to discover modules state for the first time.
-	logLabels := utils.MergeLabels(onStartupLabels, map[string]string{
-		"queue":   "main",
-		"binding": string(task.ReloadAllModules),
-	})
-	reloadAllModulesTask := sh_task.NewTask(task.ReloadAllModules).
-		WithLogLabels(logLabels).
-		WithQueueName("main").
-		WithMetadata(task.HookMetadata{
-			EventDescription: "PrepopulateMainQueue",
-			OnStartupHooks:   true,
-		})
-	op.TaskQueues.GetMain().AddLast(reloadAllModulesTask.WithQueuedAt(time.Now()))
+	return tasks
 }
 
 // CreateReloadAllTasks
@@ -664,6 +736,44 @@ func (op *AddonOperator) StartModuleManagerEventHandler() {
 					// TODO Check if this is needed?
 					// As module list may have changed, hook schedule index must be re-created.
 					//ScheduleHooksController.UpdateScheduleHooks()
+				case module_manager.ModuleFilesChanged:
+					logLabels["event.type"] = "ModuleFilesChanged"
+					logEntry := eventLogEntry.WithFields(utils.LabelsToLogFields(logLabels))
+					for _, moduleChange := range moduleEvent.ModulesChanges {
+						// Do not add ModuleReload task if it is already queued.
+						if QueueHasModuleTask(op.TaskQueues.GetMain(), task.ModuleReload, moduleChange.Name) {
+							logEntry.WithField("module", moduleChange.Name).Infof("module files are changed, ModuleReload task already exists")
+							continue
+						}
+						newLabels := utils.MergeLabels(logLabels)
+						newLabels["module"] = moduleChange.Name
+						newTask := sh_task.NewTask(task.ModuleReload).
+							WithLogLabels(newLabels).
+							WithQueueName("main").
+							WithMetadata(task.HookMetadata{
+								EventDescription: "ModuleFilesChanged",
+								ModuleName:       moduleChange.Name,
+							})
+						op.TaskQueues.GetMain().AddLast(newTask.WithQueuedAt(time.Now()))
+						logEntry.WithFields(utils.LabelsToLogFields(newTask.LogLabels)).
+							Infof("queue task %s", newTask.GetDescription())
+					}
+				case module_manager.GlobalFilesChanged:
+					logLabels["event.type"] = "GlobalFilesChanged"
+					logEntry := eventLogEntry.WithFields(utils.LabelsToLogFields(logLabels))
+					if QueueHasModuleTask(op.TaskQueues.GetMain(), task.GlobalHooksReload, "") {
+						logEntry.Infof("global hooks files are changed, GlobalHooksReload task already exists")
+						break
+					}
+					newTask := sh_task.NewTask(task.GlobalHooksReload).
+						WithLogLabels(logLabels).
+						WithQueueName("main").
+						WithMetadata(task.HookMetadata{
+							EventDescription: "GlobalFilesChanged",
+						})
+					op.TaskQueues.GetMain().AddLast(newTask.WithQueuedAt(time.Now()))
+					logEntry.WithFields(utils.LabelsToLogFields(newTask.LogLabels)).
+						Infof("queue task %s", newTask.GetDescription())
 				case module_manager.AmbiguousState:
 					// It is the error in the module manager. The task must be added to
 					// the beginning of the queue so the module manager can restore its
@@ -900,6 +1010,16 @@ func (op *AddonOperator) TaskHandler(t sh_task.Task) queue.TaskResult {
 			taskLogEntry.Infof("Module delete success '%s'", hm.ModuleName)
 			res.Status = "Success"
 		}
+		statusErr := op.ModuleStatusReporter.Update(hm.ModuleName, func(status *module_status.ModuleStatus) {
+			status.LastRun = module_status.NewRunStatus(err, time.Now())
+			if err == nil {
+				status.Enabled = false
+				status.ConfigChecksum = ""
+			}
+		})
+		if statusErr != nil {
+			taskLogEntry.Errorf("Cannot report status of module '%s': %s", hm.ModuleName, statusErr)
+		}
 
 	case task.ModuleHookRun:
 		res = op.HandleModuleHookRun(t, taskLogLabels)
@@ -917,6 +1037,12 @@ func (op *AddonOperator) TaskHandler(t sh_task.Task) queue.TaskResult {
 		}
 		res.Status = "Success"
 
+	case task.ModuleReload:
+		res = op.HandleModuleReload(t, taskLogLabels)
+
+	case task.GlobalHooksReload:
+		res = op.HandleGlobalHooksReload(t, taskLogLabels)
+
 	case task.ModuleManagerRetry:
 		op.MetricStorage.CounterAdd("{PREFIX}modules_discover_errors_total", 1.0, map[string]string{})
 		op.ModuleManager.Retry()
@@ -1245,6 +1371,156 @@ func (op *AddonOperator) HandleModuleRun(t sh_task.Task, labels map[string]strin
 			module.IsReady = true
 		}
 	}
+	op.reportModuleRun(module, moduleRunErr)
+	return
+}
+
+// reportModuleRun saves the result of the ModuleRun into the module status.
+// The checksum of config values is updated only if the run is successful.
+func (op *AddonOperator) reportModuleRun(module *module_manager.Module, moduleRunErr error) {
+	checksum := ""
+	if moduleRunErr == nil {
+		checksum, _ = module.ConfigValues().Checksum()
+	}
+	err := op.ModuleStatusReporter.Update(module.Name, func(status *module_status.ModuleStatus) {
+		status.Enabled = true
+		status.LastRun = module_status.NewRunStatus(moduleRunErr, time.Now())
+		if moduleRunErr == nil {
+			status.ConfigChecksum = checksum
+		}
+	})
+	if err != nil {
+		log.Errorf("Cannot report status of module '%s': %s", module.Name, err)
+	}
+}
+
+// HandleModuleReload re-registers the module after changes in its directory.
+// Tasks for old hooks are removed from queues. Then the module is run again or
+// all modules are reloaded if the module is added, removed or its enabled state can be changed.
+func (op *AddonOperator) HandleModuleReload(t sh_task.Task, labels map[string]string) (res queue.TaskResult) {
+	logEntry := log.WithFields(utils.LabelsToLogFields(labels))
+	hm := task.HookMetadataAccessor(t)
+
+	reloadRes, err := op.ModuleManager.ReloadModule(hm.ModuleName, t.GetLogLabels())
+	if err != nil {
+		op.MetricStorage.CounterAdd("{PREFIX}module_reload_errors_total", 1.0, map[string]string{"module": hm.ModuleName})
+		logEntry.Errorf("Module reload failed, requeue task to retry after delay. Failed count is %d. Error: %s", t.GetFailureCount()+1, err)
+		t.UpdateFailureMessage(err.Error())
+		t.WithQueuedAt(time.Now())
+		res.Status = "Fail"
+		return
+	}
+
+	// Tasks for old hooks and runs with the old module state are outdated.
+	op.TaskQueues.Iterate(func(q *queue.TaskQueue) {
+		q.Filter(func(tsk sh_task.Task) bool {
+			if tsk.GetId() == t.GetId() {
+				return true
+			}
+			switch tsk.GetType() {
+			case task.ModuleHookRun, task.ModuleRun:
+			case task.ModuleDelete:
+				if !reloadRes.Removed {
+					return true
+				}
+			default:
+				return true
+			}
+			return task.HookMetadataAccessor(tsk).ModuleName != hm.ModuleName
+		})
+	})
+	op.TaskQueues.Remove(fmt.Sprintf("main-subqueue-kubernetes-Synchronization-module-%s", hm.ModuleName))
+
+	// Start queues for new hooks.
+	op.InitAndStartHookQueues()
+
+	res.Status = "Success"
+	switch {
+	case reloadRes.DiscoveryNeeded:
+		logEntry.Infof("Module reload success, queue ReloadAllModules")
+		// Queue to the tail: ModuleReload tasks for other modules from the same event should run first.
+		newLogLabels := utils.MergeLabels(t.GetLogLabels())
+		delete(newLogLabels, "task.id")
+		reloadAllModulesTask := sh_task.NewTask(task.ReloadAllModules).
+			WithLogLabels(newLogLabels).
+			WithQueueName("main").
+			WithMetadata(task.HookMetadata{
+				EventDescription: hm.EventDescription,
+				OnStartupHooks:   false,
+			})
+		op.TaskQueues.GetMain().AddLast(reloadAllModulesTask.WithQueuedAt(time.Now()))
+	case reloadRes.RunNeeded:
+		logEntry.Infof("Module reload success, queue ModuleRun")
+		newLogLabels := utils.MergeLabels(t.GetLogLabels())
+		delete(newLogLabels, "task.id")
+		moduleRunTask := sh_task.NewTask(task.ModuleRun).
+			WithLogLabels(newLogLabels).
+			WithQueueName("main").
+			WithMetadata(task.HookMetadata{
+				EventDescription: hm.EventDescription,
+				ModuleName:       hm.ModuleName,
+				OnStartupHooks:   true,
+			})
+		res.AfterTasks = []sh_task.Task{moduleRunTask.WithQueuedAt(time.Now())}
+	default:
+		logEntry.Infof("Module reload success, module is disabled")
+	}
+
+	return
+}
+
+// HandleGlobalHooksReload re-registers global hooks after changes in global hooks directories
+// or in common values. Global hooks are started as on operator startup and all modules are reloaded.
+func (op *AddonOperator) HandleGlobalHooksReload(t sh_task.Task, labels map[string]string) (res queue.TaskResult) {
+	logEntry := log.WithFields(utils.LabelsToLogFields(labels))
+	hm := task.HookMetadataAccessor(t)
+
+	// Tasks for old global hooks are outdated.
+	op.TaskQueues.Iterate(func(q *queue.TaskQueue) {
+		q.Filter(func(tsk sh_task.Task) bool {
+			switch tsk.GetType() {
+			case task.GlobalHookRun,
+				task.GlobalHookEnableScheduleBindings,
+				task.GlobalHookEnableKubernetesBindings,
+				task.GlobalHookWaitKubernetesSynchronization:
+				return false
+			}
+			return true
+		})
+	})
+
+	err := op.ModuleManager.ReloadGlobalHooks(t.GetLogLabels())
+	if err != nil {
+		op.MetricStorage.CounterAdd("{PREFIX}global_hooks_reload_errors_total", 1.0, map[string]string{})
+		logEntry.Errorf("Global hooks reload failed, requeue task to retry after delay. Failed count is %d. Error: %s", t.GetFailureCount()+1, err)
+		t.UpdateFailureMessage(err.Error())
+		t.WithQueuedAt(time.Now())
+		res.Status = "Fail"
+		return
+	}
+
+	// Start queues for new hooks.
+	op.InitAndStartHookQueues()
+
+	logEntry.Infof("Global hooks reload success, queue global hooks startup tasks and ReloadAllModules")
+	tasks := op.CreateGlobalHooksStartupTasks(t.GetLogLabels(), hm.EventDescription)
+
+	reloadLogLabels := utils.MergeLabels(t.GetLogLabels())
+	delete(reloadLogLabels, "task.id")
+	reloadAllModulesTask := sh_task.NewTask(task.ReloadAllModules).
+		WithLogLabels(reloadLogLabels).
+		WithQueueName("main").
+		WithMetadata(task.HookMetadata{
+			EventDescription: hm.EventDescription,
+			OnStartupHooks:   false,
+		})
+	tasks = append(tasks, reloadAllModulesTask)
+
+	for _, tsk := range tasks {
+		tsk.WithQueuedAt(time.Now())
+	}
+	res.Status = "Success"
+	res.AfterTasks = tasks
 	return
 }
 
@@ -1746,6 +2022,10 @@ func (op *AddonOperator) SetupDebugServerHandles() {
 			return
 		}
 
+		if !showSecrets(request) {
+			values = utils.RedactValues(values)
+		}
+
 		outBytes, err := values.AsBytes(format)
 		if err != nil {
 			writer.WriteHeader(http.StatusInternalServerError)
@@ -1755,8 +2035,24 @@ func (op *AddonOperator) SetupDebugServerHandles() {
 		_, _ = writer.Write(outBytes)
 	})
 
+	op.DebugServer.Router.Get("/global/values-explain.{format:(json|yaml)}", func(writer http.ResponseWriter, request *http.Request) {
+		format := chi.URLParam(request, "format")
+
+		explain, err := op.ModuleManager.GlobalValuesExplain()
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			_, _ = writer.Write([]byte(err.Error()))
+			return
+		}
+
+		writeValuesExplain(writer, explain, format, showSecrets(request))
+	})
+
 	op.DebugServer.Router.Get("/global/patches.json", func(writer http.ResponseWriter, request *http.Request) {
 		jp := op.ModuleManager.GlobalValuesPatches()
+		if !showSecrets(request) {
+			jp = utils.RedactValuesPatches(jp)
+		}
 		data, err := json.Marshal(jp)
 		if err != nil {
 			writer.WriteHeader(http.StatusInternalServerError)
@@ -1769,12 +2065,27 @@ func (op *AddonOperator) SetupDebugServerHandles() {
 	op.DebugServer.Router.Get("/module/list.{format:(json|yaml|text)}", func(writer http.ResponseWriter, request *http.Request) {
 		format := chi.URLParam(request, "format")
 
-		_, _ = fmt.Fprintf(writer, "Dump enabled modules in %s format.\n", format)
-
+		modules := make([]module_manager.ModuleInfo, 0)
 		for _, mName := range op.ModuleManager.GetModuleNamesInOrder() {
-			_, _ = fmt.Fprintf(writer, "%s \n", mName)
+			modules = append(modules, op.ModuleManager.GetModule(mName).Info())
 		}
 
+		var outBytes []byte
+		var err error
+		switch format {
+		case "yaml":
+			outBytes, err = yaml.Marshal(modules)
+		case "json":
+			outBytes, err = json.Marshal(modules)
+		case "text":
+			outBytes = formatModuleList(modules)
+		}
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			_, _ = fmt.Fprintf(writer, "Error: %s", err)
+			return
+		}
+		_, _ = writer.Write(outBytes)
 	})
 
 	op.DebugServer.Router.Get("/module/{name}/{type:(config|values)}.{format:(json|yaml)}", func(writer http.ResponseWriter, request *http.Request) {
@@ -1804,6 +2115,10 @@ func (op *AddonOperator) SetupDebugServerHandles() {
 			return
 		}
 
+		if !showSecrets(request) {
+			values = utils.RedactValues(values)
+		}
+
 		outBytes, err := values.AsBytes(format)
 		if err != nil {
 			writer.WriteHeader(http.StatusInternalServerError)
@@ -1813,6 +2128,27 @@ func (op *AddonOperator) SetupDebugServerHandles() {
 		_, _ = writer.Write(outBytes)
 	})
 
+	op.DebugServer.Router.Get("/module/{name}/values-explain.{format:(json|yaml)}", func(writer http.ResponseWriter, request *http.Request) {
+		modName := chi.URLParam(request, "name")
+		format := chi.URLParam(request, "format")
+
+		m := op.ModuleManager.GetModule(modName)
+		if m == nil {
+			writer.WriteHeader(http.StatusNotFound)
+			_, _ = writer.Write([]byte("Module not found"))
+			return
+		}
+
+		explain, err := m.ValuesExplain()
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			_, _ = writer.Write([]byte(err.Error()))
+			return
+		}
+
+		writeValuesExplain(writer, explain, format, showSecrets(request))
+	})
+
 	op.DebugServer.Router.Get("/module/{name}/render", func(writer http.ResponseWriter, request *http.Request) {
 		modName := chi.URLParam(request, "name")
 
@@ -1823,7 +2159,14 @@ func (op *AddonOperator) SetupDebugServerHandles() {
 			return
 		}
 
-		valuesPath, err := m.PrepareValuesYamlFile()
+		// Manifests are rendered with redacted values to not show sensitive values.
+		var valuesPath string
+		var err error
+		if showSecrets(request) {
+			valuesPath, err = m.PrepareValuesYamlFile()
+		} else {
+			valuesPath, err = m.PrepareRedactedValuesYamlFile()
+		}
 		if err != nil {
 			writer.WriteHeader(http.StatusInternalServerError)
 			_, _ = writer.Write([]byte(err.Error()))
@@ -1852,6 +2195,9 @@ func (op *AddonOperator) SetupDebugServerHandles() {
 		}
 
 		jp := m.ValuesPatches()
+		if !showSecrets(request) {
+			jp = utils.RedactValuesPatches(jp)
+		}
 		data, err := json.Marshal(jp)
 		if err != nil {
 			writer.WriteHeader(http.StatusInternalServerError)
@@ -1891,6 +2237,91 @@ func (op *AddonOperator) SetupDebugServerHandles() {
 		_, _ = writer.Write(outBytes)
 	})
 
+	// Errors of broken sections in the config by section ('global' or module name).
+	op.DebugServer.Router.Get("/module/config-errors.{format:(json|yaml)}", func(writer http.ResponseWriter, request *http.Request) {
+		format := chi.URLParam(request, "format")
+
+		dump := op.KubeConfigManager.ConfigErrors()
+
+		var outBytes []byte
+		var err error
+		switch format {
+		case "yaml":
+			outBytes, err = yaml.Marshal(dump)
+		case "json":
+			outBytes, err = json.Marshal(dump)
+		}
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			_, _ = fmt.Fprintf(writer, "Error: %s", err)
+			return
+		}
+		_, _ = writer.Write(outBytes)
+	})
+
+	// Last rejected values by section ('global' or module name) and by the source of values.
+	op.DebugServer.Router.Get("/module/validation-errors.{format:(json|yaml)}", func(writer http.ResponseWriter, request *http.Request) {
+		format := chi.URLParam(request, "format")
+
+		dump := op.ModuleManager.ValuesValidationErrors()
+
+		var outBytes []byte
+		var err error
+		switch format {
+		case "yaml":
+			outBytes, err = yaml.Marshal(dump)
+		case "json":
+			outBytes, err = json.Marshal(dump)
+		}
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			_, _ = fmt.Fprintf(writer, "Error: %s", err)
+			return
+		}
+		_, _ = writer.Write(outBytes)
+	})
+
+}
+
+// formatModuleList returns a table with modules in the order of run.
+func formatModuleList(modules []module_manager.ModuleInfo) []byte {
+	buf := new(bytes.Buffer)
+	w := tabwriter.NewWriter(buf, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tWEIGHT\tVERSION\tTAGS\tPATH\tDESCRIPTION")
+	for _, m := range modules {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", m.Name, m.Weight, m.Version, strings.Join(m.Tags, ","), m.Path, m.Description)
+	}
+	_ = w.Flush()
+	return buf.Bytes()
+}
+
+// showSecrets returns true if the debug client asks to not redact sensitive values.
+func showSecrets(request *http.Request) bool {
+	return request.URL.Query().Get("show-secrets") == "true"
+}
+
+// writeValuesExplain writes leaf values with their sources in json or yaml format.
+func writeValuesExplain(writer http.ResponseWriter, explain []utils.ValueExplanation, format string, showSecrets bool) {
+	if !showSecrets {
+		for i := range explain {
+			explain[i].Value = utils.RedactValue(utils.PointerToPath(explain[i].Path), explain[i].Value)
+		}
+	}
+
+	var outBytes []byte
+	var err error
+	switch format {
+	case "yaml":
+		outBytes, err = yaml.Marshal(explain)
+	case "json":
+		outBytes, err = json.Marshal(explain)
+	}
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(writer, "Error: %s", err)
+		return
+	}
+	_, _ = writer.Write(outBytes)
 }
 
 func (op *AddonOperator) SetupHttpServerHandles() {
@@ -2057,9 +2488,14 @@ func InitAndStart(operator *AddonOperator) error {
 }
 
 func QueueHasModuleRunTask(q *queue.TaskQueue, moduleName string) bool {
+	return QueueHasModuleTask(q, task.ModuleRun, moduleName)
+}
+
+// QueueHasModuleTask returns true if the queue has a task of the type for the module.
+func QueueHasModuleTask(q *queue.TaskQueue, taskType sh_task.TaskType, moduleName string) bool {
 	hasTask := false
 	q.Filter(func(t sh_task.Task) bool {
-		if t.GetType() == task.ModuleRun {
+		if t.GetType() == taskType {
 			hm := task.HookMetadataAccessor(t)
 			if hm.ModuleName == moduleName {
 				hasTask = true
@@ -27,8 +27,23 @@ var Helm3HistoryMax int32 = 10
 var Helm3Timeout time.Duration = 5 * time.Minute
 
 var Namespace = ""
+var ConfigBackend = "ConfigMap"
 var ConfigMapName = "addon-operator"
+var ConfigMapLayers = ""
+var ConfigDir = ""
+var ConfigSecretName = ""
 var ValuesChecksumsAnnotation = "addon-operator/values-checksums"
+var ValuesPatchesStorage = "none"
+var ValuesPatchesMaxOperations = 200
+var ValuesPatchesMaxSize = 256 * 1024
+var SensitivePaths = ""
+var ModuleStatusConfigMapName = ""
+var WatchDirsInterval time.Duration = 0
+
+var ValidatingWebhookListenAddress = "0.0.0.0"
+var ValidatingWebhookListenPort = "9651"
+var ValidatingWebhookCertFile = ""
+var ValidatingWebhookKeyFile = ""
 
 var GlobalHooksDir = "global-hooks"
 var ModulesDir = "modules"
@@ -89,11 +104,78 @@ func DefineStartCommandFlags(kpApp *kingpin.Application, cmd *kingpin.CmdClause)
 		Default(Helm3Timeout.String()).
 		DurationVar(&Helm3Timeout)
 
+	cmd.Flag("config-backend", "Kind of objects to store values: ConfigMap, ModuleConfig or Files.").
+		Envar("ADDON_OPERATOR_CONFIG_BACKEND").
+		Default(ConfigBackend).
+		EnumVar(&ConfigBackend, "ConfigMap", "ModuleConfig", "Files")
+
+	cmd.Flag("config-dir", "A directory with values files for the Files config backend.").
+		Envar("ADDON_OPERATOR_CONFIG_DIR").
+		Default(ConfigDir).
+		StringVar(&ConfigDir)
+
 	cmd.Flag("config-map", "Name of a ConfigMap to store values.").
 		Envar("ADDON_OPERATOR_CONFIG_MAP").
 		Default(ConfigMapName).
 		StringVar(&ConfigMapName)
 
+	cmd.Flag("config-map-layers", "Comma-separated list of ConfigMaps with values merged in order, later ConfigMaps override earlier ones. Values from hooks are saved only into the ConfigMap from --config-map, it is the last layer if it is not in the list.").
+		Envar("ADDON_OPERATOR_CONFIG_MAP_LAYERS").
+		Default(ConfigMapLayers).
+		StringVar(&ConfigMapLayers)
+
+	cmd.Flag("config-secret", "Name of a Secret to store sensitive values. Values in the Secret override values in the ConfigMap.").
+		Envar("ADDON_OPERATOR_CONFIG_SECRET").
+		Default(ConfigSecretName).
+		StringVar(&ConfigSecretName)
+
+	cmd.Flag("values-patches-storage", "Kind of objects to persist dynamic values patches across restarts: none, ConfigMap or Secret.").
+		Envar("ADDON_OPERATOR_VALUES_PATCHES_STORAGE").
+		Default(ValuesPatchesStorage).
+		EnumVar(&ValuesPatchesStorage, "none", "ConfigMap", "Secret")
+
+	cmd.Flag("values-patches-max-operations", "Compact dynamic values patches for a module or for the global section when the number of operations exceeds this limit. Use 0 for no limit.").
+		Envar("ADDON_OPERATOR_VALUES_PATCHES_MAX_OPERATIONS").
+		Default(strconv.Itoa(ValuesPatchesMaxOperations)).
+		IntVar(&ValuesPatchesMaxOperations)
+
+	cmd.Flag("values-patches-max-size", "Compact dynamic values patches for a module or for the global section when their size in bytes exceeds this limit. Use 0 for no limit.").
+		Envar("ADDON_OPERATOR_VALUES_PATCHES_MAX_SIZE").
+		Default(strconv.Itoa(ValuesPatchesMaxSize)).
+		IntVar(&ValuesPatchesMaxSize)
+
+	cmd.Flag("module-status-config-map", "Name of a ConfigMap to report statuses of modules: enabled state, applied config checksum, validation errors and the last run result. Statuses are not reported if empty.").
+		Envar("ADDON_OPERATOR_MODULE_STATUS_CONFIG_MAP").
+		Default(ModuleStatusConfigMapName).
+		StringVar(&ModuleStatusConfigMapName)
+
+	cmd.Flag("watch-dirs-interval", "Interval to check modules and global hooks directories for changes. Changed modules and global hooks are reloaded without restart. Directories are not watched if 0.").
+		Envar("ADDON_OPERATOR_WATCH_DIRS_INTERVAL").
+		Default(WatchDirsInterval.String()).
+		DurationVar(&WatchDirsInterval)
+
+	cmd.Flag("validating-webhook-listen-address", "Address to serve the validating webhook for values.").
+		Envar("ADDON_OPERATOR_VALIDATING_WEBHOOK_LISTEN_ADDRESS").
+		Default(ValidatingWebhookListenAddress).
+		StringVar(&ValidatingWebhookListenAddress)
+	cmd.Flag("validating-webhook-listen-port", "Port to serve the validating webhook for values.").
+		Envar("ADDON_OPERATOR_VALIDATING_WEBHOOK_LISTEN_PORT").
+		Default(ValidatingWebhookListenPort).
+		StringVar(&ValidatingWebhookListenPort)
+	cmd.Flag("validating-webhook-cert-file", "A path to a TLS certificate for the validating webhook. The webhook is started if the certificate is set.").
+		Envar("ADDON_OPERATOR_VALIDATING_WEBHOOK_CERT_FILE").
+		Default(ValidatingWebhookCertFile).
+		StringVar(&ValidatingWebhookCertFile)
+	cmd.Flag("validating-webhook-key-file", "A path to a TLS key for the validating webhook.").
+		Envar("ADDON_OPERATOR_VALIDATING_WEBHOOK_KEY_FILE").
+		Default(ValidatingWebhookKeyFile).
+		StringVar(&ValidatingWebhookKeyFile)
+
+	cmd.Flag("sensitive-paths", "Comma-separated list of dot-separated paths of sensitive values to redact in logs and in debug output, e.g. 'global.registry.dockercfg,*.password'. '*' matches any key.").
+		Envar("ADDON_OPERATOR_SENSITIVE_PATHS").
+		Default(SensitivePaths).
+		StringVar(&SensitivePaths)
+
 	sh_app.DefineKubeClientFlags(cmd)
 	sh_app.DefineJqFlags(cmd)
 	sh_app.DefineLoggingFlags(cmd)
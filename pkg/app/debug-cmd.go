@@ -12,17 +12,26 @@ import (
 func DefineDebugCommands(kpApp *kingpin.Application) {
 	globalCmd := sh_app.CommandWithDefaultUsageTemplate(kpApp, "global", "manage global values")
 
+	var explainValues bool
 	globalValuesCmd := globalCmd.Command("values", "Dump current global values.").
 		Action(func(c *kingpin.ParseContext) error {
-			dump, err := Global(sh_debug.DefaultClient()).Values(sh_debug.OutputFormat)
+			var dump []byte
+			var err error
+			if explainValues {
+				dump, err = Global(sh_debug.DefaultClient()).ValuesExplain(sh_debug.OutputFormat)
+			} else {
+				dump, err = Global(sh_debug.DefaultClient()).Values(sh_debug.OutputFormat)
+			}
 			if err != nil {
 				return err
 			}
 			fmt.Println(string(dump))
 			return nil
 		})
+	globalValuesCmd.Flag("explain", "Dump leaf values with the source of each value.").BoolVar(&explainValues)
 	// -o json|yaml and --debug-unix-socket <file>
 	AddOutputJsonYamlFlag(globalValuesCmd)
+	AddShowSecretsFlag(globalValuesCmd)
 	sh_app.DefineDebugUnixSocketFlag(globalValuesCmd)
 
 	globalConfigCmd := globalCmd.Command("config", "Dump global config values.").
@@ -36,6 +45,7 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 		})
 	// -o json|yaml and --debug-unix-socket <file>
 	AddOutputJsonYamlFlag(globalConfigCmd)
+	AddShowSecretsFlag(globalConfigCmd)
 	sh_app.DefineDebugUnixSocketFlag(globalConfigCmd)
 
 	globalPatchesCmd := globalCmd.Command("patches", "Dump global value patches.").
@@ -48,11 +58,12 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 			return nil
 		})
 	// --debug-unix-socket <file>
+	AddShowSecretsFlag(globalPatchesCmd)
 	sh_app.DefineDebugUnixSocketFlag(globalPatchesCmd)
 
 	moduleCmd := sh_app.CommandWithDefaultUsageTemplate(kpApp, "module", "manage modules ant their values")
 
-	moduleListCmd := moduleCmd.Command("list", "List available modules and their enabled status.").
+	moduleListCmd := moduleCmd.Command("list", "List available modules with their weights and metadata.").
 		Action(func(c *kingpin.ParseContext) error {
 			modules, err := Module(sh_debug.DefaultClient()).List(sh_debug.OutputFormat)
 			if err != nil {
@@ -68,7 +79,13 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 	var moduleName string
 	moduleValuesCmd := moduleCmd.Command("values", "Dump module values by name.").
 		Action(func(c *kingpin.ParseContext) error {
-			dump, err := Module(sh_debug.DefaultClient()).Name(moduleName).Values(sh_debug.OutputFormat)
+			var dump []byte
+			var err error
+			if explainValues {
+				dump, err = Module(sh_debug.DefaultClient()).Name(moduleName).ValuesExplain(sh_debug.OutputFormat)
+			} else {
+				dump, err = Module(sh_debug.DefaultClient()).Name(moduleName).Values(sh_debug.OutputFormat)
+			}
 			if err != nil {
 				return err
 			}
@@ -76,8 +93,10 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 			return nil
 		})
 	moduleValuesCmd.Arg("module_name", "").Required().StringVar(&moduleName)
+	moduleValuesCmd.Flag("explain", "Dump leaf values with the source of each value.").BoolVar(&explainValues)
 	// -o json|yaml and --debug-unix-socket <file>
 	AddOutputJsonYamlFlag(moduleValuesCmd)
+	AddShowSecretsFlag(moduleValuesCmd)
 	sh_app.DefineDebugUnixSocketFlag(moduleValuesCmd)
 
 	moduleRenderCmd := moduleCmd.Command("render", "Render module manifests.").
@@ -91,6 +110,7 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 		})
 	moduleRenderCmd.Arg("module_name", "").Required().StringVar(&moduleName)
 	AddOutputJsonYamlFlag(moduleRenderCmd)
+	AddShowSecretsFlag(moduleRenderCmd)
 	sh_app.DefineDebugUnixSocketFlag(moduleRenderCmd)
 
 	moduleConfigCmd := moduleCmd.Command("config", "Dump module config values by name.").
@@ -105,6 +125,7 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 	moduleConfigCmd.Arg("module_name", "").Required().StringVar(&moduleName)
 	// -o json|yaml and --debug-unix-socket <file>
 	AddOutputJsonYamlFlag(moduleConfigCmd)
+	AddShowSecretsFlag(moduleConfigCmd)
 	sh_app.DefineDebugUnixSocketFlag(moduleConfigCmd)
 
 	modulePatchesCmd := moduleCmd.Command("patches", "Dump module value patches by name.").
@@ -118,6 +139,7 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 		})
 	modulePatchesCmd.Arg("module_name", "").Required().StringVar(&moduleName)
 	// --debug-unix-socket <file>
+	AddShowSecretsFlag(modulePatchesCmd)
 	sh_app.DefineDebugUnixSocketFlag(modulePatchesCmd)
 
 	moduleResourceMonitorCmd := moduleCmd.Command("resource-monitor", "Dump resource monitors.").
@@ -133,6 +155,49 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 	AddOutputJsonYamlFlag(moduleResourceMonitorCmd)
 	sh_app.DefineDebugUnixSocketFlag(moduleResourceMonitorCmd)
 
+	moduleValidationErrorsCmd := moduleCmd.Command("validation-errors", "Dump last values validation errors for global section and modules.").
+		Action(func(c *kingpin.ParseContext) error {
+			out, err := Module(sh_debug.DefaultClient()).ValidationErrors(sh_debug.OutputFormat)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			return nil
+		})
+	// -o json|yaml and --debug-unix-socket <file>
+	AddOutputJsonYamlFlag(moduleValidationErrorsCmd)
+	sh_app.DefineDebugUnixSocketFlag(moduleValidationErrorsCmd)
+
+	moduleConfigErrorsCmd := moduleCmd.Command("config-errors", "Dump errors of broken sections in the config for global section and modules.").
+		Action(func(c *kingpin.ParseContext) error {
+			out, err := Module(sh_debug.DefaultClient()).ConfigErrors(sh_debug.OutputFormat)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			return nil
+		})
+	// -o json|yaml and --debug-unix-socket <file>
+	AddOutputJsonYamlFlag(moduleConfigErrorsCmd)
+	sh_app.DefineDebugUnixSocketFlag(moduleConfigErrorsCmd)
+
+}
+
+// ShowSecrets disables redaction of sensitive values in debug output.
+var ShowSecrets = false
+
+func AddShowSecretsFlag(cmd *kingpin.CmdClause) {
+	cmd.Flag("show-secrets", "Do not redact sensitive values.").
+		Default("false").
+		BoolVar(&ShowSecrets)
+}
+
+// showSecretsQuery returns a query string for the debug server.
+func showSecretsQuery() string {
+	if ShowSecrets {
+		return "?show-secrets=true"
+	}
+	return ""
 }
 
 func AddOutputJsonYamlFlag(cmd *kingpin.CmdClause) {
@@ -150,17 +215,22 @@ func Global(client *sh_debug.Client) *GlobalRequest {
 }
 
 func (gr *GlobalRequest) Values(format string) ([]byte, error) {
-	url := fmt.Sprintf("http://unix/global/values.%s", format)
+	url := fmt.Sprintf("http://unix/global/values.%s%s", format, showSecretsQuery())
+	return gr.client.Get(url)
+}
+
+func (gr *GlobalRequest) ValuesExplain(format string) ([]byte, error) {
+	url := fmt.Sprintf("http://unix/global/values-explain.%s%s", format, showSecretsQuery())
 	return gr.client.Get(url)
 }
 
 func (gr *GlobalRequest) Config(format string) ([]byte, error) {
-	url := fmt.Sprintf("http://unix/global/config.%s", format)
+	url := fmt.Sprintf("http://unix/global/config.%s%s", format, showSecretsQuery())
 	return gr.client.Get(url)
 }
 
 func (gr *GlobalRequest) Patches() ([]byte, error) {
-	url := fmt.Sprintf("http://unix/global/patches.json")
+	url := "http://unix/global/patches.json" + showSecretsQuery()
 	return gr.client.Get(url)
 }
 
@@ -183,27 +253,42 @@ func (mr *ModuleRequest) ResourceMonitor(format string) ([]byte, error) {
 	return mr.client.Get(url)
 }
 
+func (mr *ModuleRequest) ValidationErrors(format string) ([]byte, error) {
+	url := fmt.Sprintf("http://unix/module/validation-errors.%s", format)
+	return mr.client.Get(url)
+}
+
+func (mr *ModuleRequest) ConfigErrors(format string) ([]byte, error) {
+	url := fmt.Sprintf("http://unix/module/config-errors.%s", format)
+	return mr.client.Get(url)
+}
+
 func (mr *ModuleRequest) Name(name string) *ModuleRequest {
 	mr.name = name
 	return mr
 }
 
 func (mr *ModuleRequest) Values(format string) ([]byte, error) {
-	url := fmt.Sprintf("http://unix/module/%s/values.%s", mr.name, format)
+	url := fmt.Sprintf("http://unix/module/%s/values.%s%s", mr.name, format, showSecretsQuery())
+	return mr.client.Get(url)
+}
+
+func (mr *ModuleRequest) ValuesExplain(format string) ([]byte, error) {
+	url := fmt.Sprintf("http://unix/module/%s/values-explain.%s%s", mr.name, format, showSecretsQuery())
 	return mr.client.Get(url)
 }
 
 func (mr *ModuleRequest) Render() ([]byte, error) {
-	url := fmt.Sprintf("http://unix/module/%s/render", mr.name)
+	url := fmt.Sprintf("http://unix/module/%s/render%s", mr.name, showSecretsQuery())
 	return mr.client.Get(url)
 }
 
 func (mr *ModuleRequest) Patches() ([]byte, error) {
-	url := fmt.Sprintf("http://unix/module/%s/patches.json", mr.name)
+	url := fmt.Sprintf("http://unix/module/%s/patches.json%s", mr.name, showSecretsQuery())
 	return mr.client.Get(url)
 }
 
 func (mr *ModuleRequest) Config(format string) ([]byte, error) {
-	url := fmt.Sprintf("http://unix/module/%s/config.%s", mr.name, format)
+	url := fmt.Sprintf("http://unix/module/%s/config.%s%s", mr.name, format, showSecretsQuery())
 	return mr.client.Get(url)
 }
@@ -0,0 +1,361 @@
+package config_webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/flant/shell-operator/pkg/kube"
+
+	"github.com/flant/addon-operator/pkg/kube_config_manager"
+)
+
+// ValidatePath is a path to send AdmissionReview requests to.
+const ValidatePath = "/validate"
+
+// ConfigValidator validates parsed config and returns errors by section ('global' or module name).
+type ConfigValidator interface {
+	ValidateKubeConfig(kubeConfig *kube_config_manager.Config) map[string]string
+}
+
+// WebhookServer is a validating admission webhook for the values ConfigMap and ModuleConfig objects.
+// New config data is parsed and validated the same way as on changes in the cluster:
+// broken YAML, bad Enabled keys and values that not match OpenAPI schemas are rejected.
+// Other objects are allowed.
+type WebhookServer struct {
+	ListenAddress string
+	ListenPort    string
+	CertFile      string
+	KeyFile       string
+
+	KubeClient    kube.KubernetesClient
+	Namespace     string
+	ConfigMapName string
+	// Optional read-only ConfigMaps merged with the ConfigMapName in order.
+	ConfigMapLayers []string
+	// Optional Secret with sensitive values. It is merged with the ConfigMap or ModuleConfig objects before validation.
+	SecretName string
+
+	Validator ConfigValidator
+}
+
+func NewWebhookServer() *WebhookServer {
+	return &WebhookServer{}
+}
+
+func (s *WebhookServer) WithListenAddress(address string, port string) {
+	s.ListenAddress = address
+	s.ListenPort = port
+}
+
+func (s *WebhookServer) WithTLSFiles(certFile string, keyFile string) {
+	s.CertFile = certFile
+	s.KeyFile = keyFile
+}
+
+func (s *WebhookServer) WithKubeClient(client kube.KubernetesClient) {
+	s.KubeClient = client
+}
+
+func (s *WebhookServer) WithNamespace(namespace string) {
+	s.Namespace = namespace
+}
+
+func (s *WebhookServer) WithConfigMapName(name string) {
+	s.ConfigMapName = name
+}
+
+func (s *WebhookServer) WithConfigMapLayers(names []string) {
+	s.ConfigMapLayers = names
+}
+
+func (s *WebhookServer) WithSecretName(name string) {
+	s.SecretName = name
+}
+
+func (s *WebhookServer) WithValidator(validator ConfigValidator) {
+	s.Validator = validator
+}
+
+// Handler returns a handler for AdmissionReview requests.
+func (s *WebhookServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ValidatePath, s.handleValidate)
+	return mux
+}
+
+// Start serves HTTPS requests in background.
+func (s *WebhookServer) Start() error {
+	if s.CertFile == "" || s.KeyFile == "" {
+		return fmt.Errorf("certificate and key files are required for the validating webhook")
+	}
+
+	address := fmt.Sprintf("%s:%s", s.ListenAddress, s.ListenPort)
+	srv := &http.Server{
+		Addr:    address,
+		Handler: s.Handler(),
+	}
+
+	log.Infof("Validating webhook listens on https://%s%s", address, ValidatePath)
+	go func() {
+		err := srv.ListenAndServeTLS(s.CertFile, s.KeyFile)
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorf("Validating webhook stopped: %s", err)
+		}
+	}()
+	return nil
+}
+
+func (s *WebhookServer) handleValidate(writer http.ResponseWriter, request *http.Request) {
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("read request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	review := admissionv1.AdmissionReview{}
+	err = json.Unmarshal(body, &review)
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("decode AdmissionReview: %s", err), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		http.Error(writer, "AdmissionReview has no request", http.StatusBadRequest)
+		return
+	}
+
+	// AdmissionReview versions v1 and v1beta1 have the same format, so the response
+	// is sent with the version of the request.
+	review.Response = s.Review(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+
+	data, err := json.Marshal(review)
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("encode AdmissionReview: %s", err), http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	_, _ = writer.Write(data)
+}
+
+// Review returns a response for the admission request.
+func (s *WebhookServer) Review(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	if request.Operation != admissionv1.Create && request.Operation != admissionv1.Update {
+		return allowed()
+	}
+
+	logEntry := log.WithField("operator.component", "validatingWebhook")
+
+	var configData map[string]string
+	// Sections to report. Errors of all sections are reported if it is empty.
+	var sections []string
+	switch request.Kind.Kind {
+	case "ConfigMap":
+		obj := &v1.ConfigMap{}
+		err := json.Unmarshal(request.Object.Raw, obj)
+		if err != nil {
+			return denied(fmt.Sprintf("decode ConfigMap: %s", err))
+		}
+		if !s.isLayer(obj.Name) || request.Namespace != s.Namespace {
+			return allowed()
+		}
+		configData, err = s.mergeLayersData(obj)
+		if err != nil {
+			return denied(err.Error())
+		}
+		configData, err = s.mergeSecretData(configData)
+		if err != nil {
+			return denied(err.Error())
+		}
+	case kube_config_manager.ModuleConfigKind:
+		obj := &unstructured.Unstructured{}
+		err := json.Unmarshal(request.Object.Raw, &obj.Object)
+		if err != nil {
+			return denied(fmt.Sprintf("decode %s: %s", kube_config_manager.ModuleConfigKind, err))
+		}
+		if request.Namespace != s.Namespace {
+			return allowed()
+		}
+		configData, err = s.mergeModuleConfigsData(obj)
+		if err != nil {
+			return denied(err.Error())
+		}
+		configData, err = s.mergeSecretData(configData)
+		if err != nil {
+			return denied(err.Error())
+		}
+		// The object has only its own section, other sections are validated on their changes.
+		sections = []string{obj.GetName()}
+	default:
+		return allowed()
+	}
+
+	messages := formatConfigErrors(s.configDataErrors(configData), sections)
+	if len(messages) > 0 {
+		logEntry.Infof("%s %s/%s is rejected: %s", request.Operation, request.Kind.Kind, request.Name, strings.Join(messages, "; "))
+		return denied(strings.Join(messages, "; "))
+	}
+	return allowed()
+}
+
+// ValidateConfigData parses config data and validates values. It returns
+// readable errors sorted by section.
+func (s *WebhookServer) ValidateConfigData(configData map[string]string) []string {
+	return formatConfigErrors(s.configDataErrors(configData), nil)
+}
+
+// configDataErrors parses config data and validates values. It returns errors by section.
+func (s *WebhookServer) configDataErrors(configData map[string]string) map[string]string {
+	config, errors := kube_config_manager.ParseConfigData(configData)
+
+	// Broken sections are not in the config, so they are not validated again.
+	for section, msg := range s.Validator.ValidateKubeConfig(config) {
+		if _, has := errors[section]; !has {
+			errors[section] = msg
+		}
+	}
+	return errors
+}
+
+// formatConfigErrors returns readable errors sorted by section. Only errors
+// of onlySections are returned if it is not empty.
+func formatConfigErrors(errors map[string]string, onlySections []string) []string {
+	sections := make([]string, 0, len(errors))
+	for section := range errors {
+		if len(onlySections) > 0 && !hasSection(onlySections, section) {
+			continue
+		}
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+
+	messages := make([]string, 0, len(sections))
+	for _, section := range sections {
+		messages = append(messages, fmt.Sprintf("section '%s': %s", section, errors[section]))
+	}
+	return messages
+}
+
+func hasSection(sections []string, section string) bool {
+	for _, name := range sections {
+		if name == section {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *WebhookServer) isLayer(name string) bool {
+	for _, layerName := range kube_config_manager.LayerNames(s.ConfigMapLayers, s.ConfigMapName) {
+		if layerName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeLayersData merges the new version of the ConfigMap with other ConfigMap layers.
+func (s *WebhookServer) mergeLayersData(obj *v1.ConfigMap) (map[string]string, error) {
+	layerNames := kube_config_manager.LayerNames(s.ConfigMapLayers, s.ConfigMapName)
+	if len(layerNames) == 1 {
+		return obj.Data, nil
+	}
+
+	layersData := make([]map[string]string, 0, len(layerNames))
+	for _, name := range layerNames {
+		if name == obj.Name {
+			layersData = append(layersData, obj.Data)
+			continue
+		}
+		layer, err := s.KubeClient.CoreV1().ConfigMaps(s.Namespace).Get(name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get ConfigMap/%s: %s", name, err)
+		}
+		layersData = append(layersData, layer.Data)
+	}
+	return kube_config_manager.MergeLayersData(layersData), nil
+}
+
+// mergeModuleConfigsData returns config data of the new version of the ModuleConfig
+// merged with data of other ModuleConfig objects, so the object is validated within the full config.
+// Broken other objects are ignored: their errors are reported on their own changes.
+func (s *WebhookServer) mergeModuleConfigsData(obj *unstructured.Unstructured) (map[string]string, error) {
+	configData, err := kube_config_manager.ModuleConfigToConfigData(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := s.KubeClient.Dynamic().Resource(kube_config_manager.ModuleConfigGVR).Namespace(s.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list %s objects: %s", kube_config_manager.ModuleConfigKind, err)
+	}
+
+	res := make(map[string]string)
+	for i := range list.Items {
+		if list.Items[i].GetName() == obj.GetName() {
+			continue
+		}
+		data, err := kube_config_manager.ModuleConfigToConfigData(&list.Items[i])
+		if err != nil {
+			continue
+		}
+		for key, value := range data {
+			res[key] = value
+		}
+	}
+	for key, value := range configData {
+		res[key] = value
+	}
+	return res, nil
+}
+
+// mergeSecretData adds values from the Secret to the config data.
+func (s *WebhookServer) mergeSecretData(configMapData map[string]string) (map[string]string, error) {
+	if s.SecretName == "" {
+		return configMapData, nil
+	}
+
+	obj, err := s.KubeClient.CoreV1().Secrets(s.Namespace).Get(s.SecretName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return configMapData, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get Secret/%s: %s", s.SecretName, err)
+	}
+
+	secretData := make(map[string]string, len(obj.Data))
+	for key, value := range obj.Data {
+		secretData[key] = string(value)
+	}
+	return kube_config_manager.MergeConfigData(configMapData, secretData)
+}
+
+func allowed() *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{Allowed: true}
+}
+
+func denied(message string) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: message,
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+		},
+	}
+}
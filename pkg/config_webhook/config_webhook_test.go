@@ -0,0 +1,143 @@
+package config_webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/flant/shell-operator/pkg/kube"
+
+	"github.com/flant/addon-operator/pkg/module_manager"
+)
+
+func newTestWebhookServer(t *testing.T) *WebhookServer {
+	g := NewWithT(t)
+
+	mm := module_manager.NewMainModuleManager()
+	mm.WithDirectories(filepath.Join("testdata", "modules"), filepath.Join("testdata", "global-hooks"), "")
+	g.Expect(mm.RegisterModules()).Should(Succeed())
+
+	kubeClient := kube.NewFakeKubernetesClient()
+	_, err := kubeClient.CoreV1().Secrets("default").Create(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "addon-operator"},
+		Data: map[string][]byte{
+			"moduleOne": []byte("password: secret\n"),
+		},
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	s := NewWebhookServer()
+	s.WithKubeClient(kubeClient)
+	s.WithNamespace("default")
+	s.WithConfigMapName("addon-operator")
+	s.WithSecretName("addon-operator")
+	s.WithValidator(mm)
+	return s
+}
+
+func sendReview(t *testing.T, client *http.Client, url string, fixture string) admissionv1.AdmissionReview {
+	g := NewWithT(t)
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", fixture))
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	resp, err := client.Post(url+ValidatePath, "application/json", bytes.NewReader(data))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	defer resp.Body.Close()
+	g.Expect(resp.StatusCode).Should(Equal(http.StatusOK))
+
+	review := admissionv1.AdmissionReview{}
+	g.Expect(json.NewDecoder(resp.Body).Decode(&review)).Should(Succeed())
+	g.Expect(review.Response).ShouldNot(BeNil())
+	return review
+}
+
+func TestWebhookServer(t *testing.T) {
+	g := NewWithT(t)
+
+	srv := httptest.NewTLSServer(newTestWebhookServer(t).Handler())
+	defer srv.Close()
+	client := srv.Client()
+
+	review := sendReview(t, client, srv.URL, "configmap-valid.json")
+	g.Expect(review.APIVersion).Should(Equal("admission.k8s.io/v1"))
+	g.Expect(string(review.Response.UID)).Should(Equal("uid-1"))
+	g.Expect(review.Response.Allowed).Should(BeTrue())
+
+	// All broken sections are reported.
+	review = sendReview(t, client, srv.URL, "configmap-invalid.json")
+	g.Expect(string(review.Response.UID)).Should(Equal("uid-2"))
+	g.Expect(review.Response.Allowed).Should(BeFalse())
+	msg := review.Response.Result.Message
+	g.Expect(msg).Should(ContainSubstring("section 'global': ConfigMap: bad yaml at key 'global'"))
+	g.Expect(msg).Should(ContainSubstring("section 'module-one':"))
+	g.Expect(msg).Should(ContainSubstring("moduleOne.param1"))
+	g.Expect(msg).Should(ContainSubstring("section 'module-two':"))
+	g.Expect(msg).Should(ContainSubstring("'moduleTwoEnabled' should have a boolean value"))
+
+	// Sections of disabled modules are not validated.
+	review = sendReview(t, client, srv.URL, "configmap-disabled-module.json")
+	g.Expect(review.APIVersion).Should(Equal("admission.k8s.io/v1beta1"))
+	g.Expect(review.Response.Allowed).Should(BeTrue())
+
+	// Other ConfigMaps are not validated.
+	review = sendReview(t, client, srv.URL, "configmap-other.json")
+	g.Expect(review.Response.Allowed).Should(BeTrue())
+
+	review = sendReview(t, client, srv.URL, "moduleconfig-invalid.json")
+	g.Expect(review.Response.Allowed).Should(BeFalse())
+	g.Expect(review.Response.Result.Message).Should(ContainSubstring("section 'module-one':"))
+
+	// A ModuleConfig has no global section, so required global values do not block its changes.
+	// The required password comes from the Secret.
+	review = sendReview(t, client, srv.URL, "moduleconfig-valid.json")
+	g.Expect(review.Response.Allowed).Should(BeTrue())
+
+	// Sections of unknown modules are not validated.
+	review = sendReview(t, client, srv.URL, "moduleconfig-unknown.json")
+	g.Expect(review.Response.Allowed).Should(BeTrue())
+
+	// Bad requests.
+	resp, err := client.Post(srv.URL+ValidatePath, "application/json", bytes.NewReader([]byte(`{"kind":"AdmissionReview"}`)))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	resp.Body.Close()
+	g.Expect(resp.StatusCode).Should(Equal(http.StatusBadRequest))
+}
+
+func TestWebhookServer_WithoutSecret(t *testing.T) {
+	g := NewWithT(t)
+
+	s := newTestWebhookServer(t)
+	s.WithSecretName("")
+	srv := httptest.NewTLSServer(s.Handler())
+	defer srv.Close()
+
+	review := sendReview(t, srv.Client(), srv.URL, "moduleconfig-valid.json")
+	g.Expect(review.Response.Allowed).Should(BeFalse())
+	g.Expect(review.Response.Result.Message).Should(ContainSubstring("password"))
+
+	review = sendReview(t, srv.Client(), srv.URL, "configmap-valid.json")
+	g.Expect(review.Response.Allowed).Should(BeFalse())
+	g.Expect(review.Response.Result.Message).Should(ContainSubstring("password"))
+}
+
+func TestWebhookServer_Delete(t *testing.T) {
+	g := NewWithT(t)
+
+	s := newTestWebhookServer(t)
+	resp := s.Review(&admissionv1.AdmissionRequest{
+		Operation: admissionv1.Delete,
+		Name:      "addon-operator",
+		Namespace: "default",
+	})
+	g.Expect(resp.Allowed).Should(BeTrue())
+}
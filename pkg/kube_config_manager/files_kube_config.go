@@ -0,0 +1,232 @@
+package kube_config_manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// FilesBackend stores values in a directory with YAML files.
+const FilesBackend = "Files"
+
+// ValuesFileExt is an extension of files with values.
+const ValuesFileExt = ".yaml"
+
+// DefaultFilesPollInterval is a period to check files for changes.
+var DefaultFilesPollInterval = 2 * time.Second
+
+// filesConfigManager reads values from a directory with YAML files. The directory has
+// the same layout as the ConfigMap data: a file per key, e.g.
+//
+//	global.yaml                # global values
+//	simpleModule.yaml          # values of the module 'simple-module'
+//	anotherModuleEnabled.yaml  # 'false' disables the module 'another-module'
+//
+// It is intended for local development: files are checked for changes periodically and
+// values saved by hooks are written back into files. Checksums of saved sections
+// are kept in memory.
+type filesConfigManager struct {
+	*kubeConfigManager
+
+	pollInterval time.Duration
+}
+
+// filesConfigManager should implement KubeConfigManager
+var _ KubeConfigManager = &filesConfigManager{}
+
+func NewFilesConfigManager() KubeConfigManager {
+	return &filesConfigManager{
+		kubeConfigManager: NewKubeConfigManager().(*kubeConfigManager),
+		pollInterval:      DefaultFilesPollInterval,
+	}
+}
+
+// ReadConfigDir returns ConfigMap data from files in the directory.
+// An empty data is returned if the directory does not exist.
+func ReadConfigDir(dir string) (map[string]string, error) {
+	res := make(map[string]string)
+
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read values directory '%s': %s", dir, err)
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ValuesFileExt) {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read values file '%s': %s", file.Name(), err)
+		}
+
+		key := strings.TrimSuffix(file.Name(), ValuesFileExt)
+		if strings.HasSuffix(key, "Enabled") {
+			res[key] = strings.TrimSpace(string(content))
+			continue
+		}
+		res[key] = string(content)
+	}
+
+	return res, nil
+}
+
+func (f *filesConfigManager) Init() error {
+	log.Debug("INIT: KUBE_CONFIG")
+
+	f.initVerboseDebug()
+
+	if f.ConfigDir == "" {
+		return fmt.Errorf("directory with values files is not set")
+	}
+
+	configData, err := ReadConfigDir(f.ConfigDir)
+	if err != nil {
+		return err
+	}
+	f.rememberConfigData(configData, make(map[string]string))
+
+	if len(configData) == 0 {
+		log.Infof("Init config from files: no values files in '%s'", f.ConfigDir)
+		return nil
+	}
+
+	return f.initConfigFromData(configData)
+}
+
+func (f *filesConfigManager) SetKubeGlobalValues(values utils.Values) error {
+	globalKubeConfig, err := GetGlobalKubeConfigFromValues(values)
+	if err != nil {
+		return err
+	}
+
+	if globalKubeConfig != nil {
+		log.Debugf("Kube config manager: set kube global values:\n%s", values.DebugString())
+
+		return f.saveConfigData(utils.GlobalValuesKey, globalKubeConfig.ConfigData, globalKubeConfig.Checksum)
+	}
+
+	return nil
+}
+
+func (f *filesConfigManager) SetKubeModuleValues(moduleName string, values utils.Values) error {
+	moduleKubeConfig, err := GetModuleKubeConfigFromValues(moduleName, values)
+	if err != nil {
+		return err
+	}
+
+	if moduleKubeConfig != nil {
+		log.Debugf("Kube config manager: set kube module values:\n%s", moduleKubeConfig.ModuleConfig.String())
+
+		return f.saveConfigData(moduleName, moduleKubeConfig.ConfigData, moduleKubeConfig.Checksum)
+	}
+
+	return nil
+}
+
+// saveConfigData writes keys of the section into files and remembers the checksum of the section.
+// Files are also checked in the Start goroutine, so saving is done under eventsLock.
+func (f *filesConfigManager) saveConfigData(section string, configData map[string]string, checksum string) error {
+	f.eventsLock.Lock()
+	defer f.eventsLock.Unlock()
+
+	err := os.MkdirAll(f.ConfigDir, 0755)
+	if err != nil {
+		return fmt.Errorf("create values directory '%s': %s", f.ConfigDir, err)
+	}
+
+	for key, value := range configData {
+		err := writeFileAtomically(filepath.Join(f.ConfigDir, key+ValuesFileExt), []byte(value))
+		if err != nil {
+			return fmt.Errorf("save values for '%s': %s", section, err)
+		}
+	}
+
+	data := make(map[string]string, len(f.configMapData)+len(configData))
+	for key, value := range f.configMapData {
+		data[key] = value
+	}
+	for key, value := range configData {
+		data[key] = value
+	}
+	checksums := make(map[string]string, len(f.configMapChecksums)+1)
+	for key, value := range f.configMapChecksums {
+		checksums[key] = value
+	}
+	checksums[section] = checksum
+
+	f.rememberConfigData(data, checksums)
+	return nil
+}
+
+// writeFileAtomically writes the content into a temporary file and renames it,
+// so readers never see a partially written file.
+func writeFileAtomically(path string, content []byte) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = tmpFile.Write(content)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
+
+// checkConfigDir reads files and handles changes if files are changed.
+func (f *filesConfigManager) checkConfigDir() error {
+	configData, err := ReadConfigDir(f.ConfigDir)
+	if err != nil {
+		return err
+	}
+	if sameConfigData(f.configMapData, configData) {
+		return nil
+	}
+
+	if f.verboseDebug {
+		log.Debugf("Kube config manager: values files in '%s' are changed", f.ConfigDir)
+	}
+	return f.handleNewConfigData(configData, f.configMapChecksums)
+}
+
+func sameConfigData(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if bValue, has := b[key]; !has || bValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *filesConfigManager) Start() {
+	log.Debugf("Run kube config manager for values files in '%s'", f.ConfigDir)
+
+	ticker := time.NewTicker(f.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			f.handleEvent("changes in values files", f.checkConfigDir)
+		case <-f.ctx.Done():
+			return
+		}
+	}
+}
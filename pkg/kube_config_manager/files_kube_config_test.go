@@ -0,0 +1,102 @@
+package kube_config_manager
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func TestFilesConfigManager(t *testing.T) {
+	g := NewWithT(t)
+
+	dir, err := ioutil.TempDir("", "values-files")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	writeFile := func(name string, content string) {
+		g.Expect(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)).Should(Succeed())
+	}
+	writeFile("global.yaml", "param1: val1\n")
+	writeFile("moduleOne.yaml", "host: db.local\n")
+	writeFile("moduleTwoEnabled.yaml", "false\n")
+	writeFile("README.md", "not a values file")
+
+	kcm, err := NewKubeConfigManagerWithBackend(FilesBackend)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	kcm.(*filesConfigManager).pollInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	kcm.WithContext(ctx)
+	kcm.WithConfigDir(dir)
+
+	err = kcm.Init()
+	g.Expect(err).ShouldNot(HaveOccurred(), "KubeConfigManager should init correctly")
+
+	config := kcm.InitialConfig()
+	g.Expect(config.Values).Should(Equal(utils.Values{"global": map[string]interface{}{"param1": "val1"}}))
+	g.Expect(config.ModuleConfigs).Should(HaveLen(2))
+	g.Expect(config.ModuleConfigs["module-one"].Values).Should(Equal(utils.Values{
+		"moduleOne": map[string]interface{}{"host": "db.local"},
+	}))
+	g.Expect(*config.ModuleConfigs["module-two"].IsEnabled).Should(BeFalse())
+
+	// Values are saved into the file of the section.
+	modVals, err := utils.NewValuesFromBytes([]byte(`
+moduleOne:
+  host: db.example.com
+`))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	err = kcm.SetKubeModuleValues("module-one", modVals)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "moduleOne.yaml"))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(string(content)).Should(Equal("host: db.example.com\n"))
+
+	go kcm.Start()
+
+	// Edited files are reported as changes.
+	writeFile("moduleTwoEnabled.yaml", "true\n")
+
+	var updated ModuleConfigs
+	g.Eventually(kcm.ModuleConfigsUpdated()).Should(Receive(&updated))
+	g.Expect(updated["module-two"].IsUpdated).Should(BeTrue())
+	g.Expect(*updated["module-two"].IsEnabled).Should(BeTrue())
+
+	// Removed files are reported as removed sections.
+	g.Expect(os.Remove(filepath.Join(dir, "global.yaml"))).Should(Succeed())
+
+	var newConfig Config
+	g.Eventually(kcm.ConfigUpdated()).Should(Receive(&newConfig))
+	g.Expect(newConfig.Values).Should(BeEmpty())
+	g.Expect(newConfig.ModuleConfigs).Should(HaveLen(2))
+}
+
+func TestFilesConfigManager_ConcurrentWrites(t *testing.T) {
+	g := NewWithT(t)
+
+	dir, err := ioutil.TempDir("", "values-files")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	kcm, err := NewKubeConfigManagerWithBackend(FilesBackend)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	kcm.(*filesConfigManager).pollInterval = time.Millisecond
+	kcm.WithContext(context.Background())
+	kcm.WithConfigDir(dir)
+	g.Expect(kcm.Init()).Should(Succeed(), "KubeConfigManager should init correctly")
+
+	testConcurrentWrites(t, kcm, func(i int) {
+		content := []byte(fmt.Sprintf("param1: val%d\n", i))
+		g.Expect(ioutil.WriteFile(filepath.Join(dir, "moduleTwo.yaml"), content, 0644)).Should(Succeed())
+		time.Sleep(2 * time.Millisecond)
+	})
+}
@@ -5,18 +5,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 
 	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	corev1 "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
 
 	"github.com/flant/shell-operator/pkg/kube"
+	"github.com/flant/shell-operator/pkg/metric_storage"
 
 	"github.com/flant/addon-operator/pkg/utils"
 )
@@ -26,7 +31,12 @@ type KubeConfigManager interface {
 	WithKubeClient(client kube.KubernetesClient)
 	WithNamespace(namespace string)
 	WithConfigMapName(configMap string)
+	WithConfigMapLayers(names []string)
 	WithValuesChecksumsAnnotation(annotation string)
+	WithSecretName(secretName string)
+	WithConfigDir(dir string)
+	WithMetricStorage(metricStorage *metric_storage.MetricStorage)
+	SetSensitivePaths(section string, paths [][]string)
 	SetKubeGlobalValues(values utils.Values) error
 	SetKubeModuleValues(moduleName string, values utils.Values) error
 	Init() error
@@ -34,6 +44,9 @@ type KubeConfigManager interface {
 	Stop()
 	InitialConfig() *Config
 	CurrentConfig() *Config
+	ConfigErrors() map[string]string
+	ConfigUpdated() chan Config
+	ModuleConfigsUpdated() chan ModuleConfigs
 }
 
 type kubeConfigManager struct {
@@ -44,10 +57,48 @@ type kubeConfigManager struct {
 	Namespace                 string
 	ConfigMapName             string
 	ValuesChecksumsAnnotation string
+	// Optional read-only ConfigMaps with values merged with the ConfigMapName in order.
+	ConfigMapLayers []string
+	// Optional Secret with sensitive values. It has the same layout as the ConfigMap.
+	SecretName string
+	// A directory with values files for the Files backend.
+	ConfigDir string
+
+	// Last known data of the ConfigMap and the Secret to merge them on changes.
+	configMapData      map[string]string
+	configMapChecksums map[string]string
+	secretData         map[string]string
+	// Data and checksums of ConfigMap layers by ConfigMap name.
+	layersData      map[string]map[string]string
+	layersChecksums map[string]map[string]string
+	// Handlers of informers events and writes of values from hooks are called one at a time.
+	// Both read and update the last known data above, so it is guarded by eventsLock after Init.
+	eventsLock sync.Mutex
+	// verboseDebug enables debug messages for informer events.
+	verboseDebug bool
+	// Last known ConfigErrorsAnnotation of the writable ConfigMap. It is guarded by eventsLock.
+	configErrorsAnnotation string
+	// Paths of sensitive values by section ('global' or module name). They are saved into the Secret.
+	sensitivePaths map[string][][]string
+
+	metricStorage *metric_storage.MetricStorage
+	// Errors of broken sections by section ('global' or module name). Last good values are used for these sections.
+	// Errors are read by the debug server, so access is guarded by configErrorsLock.
+	configErrors     map[string]string
+	configErrorsLock sync.Mutex
+	// Errors of sections that cannot be read from their source, e.g. a broken ModuleConfig object.
+	// Last good data of the source is kept, so these errors replace errors of parsing config data.
+	// They are guarded by eventsLock as the last known data.
+	sourceErrors map[string]error
 
 	initialConfig *Config
 	currentConfig *Config
 
+	// configUpdated receives a new Config when global values are changed.
+	configUpdated chan Config
+	// moduleConfigsUpdated receives a list of all ModuleConfig in configData. Updated items marked as IsUpdated.
+	moduleConfigsUpdated chan ModuleConfigs
+
 	GlobalValuesChecksum  string
 	ModulesValuesChecksum map[string]string
 }
@@ -77,13 +128,16 @@ func NewConfig() *Config {
 	}
 }
 
-var (
-	VerboseDebug bool
-	// ConfigUpdated chan receives a new Config when global values are changed
-	ConfigUpdated chan Config
-	// ModuleConfigsUpdated chan receives a list of all ModuleConfig in configData. Updated items marked as IsUpdated.
-	ModuleConfigsUpdated chan ModuleConfigs
-)
+// ConfigErrorsAnnotation contains errors of broken sections in the ConfigMap as a JSON object.
+const ConfigErrorsAnnotation = "addon-operator/config-errors"
+
+// ConflictRetry is a backoff to retry writes of the ConfigMap and the Secret on conflicts.
+var ConflictRetry = retry.DefaultRetry
+
+// IsConflict returns true if the object was changed or created concurrently.
+func IsConflict(err error) bool {
+	return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+}
 
 func simpleMergeConfigMapData(data map[string]string, newData map[string]string) map[string]string {
 	for k, v := range newData {
@@ -107,6 +161,11 @@ func (kcm *kubeConfigManager) WithKubeClient(client kube.KubernetesClient) {
 }
 
 func (kcm *kubeConfigManager) saveGlobalKubeConfig(globalKubeConfig GlobalKubeConfig) error {
+	configData, err := kcm.writableConfigData(utils.GlobalValuesKey, utils.GlobalValuesKey, globalKubeConfig.Values[utils.GlobalValuesKey], globalKubeConfig.ConfigData)
+	if err != nil {
+		return err
+	}
+
 	return kcm.changeOrCreateKubeConfig(func(obj *v1.ConfigMap) error {
 		checksums, err := kcm.getValuesChecksums(obj)
 		if err != nil {
@@ -120,13 +179,19 @@ func (kcm *kubeConfigManager) saveGlobalKubeConfig(globalKubeConfig GlobalKubeCo
 			return fmt.Errorf("update global values checksum in annotation: %s", err)
 		}
 
-		obj.Data = simpleMergeConfigMapData(obj.Data, globalKubeConfig.ConfigData)
+		obj.Data = simpleMergeConfigMapData(obj.Data, configData)
 
 		return nil
 	})
 }
 
 func (kcm *kubeConfigManager) saveModuleKubeConfig(moduleKubeConfig ModuleKubeConfig) error {
+	key := utils.ModuleNameToValuesKey(moduleKubeConfig.ModuleName)
+	configData, err := kcm.writableConfigData(moduleKubeConfig.ModuleName, key, moduleKubeConfig.Values[key], moduleKubeConfig.ConfigData)
+	if err != nil {
+		return err
+	}
+
 	return kcm.changeOrCreateKubeConfig(func(obj *v1.ConfigMap) error {
 		checksums, err := kcm.getValuesChecksums(obj)
 		if err != nil {
@@ -140,38 +205,62 @@ func (kcm *kubeConfigManager) saveModuleKubeConfig(moduleKubeConfig ModuleKubeCo
 			return fmt.Errorf("update module '%s' values checksum in annotation: %s", moduleKubeConfig.ModuleName, err)
 		}
 
-		obj.Data = simpleMergeConfigMapData(obj.Data, moduleKubeConfig.ConfigData)
+		obj.Data = simpleMergeConfigMapData(obj.Data, configData)
 
 		return nil
 	})
 }
 
-func (kcm *kubeConfigManager) changeOrCreateKubeConfig(configChangeFunc func(*v1.ConfigMap) error) error {
-	var err error
-
-	obj, err := kcm.getConfigMap()
-	if err != nil {
-		return nil
+// writableConfigData returns data to save into the writable ConfigMap for the section.
+// Values defined in read-only layers are omitted and sensitive values are saved into the Secret.
+// configData is a dump of values for the section.
+func (kcm *kubeConfigManager) writableConfigData(section string, key string, values interface{}, configData map[string]string) (map[string]string, error) {
+	if len(kcm.layerNames()) > 1 {
+		values = kcm.writableLayerValues(key, values)
+		dump, err := yaml.Marshal(values)
+		if err != nil {
+			return nil, fmt.Errorf("dump values for '%s': %s", section, err)
+		}
+		configData = map[string]string{key: string(dump)}
 	}
 
-	if obj != nil {
-		if obj.Data == nil {
-			obj.Data = make(map[string]string)
-		}
+	if kcm.SecretName != "" {
+		return kcm.saveSensitiveValues(section, key, values)
+	}
+	return configData, nil
+}
 
-		err = configChangeFunc(obj)
+// changeOrCreateKubeConfig applies configChangeFunc to the actual ConfigMap and saves it.
+// Update is done with the resourceVersion of the read object, so concurrent changes
+// are not overwritten: on conflict the ConfigMap is read again and configChangeFunc
+// is re-applied. configChangeFunc should change only the section being saved.
+func (kcm *kubeConfigManager) changeOrCreateKubeConfig(configChangeFunc func(*v1.ConfigMap) error) error {
+	return retry.OnError(ConflictRetry, IsConflict, func() error {
+		obj, err := kcm.getConfigMap()
 		if err != nil {
-			return err
+			return fmt.Errorf("get ConfigMap/%s: %s", kcm.ConfigMapName, err)
 		}
 
-		_, err := kcm.KubeClient.CoreV1().ConfigMaps(kcm.Namespace).Update(obj)
-		if err != nil {
-			return err
+		if obj != nil {
+			if obj.Data == nil {
+				obj.Data = make(map[string]string)
+			}
+
+			err = configChangeFunc(obj)
+			if err != nil {
+				return err
+			}
+
+			obj, err = kcm.KubeClient.CoreV1().ConfigMaps(kcm.Namespace).Update(obj)
+			if err != nil {
+				return err
+			}
+
+			kcm.rememberConfigMap(obj)
+			return nil
 		}
 
-		return nil
-	} else {
-		obj := &v1.ConfigMap{}
+		obj = &v1.ConfigMap{}
 		obj.Name = kcm.ConfigMapName
 		obj.Data = make(map[string]string)
 
@@ -180,13 +269,14 @@ func (kcm *kubeConfigManager) changeOrCreateKubeConfig(configChangeFunc func(*v1
 			return err
 		}
 
-		_, err := kcm.KubeClient.CoreV1().ConfigMaps(kcm.Namespace).Create(obj)
+		obj, err = kcm.KubeClient.CoreV1().ConfigMaps(kcm.Namespace).Create(obj)
 		if err != nil {
 			return err
 		}
 
+		kcm.rememberConfigMap(obj)
 		return nil
-	}
+	})
 }
 
 func (kcm *kubeConfigManager) WithNamespace(namespace string) {
@@ -201,6 +291,47 @@ func (kcm *kubeConfigManager) WithValuesChecksumsAnnotation(annotation string) {
 	kcm.ValuesChecksumsAnnotation = annotation
 }
 
+func (kcm *kubeConfigManager) WithSecretName(secretName string) {
+	kcm.SecretName = secretName
+}
+
+func (kcm *kubeConfigManager) WithConfigDir(dir string) {
+	kcm.ConfigDir = dir
+}
+
+func (kcm *kubeConfigManager) WithMetricStorage(metricStorage *metric_storage.MetricStorage) {
+	kcm.metricStorage = metricStorage
+}
+
+// SetSensitivePaths sets paths of values in the section that are saved into the Secret.
+func (kcm *kubeConfigManager) SetSensitivePaths(section string, paths [][]string) {
+	kcm.sensitivePaths[section] = paths
+}
+
+// rememberConfigMap saves data and checksums of the ConfigMap to merge it with other layers and the Secret later.
+func (kcm *kubeConfigManager) rememberConfigMap(obj *v1.ConfigMap) {
+	checksums, err := kcm.getValuesChecksums(obj)
+	if err != nil {
+		log.Errorf("Kube config manager: %s", err)
+		checksums = make(map[string]string)
+	}
+	kcm.rememberLayer(obj, checksums)
+}
+
+// rememberConfigData saves config data and checksums of sections saved by the Addon-operator.
+func (kcm *kubeConfigManager) rememberConfigData(data map[string]string, checksums map[string]string) {
+	kcm.configMapData = data
+	kcm.configMapChecksums = checksums
+}
+
+// configData returns ConfigMap data with sections from the Secret merged over them.
+func (kcm *kubeConfigManager) configData() (map[string]string, error) {
+	if len(kcm.secretData) == 0 {
+		return kcm.configMapData, nil
+	}
+	return MergeConfigData(kcm.configMapData, kcm.secretData)
+}
+
 func (kcm *kubeConfigManager) SetKubeGlobalValues(values utils.Values) error {
 	globalKubeConfig, err := GetGlobalKubeConfigFromValues(values)
 	if err != nil {
@@ -210,6 +341,9 @@ func (kcm *kubeConfigManager) SetKubeGlobalValues(values utils.Values) error {
 	if globalKubeConfig != nil {
 		log.Debugf("Kube config manager: set kube global values:\n%s", values.DebugString())
 
+		kcm.eventsLock.Lock()
+		defer kcm.eventsLock.Unlock()
+
 		err := kcm.saveGlobalKubeConfig(*globalKubeConfig)
 		if err != nil {
 			return err
@@ -228,6 +362,9 @@ func (kcm *kubeConfigManager) SetKubeModuleValues(moduleName string, values util
 	if moduleKubeConfig != nil {
 		log.Debugf("Kube config manager: set kube module values:\n%s", moduleKubeConfig.ModuleConfig.String())
 
+		kcm.eventsLock.Lock()
+		defer kcm.eventsLock.Unlock()
+
 		err := kcm.saveModuleKubeConfig(*moduleKubeConfig)
 		if err != nil {
 			return err
@@ -237,34 +374,25 @@ func (kcm *kubeConfigManager) SetKubeModuleValues(moduleName string, values util
 	return nil
 }
 
+// getConfigMap returns the writable ConfigMap or nil if it is not created.
 func (kcm *kubeConfigManager) getConfigMap() (*v1.ConfigMap, error) {
-	list, err := kcm.KubeClient.CoreV1().
+	return kcm.getLayerConfigMap(kcm.ConfigMapName)
+}
+
+// getLayerConfigMap returns the ConfigMap or nil if it is not created.
+func (kcm *kubeConfigManager) getLayerConfigMap(name string) (*v1.ConfigMap, error) {
+	obj, err := kcm.KubeClient.CoreV1().
 		ConfigMaps(kcm.Namespace).
-		List(metav1.ListOptions{})
+		Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		log.Debugf("KUBE_CONFIG_MANAGER: ConfigMap/%s is not created", name)
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	objExists := false
-	for _, obj := range list.Items {
-		if obj.ObjectMeta.Name == kcm.ConfigMapName {
-			objExists = true
-			break
-		}
-	}
-
-	if objExists {
-		obj, err := kcm.KubeClient.CoreV1().
-			ConfigMaps(kcm.Namespace).
-			Get(kcm.ConfigMapName, metav1.GetOptions{})
-		if err != nil {
-			return nil, err
-		}
-		log.Debugf("KUBE_CONFIG_MANAGER: Will use ConfigMap/%s for persistent values", kcm.ConfigMapName)
-		return obj, nil
-	} else {
-		log.Debugf("KUBE_CONFIG_MANAGER: ConfigMap/%s is not created", kcm.ConfigMapName)
-		return nil, nil
-	}
+	log.Debugf("KUBE_CONFIG_MANAGER: Will use ConfigMap/%s for persistent values", name)
+	return obj, nil
 }
 
 func (kcm *kubeConfigManager) InitialConfig() *Config {
@@ -275,29 +403,124 @@ func (kcm *kubeConfigManager) CurrentConfig() *Config {
 	return kcm.currentConfig
 }
 
+// ConfigErrors returns errors of broken sections by section: 'global' or a module name.
+func (kcm *kubeConfigManager) ConfigErrors() map[string]string {
+	kcm.configErrorsLock.Lock()
+	defer kcm.configErrorsLock.Unlock()
+	res := make(map[string]string, len(kcm.configErrors))
+	for section, err := range kcm.configErrors {
+		res[section] = err
+	}
+	return res
+}
+
+// setConfigError saves the error of the section or removes it if err is nil.
+func (kcm *kubeConfigManager) setConfigError(section string, err error) {
+	kcm.configErrorsLock.Lock()
+	defer kcm.configErrorsLock.Unlock()
+
+	labels := map[string]string{"section": section}
+	if err == nil {
+		if _, has := kcm.configErrors[section]; has {
+			log.Infof("Kube config manager: section '%s' is fixed", section)
+			delete(kcm.configErrors, section)
+			kcm.metricStorage.GaugeSet("{PREFIX}config_section_errors", 0.0, labels)
+		}
+		return
+	}
+
+	log.Errorf("Kube config manager: section '%s' is ignored, last good values are used: %s", section, err)
+	kcm.configErrors[section] = err.Error()
+	kcm.metricStorage.GaugeSet("{PREFIX}config_section_errors", 1.0, labels)
+}
+
+// extractModuleKubeConfig returns the config of the module section. An error is reported
+// and false is returned if the section is broken, so other sections are not blocked.
+func (kcm *kubeConfigManager) extractModuleKubeConfig(moduleName string, configData map[string]string) (*ModuleKubeConfig, bool) {
+	moduleKubeConfig, err := ExtractModuleKubeConfig(moduleName, configData)
+	if sourceErr, has := kcm.sourceErrors[moduleName]; has {
+		err = sourceErr
+	}
+	kcm.setConfigError(moduleName, err)
+	return moduleKubeConfig, err == nil
+}
+
+// setSourceError saves the error of the section source and reports it or removes it if err is nil.
+func (kcm *kubeConfigManager) setSourceError(section string, err error) {
+	if err == nil {
+		delete(kcm.sourceErrors, section)
+		return
+	}
+	kcm.sourceErrors[section] = err
+	kcm.setConfigError(section, err)
+}
+
+// forgetRemovedSectionsErrors removes errors for sections that are not in config data anymore.
+// Errors of broken sources are kept: a broken source may have no data.
+func (kcm *kubeConfigManager) forgetRemovedSectionsErrors(modulesNames map[string]bool) {
+	for section := range kcm.ConfigErrors() {
+		if _, has := kcm.sourceErrors[section]; has {
+			continue
+		}
+		if section == utils.GlobalValuesKey || modulesNames[section] {
+			continue
+		}
+		kcm.setConfigError(section, nil)
+	}
+}
+
 func NewKubeConfigManager() KubeConfigManager {
 	kcm := &kubeConfigManager{}
+	kcm.sensitivePaths = make(map[string][][]string)
+	kcm.configErrors = make(map[string]string)
+	kcm.sourceErrors = make(map[string]error)
+	kcm.ModulesValuesChecksum = make(map[string]string)
 	kcm.initialConfig = NewConfig()
 	kcm.currentConfig = NewConfig()
+	kcm.configUpdated = make(chan Config, 1)
+	kcm.moduleConfigsUpdated = make(chan ModuleConfigs, 1)
 	return kcm
 }
 
 func (kcm *kubeConfigManager) initConfig() error {
-	obj, err := kcm.getConfigMap()
+	hasConfigMaps := false
+	for _, name := range kcm.layerNames() {
+		obj, err := kcm.getLayerConfigMap(name)
+		if err != nil {
+			return err
+		}
+		if obj != nil {
+			kcm.rememberConfigMap(obj)
+			hasConfigMaps = true
+		}
+	}
+
+	var err error
+	kcm.secretData, err = kcm.getSecretData()
 	if err != nil {
 		return err
 	}
 
-	if obj == nil {
-		log.Infof("Init config from ConfigMap: cm/%s is not found", kcm.ConfigMapName)
+	if !hasConfigMaps && len(kcm.secretData) == 0 {
+		log.Infof("Init config from ConfigMap: cm/%s is not found", strings.Join(kcm.layerNames(), ", cm/"))
 		return nil
 	}
 
+	configData, err := kcm.configData()
+	if err != nil {
+		return err
+	}
+
+	return kcm.initConfigFromData(configData)
+}
+
+// initConfigFromData sets initial config and checksums of sections from config data.
+func (kcm *kubeConfigManager) initConfigFromData(configData map[string]string) error {
 	initialConfig := NewConfig()
 	globalValuesChecksum := ""
 	modulesValuesChecksum := make(map[string]string)
 
-	globalKubeConfig, err := GetGlobalKubeConfigFromConfigData(obj.Data)
+	globalKubeConfig, err := GetGlobalKubeConfigFromConfigData(configData)
 	if err != nil {
 		return err
 	}
@@ -306,11 +529,11 @@ func (kcm *kubeConfigManager) initConfig() error {
 		globalValuesChecksum = globalKubeConfig.Checksum
 	}
 
-	for moduleName := range GetModulesNamesFromConfigData(obj.Data) {
-		// all GetModulesNamesFromConfigData must exist
-		moduleKubeConfig, err := ExtractModuleKubeConfig(moduleName, obj.Data)
-		if err != nil {
-			return err
+	for moduleName := range GetModulesNamesFromConfigData(configData) {
+		// A broken section is reported and skipped, so other modules start with their values.
+		moduleKubeConfig, ok := kcm.extractModuleKubeConfig(moduleName, configData)
+		if !ok {
+			continue
 		}
 
 		initialConfig.ModuleConfigs[moduleKubeConfig.ModuleName] = moduleKubeConfig.ModuleConfig
@@ -325,16 +548,36 @@ func (kcm *kubeConfigManager) initConfig() error {
 	return nil
 }
 
-func (kcm *kubeConfigManager) Init() error {
-	log.Debug("INIT: KUBE_CONFIG")
+// ParseConfigData returns a config from config data and errors of broken sections
+// by section ('global' or module name). Broken sections are not added to the config.
+func ParseConfigData(configData map[string]string) (*Config, map[string]string) {
+	config := NewConfig()
+	errors := make(map[string]string)
 
-	VerboseDebug = false
-	if os.Getenv("KUBE_CONFIG_MANAGER_DEBUG") != "" {
-		VerboseDebug = true
+	globalKubeConfig, err := GetGlobalKubeConfigFromConfigData(configData)
+	if err != nil {
+		errors[utils.GlobalValuesKey] = err.Error()
+	}
+	if globalKubeConfig != nil {
+		config.Values = globalKubeConfig.Values
 	}
 
-	ConfigUpdated = make(chan Config, 1)
-	ModuleConfigsUpdated = make(chan ModuleConfigs, 1)
+	for moduleName := range GetModulesNamesFromConfigData(configData) {
+		moduleKubeConfig, err := ExtractModuleKubeConfig(moduleName, configData)
+		if err != nil {
+			errors[moduleName] = err.Error()
+			continue
+		}
+		config.ModuleConfigs[moduleKubeConfig.ModuleName] = moduleKubeConfig.ModuleConfig
+	}
+
+	return config, errors
+}
+
+func (kcm *kubeConfigManager) Init() error {
+	log.Debug("INIT: KUBE_CONFIG")
+
+	kcm.initVerboseDebug()
 
 	err := kcm.initConfig()
 	if err != nil {
@@ -344,6 +587,22 @@ func (kcm *kubeConfigManager) Init() error {
 	return nil
 }
 
+// initVerboseDebug enables debug messages for informer events. It is shared by all config backends.
+func (kcm *kubeConfigManager) initVerboseDebug() {
+	kcm.verboseDebug = os.Getenv("KUBE_CONFIG_MANAGER_DEBUG") != ""
+}
+
+// ConfigUpdated returns a channel that receives a new Config when global values are changed.
+func (kcm *kubeConfigManager) ConfigUpdated() chan Config {
+	return kcm.configUpdated
+}
+
+// ModuleConfigsUpdated returns a channel that receives a list of all ModuleConfig in config data
+// when module sections are changed. Updated items are marked as IsUpdated.
+func (kcm *kubeConfigManager) ModuleConfigsUpdated() chan ModuleConfigs {
+	return kcm.moduleConfigsUpdated
+}
+
 func (kcm *kubeConfigManager) getValuesChecksums(cm *v1.ConfigMap) (map[string]string, error) {
 	data, hasKey := cm.Annotations[kcm.ValuesChecksumsAnnotation]
 	if !hasKey {
@@ -381,21 +640,76 @@ func (kcm *kubeConfigManager) setValuesChecksums(cm *v1.ConfigMap, checksums map
 // Array of actual ModuleConfig is send over ModuleConfigsUpdated channel
 // if module sections are changed or deleted.
 func (kcm *kubeConfigManager) handleNewCm(obj *v1.ConfigMap) error {
-	savedChecksums, err := kcm.getValuesChecksums(obj)
+	if _, err := kcm.getValuesChecksums(obj); err != nil {
+		return err
+	}
+	kcm.rememberConfigMap(obj)
+	err := kcm.handleConfigDataChanges()
 	if err != nil {
 		return err
 	}
+	return kcm.saveConfigErrors()
+}
 
-	globalKubeConfig, err := GetGlobalKubeConfigFromConfigData(obj.Data)
+// saveConfigErrors puts errors of broken sections into the ConfigErrorsAnnotation
+// of the writable ConfigMap. The ConfigMap is updated only if errors are changed.
+func (kcm *kubeConfigManager) saveConfigErrors() error {
+	configErrors := ""
+	if errors := kcm.ConfigErrors(); len(errors) > 0 {
+		data, err := json.Marshal(errors)
+		if err != nil {
+			return err
+		}
+		configErrors = string(data)
+	}
+	if kcm.configErrorsAnnotation == configErrors {
+		return nil
+	}
+
+	return kcm.changeOrCreateKubeConfig(func(obj *v1.ConfigMap) error {
+		if configErrors == "" {
+			delete(obj.Annotations, ConfigErrorsAnnotation)
+			return nil
+		}
+		if obj.Annotations == nil {
+			obj.Annotations = make(map[string]string)
+		}
+		obj.Annotations[ConfigErrorsAnnotation] = configErrors
+		return nil
+	})
+}
+
+// handleNewConfigData determine changes in config data from other backends.
+// checksums are checksums of sections saved by the Addon-operator.
+func (kcm *kubeConfigManager) handleNewConfigData(data map[string]string, checksums map[string]string) error {
+	kcm.rememberConfigData(data, checksums)
+	return kcm.handleConfigDataChanges()
+}
+
+// handleConfigDataChanges determine changes in ConfigMap data merged with the Secret data.
+func (kcm *kubeConfigManager) handleConfigDataChanges() error {
+	savedChecksums := kcm.configMapChecksums
+	configData, err := kcm.configData()
 	if err != nil {
 		return err
 	}
 
+	// A broken global section is reported and treated as unchanged.
+	globalKubeConfig, err := GetGlobalKubeConfigFromConfigData(configData)
+	if sourceErr, has := kcm.sourceErrors[utils.GlobalValuesKey]; has {
+		err = sourceErr
+	}
+	kcm.setConfigError(utils.GlobalValuesKey, err)
+	isGlobalBroken := err != nil
+
+	actualModulesNames := GetModulesNamesFromConfigData(configData)
+	kcm.forgetRemovedSectionsErrors(actualModulesNames)
+
 	// if global values are changed or deleted then new config should be sent over ConfigUpdated channel
-	isGlobalUpdated := globalKubeConfig != nil &&
+	isGlobalUpdated := !isGlobalBroken && globalKubeConfig != nil &&
 		globalKubeConfig.Checksum != savedChecksums[utils.GlobalValuesKey] &&
 		globalKubeConfig.Checksum != kcm.GlobalValuesChecksum
-	isGlobalDeleted := globalKubeConfig == nil && kcm.GlobalValuesChecksum != ""
+	isGlobalDeleted := !isGlobalBroken && globalKubeConfig == nil && kcm.GlobalValuesChecksum != ""
 
 	if isGlobalUpdated || isGlobalDeleted {
 		log.Infof("Kube config manager: detect changes in global section")
@@ -411,11 +725,15 @@ func (kcm *kubeConfigManager) handleNewCm(obj *v1.ConfigMap) error {
 
 		// calculate new checksums of a module sections
 		newModulesValuesChecksum := make(map[string]string)
-		for moduleName := range GetModulesNamesFromConfigData(obj.Data) {
-			// all GetModulesNamesFromConfigData must exist
-			moduleKubeConfig, err := ExtractModuleKubeConfig(moduleName, obj.Data)
-			if err != nil {
-				return err
+		for moduleName := range actualModulesNames {
+			moduleKubeConfig, ok := kcm.extractModuleKubeConfig(moduleName, configData)
+			if !ok {
+				// Keep last good values of the broken section.
+				if lastGoodConfig, has := kcm.currentConfig.ModuleConfigs[moduleName]; has {
+					newConfig.ModuleConfigs[moduleName] = lastGoodConfig
+					newModulesValuesChecksum[moduleName] = kcm.ModulesValuesChecksum[moduleName]
+				}
+				continue
 			}
 
 			newConfig.ModuleConfigs[moduleKubeConfig.ModuleName] = moduleKubeConfig.ModuleConfig
@@ -429,12 +747,10 @@ func (kcm *kubeConfigManager) handleNewCm(obj *v1.ConfigMap) error {
 			log.Debugf("%s", moduleConfig.String())
 		}
 
-		ConfigUpdated <- *newConfig
+		kcm.configUpdated <- *newConfig
 
 		kcm.currentConfig = newConfig
 	} else {
-		actualModulesNames := GetModulesNamesFromConfigData(obj.Data)
-
 		moduleConfigsActual := make(ModuleConfigs)
 		updatedCount := 0
 		removedCount := 0
@@ -442,10 +758,14 @@ func (kcm *kubeConfigManager) handleNewCm(obj *v1.ConfigMap) error {
 		// create ModuleConfig for each module in configData
 		// IsUpdated flag set for updated configs
 		for moduleName := range actualModulesNames {
-			// all GetModulesNamesFromConfigData must exist
-			moduleKubeConfig, err := ExtractModuleKubeConfig(moduleName, obj.Data)
-			if err != nil {
-				return err
+			moduleKubeConfig, ok := kcm.extractModuleKubeConfig(moduleName, configData)
+			if !ok {
+				// Keep last good values of the broken section.
+				if lastGoodConfig, has := kcm.currentConfig.ModuleConfigs[moduleName]; has {
+					lastGoodConfig.IsUpdated = false
+					moduleConfigsActual[moduleName] = lastGoodConfig
+				}
+				continue
 			}
 
 			if moduleKubeConfig.Checksum != savedChecksums[moduleName] && moduleKubeConfig.Checksum != kcm.ModulesValuesChecksum[moduleName] {
@@ -472,7 +792,7 @@ func (kcm *kubeConfigManager) handleNewCm(obj *v1.ConfigMap) error {
 			for _, moduleConfig := range moduleConfigsActual {
 				log.Debugf("%s", moduleConfig.String())
 			}
-			ModuleConfigsUpdated <- moduleConfigsActual
+			kcm.moduleConfigsUpdated <- moduleConfigsActual
 			kcm.currentConfig.ModuleConfigs = moduleConfigsActual
 		}
 	}
@@ -480,9 +800,26 @@ func (kcm *kubeConfigManager) handleNewCm(obj *v1.ConfigMap) error {
 	return nil
 }
 
+// redactConfigMap returns a copy of the ConfigMap with redacted sensitive values for debug logs.
+func redactConfigMap(obj *v1.ConfigMap) *v1.ConfigMap {
+	res := obj.DeepCopy()
+	for key, sectionYaml := range obj.Data {
+		var section interface{}
+		if err := yaml.Unmarshal([]byte(sectionYaml), &section); err != nil {
+			continue
+		}
+		dump, err := yaml.Marshal(utils.RedactValue([]string{key}, section))
+		if err != nil {
+			continue
+		}
+		res.Data[key] = string(dump)
+	}
+	return res
+}
+
 func (kcm *kubeConfigManager) handleCmAdd(obj *v1.ConfigMap) error {
-	if VerboseDebug {
-		objYaml, err := yaml.Marshal(obj)
+	if kcm.verboseDebug {
+		objYaml, err := yaml.Marshal(redactConfigMap(obj))
 		if err != nil {
 			return err
 		}
@@ -493,8 +830,8 @@ func (kcm *kubeConfigManager) handleCmAdd(obj *v1.ConfigMap) error {
 }
 
 func (kcm *kubeConfigManager) handleCmUpdate(_ *v1.ConfigMap, obj *v1.ConfigMap) error {
-	if VerboseDebug {
-		objYaml, err := yaml.Marshal(obj)
+	if kcm.verboseDebug {
+		objYaml, err := yaml.Marshal(redactConfigMap(obj))
 		if err != nil {
 			return err
 		}
@@ -505,19 +842,28 @@ func (kcm *kubeConfigManager) handleCmUpdate(_ *v1.ConfigMap, obj *v1.ConfigMap)
 }
 
 func (kcm *kubeConfigManager) handleCmDelete(obj *v1.ConfigMap) error {
-	if VerboseDebug {
-		objYaml, err := yaml.Marshal(obj)
+	if kcm.verboseDebug {
+		objYaml, err := yaml.Marshal(redactConfigMap(obj))
 		if err != nil {
 			return err
 		}
 		log.Debugf("Kube config manager: handle ConfigMap '%s' delete:\n%s", obj.Name, objYaml)
 	}
 
+	// Values from other layers and from the Secret are still actual.
+	kcm.forgetLayer(obj.Name)
+	if len(kcm.configMapData) > 0 || len(kcm.secretData) > 0 {
+		return kcm.handleConfigDataChanges()
+	}
+
+	kcm.setConfigError(utils.GlobalValuesKey, nil)
+	kcm.forgetRemovedSectionsErrors(nil)
+
 	if kcm.GlobalValuesChecksum != "" {
 		kcm.GlobalValuesChecksum = ""
 		kcm.ModulesValuesChecksum = make(map[string]string)
 
-		ConfigUpdated <- Config{
+		kcm.configUpdated <- Config{
 			Values:        make(utils.Values),
 			ModuleConfigs: make(map[string]utils.ModuleConfig),
 		}
@@ -541,7 +887,7 @@ func (kcm *kubeConfigManager) handleCmDelete(obj *v1.ConfigMap) error {
 			}
 		}
 
-		ModuleConfigsUpdated <- moduleConfigsUpdate
+		kcm.moduleConfigsUpdated <- moduleConfigsUpdate
 	}
 
 	return nil
@@ -556,32 +902,59 @@ func (kcm *kubeConfigManager) Start() {
 	// define indexers for informer
 	indexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
 
-	// define tweakListOptions for informer
-	tweakListOptions := func(options *metav1.ListOptions) {
-		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", kcm.ConfigMapName).String()
+	// A field selector matches only one name, so each layer has its own informer.
+	for _, name := range kcm.layerNames() {
+		cmInformer := corev1.NewFilteredConfigMapInformer(kcm.KubeClient, kcm.Namespace, resyncPeriod, indexers, nameFieldSelector(name))
+		cmInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				kcm.handleEvent("ConfigMap add", func() error {
+					return kcm.handleCmAdd(obj.(*v1.ConfigMap))
+				})
+			},
+			UpdateFunc: func(prevObj interface{}, obj interface{}) {
+				kcm.handleEvent("ConfigMap update", func() error {
+					return kcm.handleCmUpdate(prevObj.(*v1.ConfigMap), obj.(*v1.ConfigMap))
+				})
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				cm, ok := obj.(*v1.ConfigMap)
+				if !ok {
+					return
+				}
+				kcm.handleEvent("ConfigMap delete", func() error {
+					return kcm.handleCmDelete(cm)
+				})
+			},
+		})
+		go cmInformer.Run(kcm.ctx.Done())
+	}
+
+	if kcm.SecretName != "" {
+		kcm.runSecretInformer(resyncPeriod, indexers)
+	}
+
+	<-kcm.ctx.Done()
+}
+
+// nameFieldSelector returns tweakListOptions for an informer that watches one object.
+func nameFieldSelector(name string) func(options *metav1.ListOptions) {
+	return func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
 	}
+}
 
-	cmInformer := corev1.NewFilteredConfigMapInformer(kcm.KubeClient, kcm.Namespace, resyncPeriod, indexers, tweakListOptions)
-	cmInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			err := kcm.handleCmAdd(obj.(*v1.ConfigMap))
-			if err != nil {
-				log.Errorf("Kube config manager: cannot handle ConfigMap add: %s", err)
-			}
-		},
-		UpdateFunc: func(prevObj interface{}, obj interface{}) {
-			err := kcm.handleCmUpdate(prevObj.(*v1.ConfigMap), obj.(*v1.ConfigMap))
-			if err != nil {
-				log.Errorf("Kube config manager: cannot handle ConfigMap update: %s", err)
-			}
-		},
-		DeleteFunc: func(obj interface{}) {
-			err := kcm.handleCmDelete(obj.(*v1.ConfigMap))
-			if err != nil {
-				log.Errorf("Kube config manager: cannot handle ConfigMap delete: %s", err)
-			}
-		},
-	})
+// handleEvent runs the handler of an informer event and logs its error. Informers for layers
+// and for the Secret run in separate goroutines and values are saved from hooks,
+// so events are handled one at a time and not during saving.
+func (kcm *kubeConfigManager) handleEvent(event string, handler func() error) {
+	kcm.eventsLock.Lock()
+	defer kcm.eventsLock.Unlock()
 
-	cmInformer.Run(kcm.ctx.Done())
+	err := handler()
+	if err != nil {
+		log.Errorf("Kube config manager: cannot handle %s: %s", event, err)
+	}
 }
@@ -2,6 +2,8 @@ package kube_config_manager
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"sync"
 	"testing"
 
@@ -11,7 +13,13 @@ import (
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v3"
 	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/retry"
 
 	"github.com/flant/shell-operator/pkg/kube"
 
@@ -302,7 +310,7 @@ param2: val2
 	wg.Add(1)
 
 	go func() {
-		newModuleConfigs = <-ModuleConfigsUpdated
+		newModuleConfigs = <-kcm.ModuleConfigsUpdated()
 		wg.Done()
 	}()
 
@@ -381,3 +389,512 @@ moduleLongName:
 	g.Expect(anno).To(ContainSubstring("module-long-name"))
 	g.Expect(anno).To(ContainSubstring("module1"))
 }
+
+// Values from the Secret override values from the ConfigMap,
+// sensitive values are saved into the Secret.
+func TestKubeConfigManager_Secret(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := kube.NewFakeKubernetesClient()
+
+	cm := &v1.ConfigMap{}
+	cm.SetNamespace("default")
+	cm.SetName(app.ConfigMapName)
+	cm.Data = map[string]string{
+		"global": `
+param1: val1
+`,
+		"moduleOne": `
+host: db.local
+user: admin
+`,
+	}
+	_, err := kubeClient.CoreV1().ConfigMaps("default").Create(cm)
+	g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap should be created")
+
+	secret := &v1.Secret{}
+	secret.SetNamespace("default")
+	secret.SetName(app.ConfigMapName)
+	secret.Data = map[string][]byte{
+		"moduleOne": []byte(`
+user: root
+password: qwerty
+`),
+		"moduleTwoEnabled": []byte("false"),
+	}
+	_, err = kubeClient.CoreV1().Secrets("default").Create(secret)
+	g.Expect(err).ShouldNot(HaveOccurred(), "Secret should be created")
+
+	kcm := NewKubeConfigManager()
+	kcm.WithContext(context.Background())
+	kcm.WithKubeClient(kubeClient)
+	kcm.WithNamespace("default")
+	kcm.WithConfigMapName(app.ConfigMapName)
+	kcm.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
+	kcm.WithSecretName(app.ConfigMapName)
+
+	err = kcm.Init()
+	g.Expect(err).ShouldNot(HaveOccurred(), "KubeConfigManager should init correctly")
+
+	config := kcm.InitialConfig()
+	g.Expect(config.Values).Should(Equal(utils.Values{"global": map[string]interface{}{"param1": "val1"}}))
+	g.Expect(config.ModuleConfigs).Should(HaveKey("module-one"))
+	g.Expect(config.ModuleConfigs["module-one"].Values).Should(Equal(utils.Values{
+		"moduleOne": map[string]interface{}{
+			"host":     "db.local",
+			"user":     "root",
+			"password": "qwerty",
+		},
+	}))
+	g.Expect(config.ModuleConfigs).Should(HaveKey("module-two"))
+	g.Expect(*config.ModuleConfigs["module-two"].IsEnabled).Should(BeFalse())
+
+	// 'token' is marked as sensitive, 'user' and 'password' are already in the Secret.
+	kcm.SetSensitivePaths("module-one", [][]string{{"token"}})
+	modVals, err := utils.NewValuesFromBytes([]byte(`
+moduleOne:
+  host: db.example.com
+  user: root
+  password: qwerty
+  token: abc
+`))
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	err = kcm.SetKubeModuleValues("module-one", modVals)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	cm, err = kubeClient.CoreV1().ConfigMaps("default").Get(app.ConfigMapName, metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap get")
+	var cmValues map[string]interface{}
+	g.Expect(yaml.Unmarshal([]byte(cm.Data["moduleOne"]), &cmValues)).Should(Succeed())
+	g.Expect(cmValues).Should(Equal(map[string]interface{}{"host": "db.example.com"}))
+
+	secret, err = kubeClient.CoreV1().Secrets("default").Get(app.ConfigMapName, metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred(), "Secret get")
+	var secretValues map[string]interface{}
+	g.Expect(yaml.Unmarshal(secret.Data["moduleOne"], &secretValues)).Should(Succeed())
+	g.Expect(secretValues).Should(Equal(map[string]interface{}{
+		"user":     "root",
+		"password": "qwerty",
+		"token":    "abc",
+	}))
+	g.Expect(string(secret.Data["moduleTwoEnabled"])).Should(Equal("false"))
+}
+
+func Test_SplitSensitiveValues(t *testing.T) {
+	g := NewWithT(t)
+
+	plain, sensitive := SplitSensitiveValues(map[string]interface{}{
+		"host": "db.local",
+		"auth": map[string]interface{}{
+			"user":     "admin",
+			"password": "qwerty",
+		},
+		"tls": map[string]interface{}{
+			"cert": "CERT",
+			"key":  "KEY",
+		},
+	}, [][]string{{"auth", "password"}, {"tls"}})
+
+	g.Expect(plain).Should(Equal(map[string]interface{}{
+		"host": "db.local",
+		"auth": map[string]interface{}{"user": "admin"},
+	}))
+	g.Expect(sensitive).Should(Equal(map[string]interface{}{
+		"auth": map[string]interface{}{"password": "qwerty"},
+		"tls": map[string]interface{}{
+			"cert": "CERT",
+			"key":  "KEY",
+		},
+	}))
+}
+
+// fakeClientset returns the fake clientset of the fake client to inject errors with reactors.
+func fakeClientset(kubeClient kube.KubernetesClient) *k8stesting.Fake {
+	return kubeClient.Discovery().(*fakediscovery.FakeDiscovery).Fake
+}
+
+// Concurrent changes of the ConfigMap should not be overwritten:
+// the section is re-applied to the actual ConfigMap on conflict.
+func TestKubeConfigManager_SetKubeModuleValues_Conflict(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := kube.NewFakeKubernetesClient()
+
+	cm := &v1.ConfigMap{}
+	cm.SetNamespace("default")
+	cm.SetName(app.ConfigMapName)
+	cm.SetResourceVersion("1")
+	cm.Data = map[string]string{
+		"global": "param1: val1\n",
+	}
+	_, err := kubeClient.CoreV1().ConfigMaps("default").Create(cm)
+	g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap should be created")
+
+	kcm := NewKubeConfigManager()
+	kcm.WithContext(context.Background())
+	kcm.WithKubeClient(kubeClient)
+	kcm.WithNamespace("default")
+	kcm.WithConfigMapName(app.ConfigMapName)
+	kcm.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
+
+	err = kcm.Init()
+	g.Expect(err).ShouldNot(HaveOccurred(), "KubeConfigManager should init correctly")
+
+	// A user edits another section after the ConfigMap is read by the Addon-operator.
+	staleCm := cm.DeepCopy()
+	cm.SetResourceVersion("2")
+	cm.Data["moduleTwo"] = "param: userValue\n"
+	_, err = kubeClient.CoreV1().ConfigMaps("default").Update(cm)
+	g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap should be updated")
+
+	staleGets := 1
+	conflicts := 0
+	fakeCs := fakeClientset(kubeClient)
+	fakeCs.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if staleGets == 0 {
+			return false, nil, nil
+		}
+		staleGets--
+		return true, staleCm.DeepCopy(), nil
+	})
+	fakeCs.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj := action.(k8stesting.UpdateAction).GetObject().(*v1.ConfigMap)
+		if obj.ResourceVersion != "2" {
+			conflicts++
+			return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, obj.Name, fmt.Errorf("the object has been modified"))
+		}
+		return false, nil, nil
+	})
+
+	modVals, err := utils.NewValuesFromBytes([]byte(`
+moduleOne:
+  param: hookValue
+`))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	err = kcm.SetKubeModuleValues("module-one", modVals)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(conflicts).Should(Equal(1))
+
+	cm, err = kubeClient.CoreV1().ConfigMaps("default").Get(app.ConfigMapName, metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap get")
+	g.Expect(cm.Data).Should(Equal(map[string]string{
+		"global":    "param1: val1\n",
+		"moduleOne": "param: hookValue\n",
+		"moduleTwo": "param: userValue\n",
+	}))
+	g.Expect(cm.Annotations[app.ValuesChecksumsAnnotation]).Should(ContainSubstring("module-one"))
+}
+
+// Errors should be returned to the hook instead of being ignored.
+func TestKubeConfigManager_SetKubeModuleValues_Errors(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := kube.NewFakeKubernetesClient()
+
+	kcm := NewKubeConfigManager()
+	kcm.WithContext(context.Background())
+	kcm.WithKubeClient(kubeClient)
+	kcm.WithNamespace("default")
+	kcm.WithConfigMapName(app.ConfigMapName)
+	kcm.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
+
+	err := kcm.Init()
+	g.Expect(err).ShouldNot(HaveOccurred(), "KubeConfigManager should init correctly")
+
+	modVals, err := utils.NewValuesFromBytes([]byte(`
+moduleOne:
+  param: hookValue
+`))
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	fakeCs := fakeClientset(kubeClient)
+
+	// ConfigMap cannot be read.
+	fakeCs.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, app.ConfigMapName, fmt.Errorf("access denied"))
+	})
+	err = kcm.SetKubeModuleValues("module-one", modVals)
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(err.Error()).Should(ContainSubstring("access denied"))
+	fakeCs.ReactionChain = fakeCs.ReactionChain[1:]
+
+	// ConfigMap is always created concurrently.
+	creates := 0
+	fakeCs.PrependReactor("create", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		creates++
+		return true, nil, apierrors.NewAlreadyExists(schema.GroupResource{Resource: "configmaps"}, app.ConfigMapName)
+	})
+	err = kcm.SetKubeModuleValues("module-one", modVals)
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(apierrors.IsAlreadyExists(err)).Should(BeTrue())
+	g.Expect(creates).Should(Equal(ConflictRetry.Steps))
+}
+
+// A broken section should not block changes in other sections.
+func TestKubeConfigManager_BrokenSection(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := kube.NewFakeKubernetesClient()
+
+	cm := &v1.ConfigMap{}
+	cm.SetNamespace("default")
+	cm.SetName(app.ConfigMapName)
+	cm.Data = map[string]string{
+		"global":    "param1: val1\n",
+		"moduleOne": "param: one\n",
+		"moduleTwo": "param: two\n",
+	}
+	_, err := kubeClient.CoreV1().ConfigMaps("default").Create(cm)
+	g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap should be created")
+
+	kcm := NewKubeConfigManager()
+	kcm.WithContext(context.Background())
+	kcm.WithKubeClient(kubeClient)
+	kcm.WithNamespace("default")
+	kcm.WithConfigMapName(app.ConfigMapName)
+	kcm.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
+
+	err = kcm.Init()
+	g.Expect(err).ShouldNot(HaveOccurred(), "KubeConfigManager should init correctly")
+
+	go kcm.Start()
+	defer kcm.Stop()
+
+	getConfigMap := func() *v1.ConfigMap {
+		obj, err := kubeClient.CoreV1().ConfigMaps("default").Get(app.ConfigMapName, metav1.GetOptions{})
+		g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap get")
+		return obj
+	}
+
+	// Break moduleOne and change moduleTwo.
+	cm = getConfigMap()
+	cm.Data["moduleOne"] = "param: [one\n"
+	cm.Data["moduleTwo"] = "param: new-two\n"
+	_, err = kubeClient.CoreV1().ConfigMaps("default").Update(cm)
+	g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap should be updated")
+
+	var updated ModuleConfigs
+	g.Eventually(kcm.ModuleConfigsUpdated()).Should(Receive(&updated))
+	g.Expect(updated["module-two"].IsUpdated).Should(BeTrue())
+	g.Expect(updated["module-two"].Values).Should(Equal(utils.Values{
+		"moduleTwo": map[string]interface{}{"param": "new-two"},
+	}))
+	// Last good values are used for the broken section.
+	g.Expect(updated["module-one"].IsUpdated).Should(BeFalse())
+	g.Expect(updated["module-one"].Values).Should(Equal(utils.Values{
+		"moduleOne": map[string]interface{}{"param": "one"},
+	}))
+
+	g.Eventually(func() string {
+		return getConfigMap().Annotations[ConfigErrorsAnnotation]
+	}).Should(ContainSubstring("module-one"))
+
+	// Fix moduleOne.
+	cm = getConfigMap()
+	cm.Data["moduleOne"] = "param: new-one\n"
+	_, err = kubeClient.CoreV1().ConfigMaps("default").Update(cm)
+	g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap should be updated")
+
+	g.Eventually(kcm.ModuleConfigsUpdated()).Should(Receive(&updated))
+	g.Expect(updated["module-one"].IsUpdated).Should(BeTrue())
+	g.Expect(updated["module-two"].IsUpdated).Should(BeFalse())
+
+	g.Eventually(func() map[string]string {
+		return getConfigMap().Annotations
+	}).ShouldNot(HaveKey(ConfigErrorsAnnotation))
+	g.Expect(kcm.ConfigErrors()).Should(BeEmpty())
+}
+
+// A broken section at start is reported and does not block other sections.
+func TestKubeConfigManager_BrokenSectionOnInit(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := kube.NewFakeKubernetesClient()
+
+	cm := &v1.ConfigMap{}
+	cm.SetNamespace("default")
+	cm.SetName(app.ConfigMapName)
+	cm.Data = map[string]string{
+		"global":    "param1: val1\n",
+		"moduleOne": "param: [one\n",
+		"moduleTwo": "param: two\n",
+	}
+	_, err := kubeClient.CoreV1().ConfigMaps("default").Create(cm)
+	g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap should be created")
+
+	kcm := NewKubeConfigManager()
+	kcm.WithContext(context.Background())
+	kcm.WithKubeClient(kubeClient)
+	kcm.WithNamespace("default")
+	kcm.WithConfigMapName(app.ConfigMapName)
+	kcm.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
+
+	err = kcm.Init()
+	g.Expect(err).ShouldNot(HaveOccurred(), "KubeConfigManager should init with a broken section")
+
+	config := kcm.InitialConfig()
+	g.Expect(config.ModuleConfigs).ShouldNot(HaveKey("module-one"))
+	g.Expect(config.ModuleConfigs["module-two"].Values).Should(Equal(utils.Values{
+		"moduleTwo": map[string]interface{}{"param": "two"},
+	}))
+	g.Expect(kcm.ConfigErrors()).Should(HaveKey("module-one"))
+
+	// Errors are read by the debug server while the informer changes them.
+	kcmImpl := kcm.(*kubeConfigManager)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			kcmImpl.setConfigError(fmt.Sprintf("module-%d", i), fmt.Errorf("broken"))
+			_ = kcm.ConfigErrors()
+		}(i)
+	}
+	wg.Wait()
+	g.Expect(kcm.ConfigErrors()).Should(HaveLen(11))
+}
+
+// Each KubeConfigManager has its own channels, so several instances can run in one process.
+func TestKubeConfigManager_InstanceChannels(t *testing.T) {
+	g := NewWithT(t)
+
+	newKcm := func(kubeClient kube.KubernetesClient) KubeConfigManager {
+		cm := &v1.ConfigMap{}
+		cm.SetNamespace("default")
+		cm.SetName(app.ConfigMapName)
+		cm.Data = map[string]string{"moduleOne": "param1: val1\n"}
+		_, err := kubeClient.CoreV1().ConfigMaps("default").Create(cm)
+		g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap should be created")
+
+		kcm := NewKubeConfigManager()
+		kcm.WithContext(context.Background())
+		kcm.WithKubeClient(kubeClient)
+		kcm.WithNamespace("default")
+		kcm.WithConfigMapName(app.ConfigMapName)
+		kcm.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
+		g.Expect(kcm.Init()).Should(Succeed(), "KubeConfigManager should init correctly")
+		return kcm
+	}
+
+	kubeClient1 := kube.NewFakeKubernetesClient()
+	g.Expect(os.Setenv("KUBE_CONFIG_MANAGER_DEBUG", "yes")).Should(Succeed())
+	kcm1 := newKcm(kubeClient1)
+	g.Expect(os.Unsetenv("KUBE_CONFIG_MANAGER_DEBUG")).Should(Succeed())
+	moduleConfigsUpdated1 := kcm1.ModuleConfigsUpdated()
+	kcm2 := newKcm(kube.NewFakeKubernetesClient())
+
+	g.Expect(kcm1.ModuleConfigsUpdated()).Should(Equal(moduleConfigsUpdated1), "Init of another instance should not replace channels")
+	g.Expect(kcm1.(*kubeConfigManager).verboseDebug).Should(BeTrue(), "Init of another instance should not change debug messages")
+	g.Expect(kcm2.(*kubeConfigManager).verboseDebug).Should(BeFalse())
+	g.Expect(kcm1.ModuleConfigsUpdated()).ShouldNot(Equal(kcm2.ModuleConfigsUpdated()))
+	g.Expect(kcm1.ConfigUpdated()).ShouldNot(Equal(kcm2.ConfigUpdated()))
+
+	go kcm1.Start()
+	defer kcm1.Stop()
+	go kcm2.Start()
+	defer kcm2.Stop()
+
+	cm, err := kubeClient1.CoreV1().ConfigMaps("default").Get(app.ConfigMapName, metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	cm.Data["moduleOne"] = "param1: val2\n"
+	_, err = kubeClient1.CoreV1().ConfigMaps("default").Update(cm)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	var updated ModuleConfigs
+	g.Eventually(kcm1.ModuleConfigsUpdated()).Should(Receive(&updated))
+	g.Expect(updated["module-one"].IsUpdated).Should(BeTrue())
+	g.Consistently(kcm2.ModuleConfigsUpdated()).ShouldNot(Receive())
+}
+
+// testConcurrentWrites saves module values like hooks do while changeObjects changes
+// objects watched by informers. Run with -race to detect unguarded access to the last known data.
+func testConcurrentWrites(t *testing.T, kcm KubeConfigManager, changeObjects func(i int)) {
+	g := NewWithT(t)
+
+	go kcm.Start()
+	defer kcm.Stop()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-kcm.ConfigUpdated():
+			case <-kcm.ModuleConfigsUpdated():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			changeObjects(i)
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		modVals, err := utils.NewValuesFromBytes([]byte(fmt.Sprintf("moduleOne:\n  replicas: %d\n  password: p%d\n", i, i)))
+		g.Expect(err).ShouldNot(HaveOccurred())
+		g.Expect(kcm.SetKubeModuleValues("module-one", modVals)).Should(Succeed())
+	}
+	wg.Wait()
+}
+
+func TestKubeConfigManager_ConcurrentWrites(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := kube.NewFakeKubernetesClient()
+
+	cm := &v1.ConfigMap{}
+	cm.SetNamespace("default")
+	cm.SetName(app.ConfigMapName)
+	cm.Data = map[string]string{"moduleTwo": "param1: val1\n"}
+	_, err := kubeClient.CoreV1().ConfigMaps("default").Create(cm)
+	g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap should be created")
+
+	secret := &v1.Secret{}
+	secret.SetNamespace("default")
+	secret.SetName(app.ConfigMapName)
+	secret.Data = map[string][]byte{"moduleTwo": []byte("token: t\n")}
+	_, err = kubeClient.CoreV1().Secrets("default").Create(secret)
+	g.Expect(err).ShouldNot(HaveOccurred(), "Secret should be created")
+
+	kcm := NewKubeConfigManager()
+	kcm.WithContext(context.Background())
+	kcm.WithKubeClient(kubeClient)
+	kcm.WithNamespace("default")
+	kcm.WithConfigMapName(app.ConfigMapName)
+	kcm.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
+	kcm.WithSecretName(app.ConfigMapName)
+	g.Expect(kcm.Init()).Should(Succeed(), "KubeConfigManager should init correctly")
+	kcm.SetSensitivePaths("module-one", [][]string{{"password"}})
+
+	testConcurrentWrites(t, kcm, func(i int) {
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			cm, err := kubeClient.CoreV1().ConfigMaps("default").Get(app.ConfigMapName, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			cm.Data["moduleTwo"] = fmt.Sprintf("param1: val%d\n", i)
+			_, err = kubeClient.CoreV1().ConfigMaps("default").Update(cm)
+			return err
+		})
+		g.Expect(err).ShouldNot(HaveOccurred())
+
+		err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			secret, err := kubeClient.CoreV1().Secrets("default").Get(app.ConfigMapName, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			secret.Data["moduleTwo"] = []byte(fmt.Sprintf("token: t%d\n", i))
+			_, err = kubeClient.CoreV1().Secrets("default").Update(secret)
+			return err
+		})
+		g.Expect(err).ShouldNot(HaveOccurred())
+	})
+}
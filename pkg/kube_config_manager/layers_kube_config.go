@@ -0,0 +1,172 @@
+package kube_config_manager
+
+import (
+	"reflect"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// WithConfigMapLayers sets names of ConfigMaps with values in the merge order: sections
+// from later ConfigMaps are merged over sections from earlier ones. Objects are merged,
+// other values and *Enabled keys are replaced.
+//
+// Values from hooks are saved only into the writable ConfigMap (ConfigMapName). It is the last
+// layer if it is not in the list. Other layers are read-only, e.g. a base configuration
+// shared by all clusters.
+func (kcm *kubeConfigManager) WithConfigMapLayers(names []string) {
+	kcm.ConfigMapLayers = names
+}
+
+// LayerNames returns names of ConfigMaps with values in the merge order.
+// Empty names are ignored, the writable ConfigMap is added as the last layer if it is not in the list.
+func LayerNames(layers []string, writableName string) []string {
+	res := make([]string, 0, len(layers)+1)
+	hasWritable := false
+	for _, name := range layers {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if name == writableName {
+			hasWritable = true
+		}
+		res = append(res, name)
+	}
+	if !hasWritable {
+		res = append(res, writableName)
+	}
+	return res
+}
+
+func (kcm *kubeConfigManager) layerNames() []string {
+	return LayerNames(kcm.ConfigMapLayers, kcm.ConfigMapName)
+}
+
+// MergeLayersData merges data of ConfigMaps in order. A broken section in a later layer
+// replaces the section, so the error is reported for the section and other sections are not affected.
+func MergeLayersData(layersData []map[string]string) map[string]string {
+	res := make(map[string]string)
+	for _, data := range layersData {
+		for key, value := range data {
+			prevValue, has := res[key]
+			if !has {
+				res[key] = value
+				continue
+			}
+			merged, err := mergeSectionYaml(key, prevValue, value, "ConfigMap", "ConfigMap")
+			if err != nil {
+				res[key] = value
+				continue
+			}
+			res[key] = merged
+		}
+	}
+	return res
+}
+
+// mergedLayersData returns merged data of layers before the layer with the name stopAt.
+// All layers are merged if stopAt is empty.
+func (kcm *kubeConfigManager) mergedLayersData(stopAt string) map[string]string {
+	layersData := make([]map[string]string, 0)
+	for _, name := range kcm.layerNames() {
+		if name == stopAt {
+			break
+		}
+		if data, has := kcm.layersData[name]; has {
+			layersData = append(layersData, data)
+		}
+	}
+	return MergeLayersData(layersData)
+}
+
+// rememberLayer saves data and checksums of the ConfigMap and rebuilds merged data.
+// Checksums are tracked per ConfigMap, only checksums from the writable ConfigMap are used
+// to detect values saved by the Addon-operator.
+// Layers are changed by informers and by saving values, so the caller should hold eventsLock after Init.
+func (kcm *kubeConfigManager) rememberLayer(obj *v1.ConfigMap, checksums map[string]string) {
+	if kcm.layersData == nil {
+		kcm.layersData = make(map[string]map[string]string)
+		kcm.layersChecksums = make(map[string]map[string]string)
+	}
+	kcm.layersData[obj.Name] = obj.Data
+	kcm.layersChecksums[obj.Name] = checksums
+	if obj.Name == kcm.ConfigMapName {
+		kcm.configErrorsAnnotation = obj.Annotations[ConfigErrorsAnnotation]
+	}
+	kcm.rememberConfigData(kcm.mergedLayersData(""), kcm.layersChecksums[kcm.ConfigMapName])
+}
+
+// forgetLayer removes data of the deleted ConfigMap.
+func (kcm *kubeConfigManager) forgetLayer(name string) {
+	delete(kcm.layersData, name)
+	delete(kcm.layersChecksums, name)
+	if name == kcm.ConfigMapName {
+		kcm.configErrorsAnnotation = ""
+	}
+	kcm.rememberConfigData(kcm.mergedLayersData(""), kcm.layersChecksums[kcm.ConfigMapName])
+}
+
+// writableLayerValues returns values of the section to save into the writable ConfigMap:
+// only values that differ from layers before the writable ConfigMap. Values that are
+// removed by hooks but defined in read-only layers cannot be removed, they are reported.
+func (kcm *kubeConfigManager) writableLayerValues(key string, values interface{}) interface{} {
+	baseYaml, has := kcm.mergedLayersData(kcm.ConfigMapName)[key]
+	if !has {
+		return values
+	}
+	var base interface{}
+	if err := yaml.Unmarshal([]byte(baseYaml), &base); err != nil {
+		return values
+	}
+
+	section, isMap := values.(map[string]interface{})
+	baseSection, isBaseMap := base.(map[string]interface{})
+	if !isMap || !isBaseMap {
+		return values
+	}
+
+	res, removed := overrideValues(section, baseSection, []string{key})
+	if len(removed) > 0 {
+		log.Warnf("Kube config manager: values %s are defined in read-only ConfigMaps, they are not removed from '%s' section", strings.Join(removed, ", "), key)
+	}
+	return res
+}
+
+// overrideValues returns values that should be merged over base to get values
+// and paths of values that are in base but not in values.
+func overrideValues(values map[string]interface{}, base map[string]interface{}, path []string) (map[string]interface{}, []string) {
+	res := make(map[string]interface{})
+	removed := make([]string, 0)
+
+	for key, value := range values {
+		baseValue, has := base[key]
+		if !has {
+			res[key] = value
+			continue
+		}
+		valueMap, isMap := value.(map[string]interface{})
+		baseValueMap, isBaseMap := baseValue.(map[string]interface{})
+		if isMap && isBaseMap {
+			sub, subRemoved := overrideValues(valueMap, baseValueMap, append(append([]string{}, path...), key))
+			if len(sub) > 0 {
+				res[key] = sub
+			}
+			removed = append(removed, subRemoved...)
+			continue
+		}
+		if !reflect.DeepEqual(value, baseValue) {
+			res[key] = value
+		}
+	}
+
+	for key := range base {
+		if _, has := values[key]; !has {
+			removed = append(removed, "'"+strings.Join(append(append([]string{}, path...), key), ".")+"'")
+		}
+	}
+
+	return res, removed
+}
@@ -0,0 +1,225 @@
+package kube_config_manager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/flant/shell-operator/pkg/kube"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func Test_LayerNames(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(LayerNames(nil, "cm")).Should(Equal([]string{"cm"}))
+	g.Expect(LayerNames([]string{""}, "cm")).Should(Equal([]string{"cm"}))
+	g.Expect(LayerNames([]string{"base", " env"}, "cm")).Should(Equal([]string{"base", "env", "cm"}))
+	g.Expect(LayerNames([]string{"base", "cm", "env"}, "cm")).Should(Equal([]string{"base", "cm", "env"}))
+}
+
+func Test_MergeLayersData(t *testing.T) {
+	g := NewWithT(t)
+
+	data := MergeLayersData([]map[string]string{
+		{
+			"global":           "param1: base\nparam2: base\n",
+			"moduleOne":        "host: db.base\n",
+			"moduleOneEnabled": "false",
+		},
+		{
+			"global":           "param2: env\n",
+			"moduleOne":        "host: [broken\n",
+			"moduleOneEnabled": "true",
+		},
+	})
+
+	g.Expect(data).Should(Equal(map[string]string{
+		"global":           "param1: base\nparam2: env\n",
+		"moduleOne":        "host: [broken\n",
+		"moduleOneEnabled": "true",
+	}))
+}
+
+func TestKubeConfigManager_Layers(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := kube.NewFakeKubernetesClient()
+	createConfigMap := func(name string, data map[string]string) {
+		cm := &v1.ConfigMap{}
+		cm.SetNamespace("default")
+		cm.SetName(name)
+		cm.Data = data
+		_, err := kubeClient.CoreV1().ConfigMaps("default").Create(cm)
+		g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap should be created")
+	}
+
+	createConfigMap("addon-operator-base", map[string]string{
+		"global": `
+param1: base
+param2: base
+`,
+		"moduleOne": `
+host: db.base
+port: "5432"
+`,
+		"moduleTwoEnabled": "false",
+	})
+	createConfigMap("addon-operator-env", map[string]string{
+		"global": `
+param2: env
+`,
+		"moduleOne": `
+host: db.env
+`,
+	})
+	createConfigMap(app.ConfigMapName, map[string]string{
+		"moduleTwoEnabled": "true",
+	})
+
+	kcm := NewKubeConfigManager()
+	kcm.WithContext(context.Background())
+	kcm.WithKubeClient(kubeClient)
+	kcm.WithNamespace("default")
+	kcm.WithConfigMapName(app.ConfigMapName)
+	kcm.WithConfigMapLayers([]string{"addon-operator-base", "addon-operator-env"})
+	kcm.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
+
+	err := kcm.Init()
+	g.Expect(err).ShouldNot(HaveOccurred(), "KubeConfigManager should init correctly")
+
+	config := kcm.InitialConfig()
+	g.Expect(config.Values).Should(Equal(utils.Values{"global": map[string]interface{}{
+		"param1": "base",
+		"param2": "env",
+	}}))
+	g.Expect(config.ModuleConfigs["module-one"].Values).Should(Equal(utils.Values{
+		"moduleOne": map[string]interface{}{
+			"host": "db.env",
+			"port": "5432",
+		},
+	}))
+	g.Expect(*config.ModuleConfigs["module-two"].IsEnabled).Should(BeTrue())
+
+	// Only values that differ from read-only layers are saved into the writable ConfigMap.
+	modVals, err := utils.NewValuesFromBytes([]byte(`
+moduleOne:
+  host: db.env
+  port: "5432"
+  user: admin
+`))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	err = kcm.SetKubeModuleValues("module-one", modVals)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	cm, err := kubeClient.CoreV1().ConfigMaps("default").Get(app.ConfigMapName, metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap get")
+	var cmValues map[string]interface{}
+	g.Expect(yaml.Unmarshal([]byte(cm.Data["moduleOne"]), &cmValues)).Should(Succeed())
+	g.Expect(cmValues).Should(Equal(map[string]interface{}{"user": "admin"}))
+	g.Expect(cm.Data["moduleTwoEnabled"]).Should(Equal("true"))
+
+	// Read-only layers are not changed.
+	base, err := kubeClient.CoreV1().ConfigMaps("default").Get("addon-operator-base", metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap get")
+	g.Expect(base.Data["moduleOne"]).Should(Equal(`
+host: db.base
+port: "5432"
+`))
+	g.Expect(base.Annotations).ShouldNot(HaveKey(app.ValuesChecksumsAnnotation))
+
+	// Merged values contain values from all layers.
+	configData, err := kcm.(*kubeConfigManager).configData()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	moduleConfig, err := ExtractModuleKubeConfig("module-one", configData)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(moduleConfig.Values).Should(Equal(utils.Values{
+		"moduleOne": map[string]interface{}{
+			"host": "db.env",
+			"port": "5432",
+			"user": "admin",
+		},
+	}))
+
+	// Each layer is watched by name.
+	selectorsLock := sync.Mutex{}
+	fieldSelectors := make([]string, 0)
+	fakeClientset(kubeClient).PrependReactor("list", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		selectorsLock.Lock()
+		defer selectorsLock.Unlock()
+		fieldSelectors = append(fieldSelectors, action.(k8stesting.ListAction).GetListRestrictions().Fields.String())
+		return false, nil, nil
+	})
+
+	go kcm.Start()
+	defer kcm.Stop()
+
+	g.Eventually(func() []string {
+		selectorsLock.Lock()
+		defer selectorsLock.Unlock()
+		return append([]string{}, fieldSelectors...)
+	}).Should(ConsistOf(
+		"metadata.name=addon-operator-base",
+		"metadata.name=addon-operator-env",
+		"metadata.name="+app.ConfigMapName,
+	))
+
+	// Changes in read-only layers are detected.
+	env, err := kubeClient.CoreV1().ConfigMaps("default").Get("addon-operator-env", metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap get")
+	env.Data["moduleOne"] = "host: db.new\n"
+	_, err = kubeClient.CoreV1().ConfigMaps("default").Update(env)
+	g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap should be updated")
+
+	g.Eventually(func() bool {
+		select {
+		case updated := <-kcm.ModuleConfigsUpdated():
+			moduleOne, has := updated["module-one"]
+			return has && moduleOne.IsUpdated && moduleOne.Values["moduleOne"].(map[string]interface{})["host"] == "db.new"
+		default:
+			return false
+		}
+	}).Should(BeTrue())
+}
+
+func TestKubeConfigManager_LayersConcurrentWrites(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := kube.NewFakeKubernetesClient()
+	for _, name := range []string{"addon-operator-base", app.ConfigMapName} {
+		cm := &v1.ConfigMap{}
+		cm.SetNamespace("default")
+		cm.SetName(name)
+		cm.Data = map[string]string{"moduleOne": "host: db.base\n"}
+		_, err := kubeClient.CoreV1().ConfigMaps("default").Create(cm)
+		g.Expect(err).ShouldNot(HaveOccurred(), "ConfigMap should be created")
+	}
+
+	kcm := NewKubeConfigManager()
+	kcm.WithContext(context.Background())
+	kcm.WithKubeClient(kubeClient)
+	kcm.WithNamespace("default")
+	kcm.WithConfigMapName(app.ConfigMapName)
+	kcm.WithConfigMapLayers([]string{"addon-operator-base"})
+	kcm.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
+	g.Expect(kcm.Init()).Should(Succeed(), "KubeConfigManager should init correctly")
+
+	// Values are saved with a diff against the read-only layer while the layer is changed.
+	testConcurrentWrites(t, kcm, func(i int) {
+		cm, err := kubeClient.CoreV1().ConfigMaps("default").Get("addon-operator-base", metav1.GetOptions{})
+		g.Expect(err).ShouldNot(HaveOccurred())
+		cm.Data["moduleOne"] = fmt.Sprintf("host: db.base\nreplicas: %d\n", i)
+		_, err = kubeClient.CoreV1().ConfigMaps("default").Update(cm)
+		g.Expect(err).ShouldNot(HaveOccurred())
+	})
+}
@@ -0,0 +1,376 @@
+package kube_config_manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/yaml"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// Kinds of objects to store config values.
+const (
+	ConfigMapBackend    = "ConfigMap"
+	ModuleConfigBackend = "ModuleConfig"
+)
+
+const (
+	ModuleConfigKind = "ModuleConfig"
+	// GlobalModuleConfigName is a name of the ModuleConfig with global values.
+	// Other ModuleConfig objects are named after modules.
+	GlobalModuleConfigName = "global"
+)
+
+// ModuleConfigGVR is a resource of ModuleConfig objects.
+var ModuleConfigGVR = schema.GroupVersionResource{
+	Group:    "addon-operator.flant.com",
+	Version:  "v1alpha1",
+	Resource: "moduleconfigs",
+}
+
+// NewKubeConfigManagerWithBackend returns a KubeConfigManager that uses a ConfigMap, ModuleConfig objects or files.
+func NewKubeConfigManagerWithBackend(backend string) (KubeConfigManager, error) {
+	switch backend {
+	case ConfigMapBackend:
+		return NewKubeConfigManager(), nil
+	case ModuleConfigBackend:
+		return NewModuleConfigManager(), nil
+	case FilesBackend:
+		return NewFilesConfigManager(), nil
+	}
+	return nil, fmt.Errorf("unknown config backend '%s'", backend)
+}
+
+// moduleConfigManager reads values from ModuleConfig objects: one object per module
+// and the 'global' object with global values:
+//
+//	apiVersion: addon-operator.flant.com/v1alpha1
+//	kind: ModuleConfig
+//	metadata:
+//	  name: module-one
+//	spec:
+//	  enabled: true
+//	  settings:
+//	    param1: value1
+//
+// Objects are converted into ConfigMap data, so changes are detected
+// the same way as for the ConfigMap. Sensitive values are stored in the Secret
+// and merged over ModuleConfig objects as for the ConfigMap. Checksums of values saved by the Addon-operator
+// are stored in the ValuesChecksumsAnnotation of each object.
+type moduleConfigManager struct {
+	*kubeConfigManager
+
+	// ConfigMap data by object name. It is guarded by eventsLock as other last known data.
+	objectsData map[string]map[string]string
+}
+
+// moduleConfigManager should implement KubeConfigManager
+var _ KubeConfigManager = &moduleConfigManager{}
+
+func NewModuleConfigManager() KubeConfigManager {
+	return &moduleConfigManager{
+		kubeConfigManager: NewKubeConfigManager().(*kubeConfigManager),
+		objectsData:       make(map[string]map[string]string),
+	}
+}
+
+func (m *moduleConfigManager) resourceClient() dynamic.ResourceInterface {
+	return m.KubeClient.Dynamic().Resource(ModuleConfigGVR).Namespace(m.Namespace)
+}
+
+func (m *moduleConfigManager) Init() error {
+	log.Debug("INIT: KUBE_CONFIG")
+
+	m.initVerboseDebug()
+
+	list, err := m.resourceClient().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list %s objects: %s", ModuleConfigKind, err)
+	}
+
+	// A broken object is reported as an error of its section, so other sections are used.
+	for i := range list.Items {
+		m.rememberModuleConfig(&list.Items[i])
+	}
+
+	m.secretData, err = m.getSecretData()
+	if err != nil {
+		return err
+	}
+
+	if len(list.Items) == 0 && len(m.secretData) == 0 {
+		log.Infof("Init config from %s objects: no objects found", ModuleConfigKind)
+		return nil
+	}
+
+	configData, err := m.configData()
+	if err != nil {
+		return err
+	}
+
+	return m.initConfigFromData(configData)
+}
+
+func (m *moduleConfigManager) SetKubeGlobalValues(values utils.Values) error {
+	globalKubeConfig, err := GetGlobalKubeConfigFromValues(values)
+	if err != nil {
+		return err
+	}
+
+	if globalKubeConfig != nil {
+		log.Debugf("Kube config manager: set kube global values:\n%s", values.DebugString())
+
+		m.eventsLock.Lock()
+		defer m.eventsLock.Unlock()
+
+		settings, err := m.writableSettings(utils.GlobalValuesKey, utils.GlobalValuesKey, globalKubeConfig.Values[utils.GlobalValuesKey])
+		if err != nil {
+			return err
+		}
+		return m.saveSettings(GlobalModuleConfigName, settings, globalKubeConfig.Checksum)
+	}
+
+	return nil
+}
+
+func (m *moduleConfigManager) SetKubeModuleValues(moduleName string, values utils.Values) error {
+	moduleKubeConfig, err := GetModuleKubeConfigFromValues(moduleName, values)
+	if err != nil {
+		return err
+	}
+
+	if moduleKubeConfig != nil {
+		log.Debugf("Kube config manager: set kube module values:\n%s", moduleKubeConfig.ModuleConfig.String())
+
+		m.eventsLock.Lock()
+		defer m.eventsLock.Unlock()
+
+		key := utils.ModuleNameToValuesKey(moduleName)
+		settings, err := m.writableSettings(moduleName, key, moduleKubeConfig.Values[key])
+		if err != nil {
+			return err
+		}
+		return m.saveSettings(moduleName, settings, moduleKubeConfig.Checksum)
+	}
+
+	return nil
+}
+
+// writableSettings returns values to save into spec.settings. Sensitive values are saved
+// into the Secret, so they are never stored in ModuleConfig objects.
+func (m *moduleConfigManager) writableSettings(section string, key string, values interface{}) (interface{}, error) {
+	if m.SecretName == "" {
+		return values, nil
+	}
+	return m.moveSensitiveValuesToSecret(section, key, values)
+}
+
+// saveSettings puts values into spec.settings of the ModuleConfig. The object is created if not exists.
+// Conflicts are retried the same way as for the ConfigMap.
+func (m *moduleConfigManager) saveSettings(name string, settings interface{}, checksum string) error {
+	return retry.OnError(ConflictRetry, IsConflict, func() error {
+		obj, err := m.resourceClient().Get(name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			obj = &unstructured.Unstructured{}
+			obj.SetAPIVersion(ModuleConfigGVR.GroupVersion().String())
+			obj.SetKind(ModuleConfigKind)
+			obj.SetName(name)
+			obj.SetNamespace(m.Namespace)
+
+			err = m.setSettings(obj, settings, checksum)
+			if err != nil {
+				return err
+			}
+			obj, err = m.resourceClient().Create(obj, metav1.CreateOptions{})
+			if err != nil {
+				return err
+			}
+			m.rememberModuleConfig(obj)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("get %s/%s: %s", ModuleConfigKind, name, err)
+		}
+
+		err = m.setSettings(obj, settings, checksum)
+		if err != nil {
+			return err
+		}
+		obj, err = m.resourceClient().Update(obj, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		m.rememberModuleConfig(obj)
+		return nil
+	})
+}
+
+func (m *moduleConfigManager) setSettings(obj *unstructured.Unstructured, settings interface{}, checksum string) error {
+	// Convert values into JSON types as required by unstructured helpers.
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("marshal settings for %s/%s: %s", ModuleConfigKind, obj.GetName(), err)
+	}
+	var jsonSettings interface{}
+	err = json.Unmarshal(data, &jsonSettings)
+	if err != nil {
+		return fmt.Errorf("unmarshal settings for %s/%s: %s", ModuleConfigKind, obj.GetName(), err)
+	}
+
+	err = unstructured.SetNestedField(obj.Object, jsonSettings, "spec", "settings")
+	if err != nil {
+		return fmt.Errorf("set settings for %s/%s: %s", ModuleConfigKind, obj.GetName(), err)
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[m.ValuesChecksumsAnnotation] = checksum
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// ModuleConfigToConfigData converts the ModuleConfig into ConfigMap data:
+// spec.settings are stored in the section key and spec.enabled is stored in the Enabled key.
+// spec.enabled is ignored for the global ModuleConfig.
+func ModuleConfigToConfigData(obj *unstructured.Unstructured) (map[string]string, error) {
+	res := make(map[string]string)
+
+	key := utils.GlobalValuesKey
+	if obj.GetName() != GlobalModuleConfigName {
+		key = utils.ModuleNameToValuesKey(obj.GetName())
+	}
+
+	settings, hasSettings, err := unstructured.NestedFieldNoCopy(obj.Object, "spec", "settings")
+	if err != nil {
+		return nil, fmt.Errorf("%s/%s: bad spec.settings: %s", ModuleConfigKind, obj.GetName(), err)
+	}
+	if hasSettings {
+		dump, err := yaml.Marshal(settings)
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: dump spec.settings: %s", ModuleConfigKind, obj.GetName(), err)
+		}
+		res[key] = string(dump)
+	}
+
+	if key == utils.GlobalValuesKey {
+		return res, nil
+	}
+
+	enabled, hasEnabled, err := unstructured.NestedBool(obj.Object, "spec", "enabled")
+	if err != nil {
+		return nil, fmt.Errorf("%s/%s: spec.enabled should be boolean: %s", ModuleConfigKind, obj.GetName(), err)
+	}
+	if hasEnabled {
+		res[key+"Enabled"] = strconv.FormatBool(enabled)
+	}
+
+	return res, nil
+}
+
+// rememberModuleConfig saves data and checksum of the ModuleConfig and rebuilds config data.
+// A broken object is reported as an error of its section and last good data of the object is kept.
+func (m *moduleConfigManager) rememberModuleConfig(obj *unstructured.Unstructured) {
+	data, err := ModuleConfigToConfigData(obj)
+	// Object names are the same as sections: 'global' or a module name.
+	m.setSourceError(obj.GetName(), err)
+	if err != nil {
+		return
+	}
+	m.objectsData[obj.GetName()] = data
+
+	if m.configMapChecksums == nil {
+		m.configMapChecksums = make(map[string]string)
+	}
+	m.configMapChecksums[obj.GetName()] = obj.GetAnnotations()[m.ValuesChecksumsAnnotation]
+
+	m.rebuildConfigData()
+}
+
+func (m *moduleConfigManager) forgetModuleConfig(name string) {
+	m.setSourceError(name, nil)
+	delete(m.objectsData, name)
+	delete(m.configMapChecksums, name)
+	m.rebuildConfigData()
+}
+
+func (m *moduleConfigManager) rebuildConfigData() {
+	configData := make(map[string]string)
+	for _, data := range m.objectsData {
+		for key, value := range data {
+			configData[key] = value
+		}
+	}
+	m.configMapData = configData
+}
+
+func (m *moduleConfigManager) handleModuleConfig(obj *unstructured.Unstructured) error {
+	if m.verboseDebug {
+		log.Debugf("Kube config manager: informer: handle %s/%s", ModuleConfigKind, obj.GetName())
+	}
+
+	m.rememberModuleConfig(obj)
+	return m.handleConfigDataChanges()
+}
+
+func (m *moduleConfigManager) handleModuleConfigDelete(obj *unstructured.Unstructured) error {
+	log.Debugf("Kube config manager: handle %s/%s delete", ModuleConfigKind, obj.GetName())
+
+	m.forgetModuleConfig(obj.GetName())
+	return m.handleConfigDataChanges()
+}
+
+func (m *moduleConfigManager) Start() {
+	log.Debugf("Run kube config manager for %s objects", ModuleConfigKind)
+
+	// define resyncPeriod for informer
+	resyncPeriod := time.Duration(5) * time.Minute
+
+	// define indexers for informer
+	indexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+
+	if m.SecretName != "" {
+		m.runSecretInformer(resyncPeriod, indexers)
+	}
+
+	informer := dynamicinformer.NewFilteredDynamicInformer(m.KubeClient.Dynamic(), ModuleConfigGVR, m.Namespace, resyncPeriod, indexers, nil)
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			m.handleEvent(ModuleConfigKind+" add", func() error {
+				return m.handleModuleConfig(obj.(*unstructured.Unstructured))
+			})
+		},
+		UpdateFunc: func(_ interface{}, obj interface{}) {
+			m.handleEvent(ModuleConfigKind+" update", func() error {
+				return m.handleModuleConfig(obj.(*unstructured.Unstructured))
+			})
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			moduleConfig, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			m.handleEvent(ModuleConfigKind+" delete", func() error {
+				return m.handleModuleConfigDelete(moduleConfig)
+			})
+		},
+	})
+
+	informer.Informer().Run(m.ctx.Done())
+}
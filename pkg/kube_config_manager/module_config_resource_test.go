@@ -0,0 +1,319 @@
+package kube_config_manager
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"github.com/flant/shell-operator/pkg/kube"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func newModuleConfig(name string, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetAPIVersion(ModuleConfigGVR.GroupVersion().String())
+	obj.SetKind(ModuleConfigKind)
+	obj.SetNamespace("default")
+	obj.SetName(name)
+	return obj
+}
+
+func Test_ModuleConfigToConfigData(t *testing.T) {
+	g := NewWithT(t)
+
+	data, err := ModuleConfigToConfigData(newModuleConfig("module-one", map[string]interface{}{
+		"enabled":  false,
+		"settings": map[string]interface{}{"param1": "value1"},
+	}))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(data).Should(Equal(map[string]string{
+		"moduleOne":        "param1: value1\n",
+		"moduleOneEnabled": "false",
+	}))
+
+	// spec.enabled is ignored for global values.
+	data, err = ModuleConfigToConfigData(newModuleConfig("global", map[string]interface{}{
+		"enabled":  true,
+		"settings": map[string]interface{}{"param1": "value1"},
+	}))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(data).Should(Equal(map[string]string{"global": "param1: value1\n"}))
+
+	_, err = ModuleConfigToConfigData(newModuleConfig("module-one", map[string]interface{}{
+		"enabled": "yes",
+	}))
+	g.Expect(err).Should(HaveOccurred())
+}
+
+func TestModuleConfigManager(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := kube.NewFakeKubernetesClient()
+	moduleConfigs := kubeClient.Dynamic().Resource(ModuleConfigGVR).Namespace("default")
+
+	_, err := moduleConfigs.Create(newModuleConfig("global", map[string]interface{}{
+		"settings": map[string]interface{}{"param1": "val1"},
+	}), metav1.CreateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	_, err = moduleConfigs.Create(newModuleConfig("module-one", map[string]interface{}{
+		"enabled":  true,
+		"settings": map[string]interface{}{"host": "db.local"},
+	}), metav1.CreateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	_, err = moduleConfigs.Create(newModuleConfig("module-two", map[string]interface{}{
+		"enabled": false,
+	}), metav1.CreateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	kcm, err := NewKubeConfigManagerWithBackend(ModuleConfigBackend)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	kcm.WithContext(ctx)
+	kcm.WithKubeClient(kubeClient)
+	kcm.WithNamespace("default")
+	kcm.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
+
+	err = kcm.Init()
+	g.Expect(err).ShouldNot(HaveOccurred(), "KubeConfigManager should init correctly")
+
+	config := kcm.InitialConfig()
+	g.Expect(config.Values).Should(Equal(utils.Values{"global": map[string]interface{}{"param1": "val1"}}))
+	g.Expect(config.ModuleConfigs).Should(HaveKey("module-one"))
+	g.Expect(config.ModuleConfigs["module-one"].Values).Should(Equal(utils.Values{
+		"moduleOne": map[string]interface{}{"host": "db.local"},
+	}))
+	g.Expect(*config.ModuleConfigs["module-one"].IsEnabled).Should(BeTrue())
+	g.Expect(config.ModuleConfigs).Should(HaveKey("module-two"))
+	g.Expect(*config.ModuleConfigs["module-two"].IsEnabled).Should(BeFalse())
+
+	// Values are saved into the matching ModuleConfig, spec.enabled is preserved.
+	modVals, err := utils.NewValuesFromBytes([]byte(`
+moduleOne:
+  host: db.example.com
+  port: 5432
+`))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	err = kcm.SetKubeModuleValues("module-one", modVals)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	obj, err := moduleConfigs.Get("module-one", metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(obj.Object["spec"]).Should(Equal(map[string]interface{}{
+		"enabled": true,
+		"settings": map[string]interface{}{
+			"host": "db.example.com",
+			"port": float64(5432),
+		},
+	}))
+	g.Expect(obj.GetAnnotations()).Should(HaveKey(app.ValuesChecksumsAnnotation))
+
+	// A ModuleConfig is created for a module without one.
+	modVals, err = utils.NewValuesFromBytes([]byte(`
+moduleThree:
+  param: value
+`))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	err = kcm.SetKubeModuleValues("module-three", modVals)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	obj, err = moduleConfigs.Get("module-three", metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(obj.Object["spec"]).Should(Equal(map[string]interface{}{
+		"settings": map[string]interface{}{"param": "value"},
+	}))
+
+	go kcm.Start()
+
+	// Changes made by users are sent over ModuleConfigsUpdated.
+	obj, err = moduleConfigs.Get("module-two", metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(unstructured.SetNestedField(obj.Object, true, "spec", "enabled")).Should(Succeed())
+	_, err = moduleConfigs.Update(obj, metav1.UpdateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Sections saved above can be sent too, so wait for the module-two update.
+	g.Eventually(func() bool {
+		select {
+		case updated := <-kcm.ModuleConfigsUpdated():
+			moduleTwo, has := updated["module-two"]
+			return has && moduleTwo.IsUpdated && *moduleTwo.IsEnabled
+		default:
+			return false
+		}
+	}).Should(BeTrue())
+}
+
+func TestModuleConfigManager_Secret(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := kube.NewFakeKubernetesClient()
+	moduleConfigs := kubeClient.Dynamic().Resource(ModuleConfigGVR).Namespace("default")
+
+	_, err := moduleConfigs.Create(newModuleConfig("module-one", map[string]interface{}{
+		"settings": map[string]interface{}{"host": "db.local"},
+	}), metav1.CreateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	secret := &v1.Secret{}
+	secret.SetNamespace("default")
+	secret.SetName(app.ConfigMapName)
+	secret.Data = map[string][]byte{
+		"moduleOne": []byte("password: qwerty\n"),
+	}
+	_, err = kubeClient.CoreV1().Secrets("default").Create(secret)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	kcm, err := NewKubeConfigManagerWithBackend(ModuleConfigBackend)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	kcm.WithContext(context.Background())
+	kcm.WithKubeClient(kubeClient)
+	kcm.WithNamespace("default")
+	kcm.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
+	kcm.WithSecretName(app.ConfigMapName)
+
+	err = kcm.Init()
+	g.Expect(err).ShouldNot(HaveOccurred(), "KubeConfigManager should init correctly")
+
+	// Values from the Secret are merged over spec.settings.
+	config := kcm.InitialConfig()
+	g.Expect(config.ModuleConfigs["module-one"].Values).Should(Equal(utils.Values{
+		"moduleOne": map[string]interface{}{
+			"host":     "db.local",
+			"password": "qwerty",
+		},
+	}))
+
+	// Sensitive values are saved into the Secret, not into spec.settings.
+	kcm.SetSensitivePaths("module-one", [][]string{{"token"}})
+	modVals, err := utils.NewValuesFromBytes([]byte(`
+moduleOne:
+  host: db.example.com
+  password: secret
+  token: abc
+`))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	err = kcm.SetKubeModuleValues("module-one", modVals)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	obj, err := moduleConfigs.Get("module-one", metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(obj.Object["spec"]).Should(Equal(map[string]interface{}{
+		"settings": map[string]interface{}{"host": "db.example.com"},
+	}))
+
+	secret, err = kubeClient.CoreV1().Secrets("default").Get(app.ConfigMapName, metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	var secretValues map[string]interface{}
+	g.Expect(yaml.Unmarshal(secret.Data["moduleOne"], &secretValues)).Should(Succeed())
+	g.Expect(secretValues).Should(Equal(map[string]interface{}{
+		"password": "secret",
+		"token":    "abc",
+	}))
+}
+
+func TestModuleConfigManager_ConcurrentWrites(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := kube.NewFakeKubernetesClient()
+	moduleConfigs := kubeClient.Dynamic().Resource(ModuleConfigGVR).Namespace("default")
+
+	_, err := moduleConfigs.Create(newModuleConfig("module-two", map[string]interface{}{
+		"settings": map[string]interface{}{"param1": "val1"},
+	}), metav1.CreateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	secret := &v1.Secret{}
+	secret.SetNamespace("default")
+	secret.SetName(app.ConfigMapName)
+	secret.Data = map[string][]byte{"moduleTwo": []byte("token: t\n")}
+	_, err = kubeClient.CoreV1().Secrets("default").Create(secret)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	kcm, err := NewKubeConfigManagerWithBackend(ModuleConfigBackend)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	kcm.WithContext(context.Background())
+	kcm.WithKubeClient(kubeClient)
+	kcm.WithNamespace("default")
+	kcm.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
+	kcm.WithSecretName(app.ConfigMapName)
+	g.Expect(kcm.Init()).Should(Succeed(), "KubeConfigManager should init correctly")
+	kcm.SetSensitivePaths("module-one", [][]string{{"password"}})
+
+	testConcurrentWrites(t, kcm, func(i int) {
+		_, err := moduleConfigs.Update(newModuleConfig("module-two", map[string]interface{}{
+			"settings": map[string]interface{}{"param1": fmt.Sprintf("val%d", i)},
+		}), metav1.UpdateOptions{})
+		g.Expect(err).ShouldNot(HaveOccurred())
+	})
+}
+
+// A broken ModuleConfig is reported as an error of its section and does not block other sections.
+func TestModuleConfigManager_BrokenObject(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := kube.NewFakeKubernetesClient()
+	moduleConfigs := kubeClient.Dynamic().Resource(ModuleConfigGVR).Namespace("default")
+
+	_, err := moduleConfigs.Create(newModuleConfig("module-one", map[string]interface{}{
+		"settings": map[string]interface{}{"host": "db.local"},
+	}), metav1.CreateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	_, err = moduleConfigs.Create(newModuleConfig("module-two", map[string]interface{}{
+		"enabled": "yes",
+	}), metav1.CreateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	kcm, err := NewKubeConfigManagerWithBackend(ModuleConfigBackend)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	kcm.WithContext(context.Background())
+	kcm.WithKubeClient(kubeClient)
+	kcm.WithNamespace("default")
+	kcm.WithValuesChecksumsAnnotation(app.ValuesChecksumsAnnotation)
+
+	err = kcm.Init()
+	g.Expect(err).ShouldNot(HaveOccurred(), "KubeConfigManager should init with a broken object")
+
+	config := kcm.InitialConfig()
+	g.Expect(config.ModuleConfigs).Should(HaveKey("module-one"))
+	g.Expect(config.ModuleConfigs).ShouldNot(HaveKey("module-two"))
+	g.Expect(kcm.ConfigErrors()).Should(HaveKey("module-two"))
+
+	go kcm.Start()
+	defer kcm.Stop()
+
+	// A broken change keeps last good values of the section.
+	_, err = moduleConfigs.Update(newModuleConfig("module-one", map[string]interface{}{
+		"enabled":  "no",
+		"settings": map[string]interface{}{"host": "db.example.com"},
+	}), metav1.UpdateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Eventually(kcm.ConfigErrors).Should(HaveKey("module-one"))
+	g.Expect(kcm.CurrentConfig().ModuleConfigs["module-one"].Values).Should(Equal(utils.Values{
+		"moduleOne": map[string]interface{}{"host": "db.local"},
+	}))
+
+	// A fixed object is used and its error is removed.
+	_, err = moduleConfigs.Update(newModuleConfig("module-two", map[string]interface{}{
+		"enabled": true,
+	}), metav1.UpdateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	var updated ModuleConfigs
+	g.Eventually(kcm.ModuleConfigsUpdated()).Should(Receive(&updated))
+	g.Expect(updated).Should(HaveKey("module-two"))
+	g.Expect(*updated["module-two"].IsEnabled).Should(BeTrue())
+	g.Expect(updated["module-one"].Values).Should(Equal(utils.Values{
+		"moduleOne": map[string]interface{}{"host": "db.local"},
+	}))
+	g.Expect(kcm.ConfigErrors()).ShouldNot(HaveKey("module-two"))
+	g.Expect(kcm.ConfigErrors()).Should(HaveKey("module-one"))
+}
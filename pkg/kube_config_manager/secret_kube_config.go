@@ -0,0 +1,309 @@
+package kube_config_manager
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/yaml"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// MergeConfigData merges sections from the Secret over sections from the ConfigMap.
+// Values in the Secret take precedence: objects are merged, other values are replaced.
+// *Enabled keys from the Secret replace keys from the ConfigMap.
+func MergeConfigData(configMapData map[string]string, secretData map[string]string) (map[string]string, error) {
+	res := make(map[string]string, len(configMapData)+len(secretData))
+	for key, value := range configMapData {
+		res[key] = value
+	}
+
+	for key, secretYaml := range secretData {
+		configMapYaml, has := res[key]
+		if !has {
+			res[key] = secretYaml
+			continue
+		}
+
+		merged, err := mergeSectionYaml(key, configMapYaml, secretYaml, "ConfigMap", "Secret")
+		if err != nil {
+			return nil, err
+		}
+		res[key] = merged
+	}
+
+	return res, nil
+}
+
+// mergeSectionYaml merges the section from the override source over the section from the base source.
+// Objects are merged, other values and *Enabled keys are replaced.
+func mergeSectionYaml(key string, baseYaml string, overrideYaml string, baseSource string, overrideSource string) (string, error) {
+	if strings.HasSuffix(key, "Enabled") {
+		return overrideYaml, nil
+	}
+
+	var baseValues, overrideValues interface{}
+	if err := yaml.Unmarshal([]byte(baseYaml), &baseValues); err != nil {
+		return "", fmt.Errorf("%s: bad yaml at key '%s': %s", baseSource, key, err)
+	}
+	if err := yaml.Unmarshal([]byte(overrideYaml), &overrideValues); err != nil {
+		return "", fmt.Errorf("%s: bad yaml at key '%s': %s", overrideSource, key, err)
+	}
+
+	baseSection, isMap := baseValues.(map[string]interface{})
+	overrideSection, isOverrideMap := overrideValues.(map[string]interface{})
+	if !isMap || !isOverrideMap {
+		return overrideYaml, nil
+	}
+
+	merged := utils.MergeValues(baseSection, overrideSection)
+	dump, err := yaml.Marshal(merged)
+	if err != nil {
+		return "", fmt.Errorf("dump merged values at key '%s': %s", key, err)
+	}
+	return string(dump), nil
+}
+
+// SplitSensitiveValues returns values that should be stored in the ConfigMap and values
+// that should be stored in the Secret. paths are paths of sensitive values in the section.
+func SplitSensitiveValues(section map[string]interface{}, paths [][]string) (plain map[string]interface{}, sensitive map[string]interface{}) {
+	return splitSensitiveValues(section, nil, paths)
+}
+
+func splitSensitiveValues(obj map[string]interface{}, prefix []string, paths [][]string) (map[string]interface{}, map[string]interface{}) {
+	plain := make(map[string]interface{})
+	sensitive := make(map[string]interface{})
+
+	for key, value := range obj {
+		path := append(append([]string{}, prefix...), key)
+
+		if hasPath(paths, path) {
+			sensitive[key] = value
+			continue
+		}
+
+		nested, isMap := value.(map[string]interface{})
+		if isMap && hasSubPath(paths, path) {
+			nestedPlain, nestedSensitive := splitSensitiveValues(nested, path, paths)
+			if len(nestedPlain) > 0 {
+				plain[key] = nestedPlain
+			}
+			if len(nestedSensitive) > 0 {
+				sensitive[key] = nestedSensitive
+			}
+			continue
+		}
+
+		plain[key] = value
+	}
+
+	return plain, sensitive
+}
+
+func hasPath(paths [][]string, path []string) bool {
+	for _, p := range paths {
+		if strings.Join(p, "\x00") == strings.Join(path, "\x00") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasSubPath(paths [][]string, path []string) bool {
+	prefix := strings.Join(path, "\x00") + "\x00"
+	for _, p := range paths {
+		if strings.HasPrefix(strings.Join(p, "\x00"), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// leafPaths returns paths of all non-object values in the yaml section.
+func leafPaths(sectionYaml string) [][]string {
+	var section interface{}
+	if err := yaml.Unmarshal([]byte(sectionYaml), &section); err != nil {
+		return nil
+	}
+	obj, ok := section.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return objectLeafPaths(obj, nil)
+}
+
+func objectLeafPaths(obj map[string]interface{}, prefix []string) [][]string {
+	res := make([][]string, 0)
+	for key, value := range obj {
+		path := append(append([]string{}, prefix...), key)
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			res = append(res, objectLeafPaths(nested, path)...)
+			continue
+		}
+		res = append(res, path)
+	}
+	return res
+}
+
+// getSecretData returns data of the Secret as strings. nil is returned if the Secret is not configured or not found.
+func (kcm *kubeConfigManager) getSecretData() (map[string]string, error) {
+	if kcm.SecretName == "" {
+		return nil, nil
+	}
+
+	obj, err := kcm.KubeClient.CoreV1().Secrets(kcm.Namespace).Get(kcm.SecretName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		log.Debugf("KUBE_CONFIG_MANAGER: Secret/%s is not created", kcm.SecretName)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("KUBE_CONFIG_MANAGER: Will use Secret/%s for sensitive values", kcm.SecretName)
+	return secretDataToStrings(obj), nil
+}
+
+func secretDataToStrings(obj *v1.Secret) map[string]string {
+	res := make(map[string]string, len(obj.Data))
+	for key, value := range obj.Data {
+		res[key] = string(value)
+	}
+	return res
+}
+
+// saveSensitiveValues saves sensitive values of the section into the Secret and returns
+// ConfigMap data with the rest of values.
+func (kcm *kubeConfigManager) saveSensitiveValues(section string, key string, values interface{}) (map[string]string, error) {
+	plain, err := kcm.moveSensitiveValuesToSecret(section, key, values)
+	if err != nil {
+		return nil, err
+	}
+
+	dump, err := yaml.Marshal(plain)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{key: string(dump)}, nil
+}
+
+// moveSensitiveValuesToSecret saves sensitive values of the section into the Secret and returns
+// the rest of values. Values are sensitive if they are marked in the schema
+// or if they are already stored in the Secret.
+func (kcm *kubeConfigManager) moveSensitiveValuesToSecret(section string, key string, values interface{}) (interface{}, error) {
+	sectionValues, ok := values.(map[string]interface{})
+	if !ok {
+		return values, nil
+	}
+
+	paths := append(append([][]string{}, kcm.sensitivePaths[section]...), leafPaths(kcm.secretData[key])...)
+	plain, sensitive := SplitSensitiveValues(sectionValues, paths)
+
+	err := kcm.changeOrCreateSecret(func(obj *v1.Secret) error {
+		if len(sensitive) == 0 {
+			delete(obj.Data, key)
+			return nil
+		}
+		dump, err := yaml.Marshal(sensitive)
+		if err != nil {
+			return err
+		}
+		obj.Data[key] = dump
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("save sensitive values for '%s' to Secret/%s: %s", section, kcm.SecretName, err)
+	}
+
+	return plain, nil
+}
+
+// changeOrCreateSecret applies secretChangeFunc to the actual Secret and saves it.
+// Conflicts are retried the same way as for the ConfigMap.
+func (kcm *kubeConfigManager) changeOrCreateSecret(secretChangeFunc func(*v1.Secret) error) error {
+	return retry.OnError(ConflictRetry, IsConflict, func() error {
+		obj, err := kcm.KubeClient.CoreV1().Secrets(kcm.Namespace).Get(kcm.SecretName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			obj = &v1.Secret{}
+			obj.Name = kcm.SecretName
+			obj.Data = make(map[string][]byte)
+
+			err = secretChangeFunc(obj)
+			if err != nil {
+				return err
+			}
+			obj, err = kcm.KubeClient.CoreV1().Secrets(kcm.Namespace).Create(obj)
+			if err != nil {
+				return err
+			}
+			kcm.secretData = secretDataToStrings(obj)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if obj.Data == nil {
+			obj.Data = make(map[string][]byte)
+		}
+		err = secretChangeFunc(obj)
+		if err != nil {
+			return err
+		}
+		obj, err = kcm.KubeClient.CoreV1().Secrets(kcm.Namespace).Update(obj)
+		if err != nil {
+			return err
+		}
+		kcm.secretData = secretDataToStrings(obj)
+		return nil
+	})
+}
+
+func (kcm *kubeConfigManager) handleNewSecret(obj *v1.Secret) error {
+	kcm.secretData = secretDataToStrings(obj)
+	return kcm.handleConfigDataChanges()
+}
+
+func (kcm *kubeConfigManager) handleSecretDelete(obj *v1.Secret) error {
+	log.Debugf("Kube config manager: handle Secret '%s' delete", obj.Name)
+	kcm.secretData = nil
+	return kcm.handleConfigDataChanges()
+}
+
+// runSecretInformer starts the informer for the Secret with sensitive values in background.
+func (kcm *kubeConfigManager) runSecretInformer(resyncPeriod time.Duration, indexers cache.Indexers) {
+	secretInformer := corev1.NewFilteredSecretInformer(kcm.KubeClient, kcm.Namespace, resyncPeriod, indexers, nameFieldSelector(kcm.SecretName))
+	secretInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			kcm.handleEvent("Secret add", func() error {
+				return kcm.handleNewSecret(obj.(*v1.Secret))
+			})
+		},
+		UpdateFunc: func(prevObj interface{}, obj interface{}) {
+			kcm.handleEvent("Secret update", func() error {
+				return kcm.handleNewSecret(obj.(*v1.Secret))
+			})
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			secret, ok := obj.(*v1.Secret)
+			if !ok {
+				return
+			}
+			kcm.handleEvent("Secret delete", func() error {
+				return kcm.handleSecretDelete(secret)
+			})
+		},
+	})
+	go secretInformer.Run(kcm.ctx.Done())
+}
@@ -0,0 +1,125 @@
+package module_manager
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/flant/addon-operator/pkg/utils"
+	"github.com/flant/addon-operator/sdk/registry"
+)
+
+// enabledCache stores results of enabled scripts, enabled expressions and go enabled functions.
+//
+// A result is valid while the checksum of its inputs is the same: config values, values,
+// preceding enabled modules, the enabled script file, the 'enabled' expression and the go enabled function.
+// Errors are not cached, so the check is repeated on the next discovery.
+//
+// Only the 'enabled' file is in the checksum of the script: files sourced by the script, environment
+// variables and objects in the cluster are not. The cache is in memory, so such changes take effect
+// only after an input change or a restart.
+type enabledCache struct {
+	m       sync.Mutex
+	entries map[string]enabledCacheEntry
+}
+
+type enabledCacheEntry struct {
+	checksum string
+	enabled  bool
+}
+
+func newEnabledCache() *enabledCache {
+	return &enabledCache{
+		entries: make(map[string]enabledCacheEntry),
+	}
+}
+
+// Get returns a cached result for the module if the checksum of inputs is not changed.
+func (c *enabledCache) Get(moduleName string, checksum string) (enabled bool, has bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	entry, has := c.entries[moduleName]
+	if !has || entry.checksum != checksum {
+		return false, false
+	}
+	return entry.enabled, true
+}
+
+// Set saves a result for the module.
+func (c *enabledCache) Set(moduleName string, checksum string, enabled bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.entries[moduleName] = enabledCacheEntry{
+		checksum: checksum,
+		enabled:  enabled,
+	}
+}
+
+// Delete removes a result for the module.
+func (c *enabledCache) Delete(moduleName string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	delete(c.entries, moduleName)
+}
+
+// checkIsEnabledCached returns a cached status of the module or runs checkIsEnabled if inputs are changed.
+func (m *Module) checkIsEnabledCached(precedingEnabledModules []string, logLabels map[string]string) (bool, error) {
+	metricLabels := map[string]string{"module": m.Name}
+
+	// Values are prepared once for the checksum and for the check.
+	values, err := m.valuesForEnabledScript(precedingEnabledModules)
+	if err != nil {
+		log.WithFields(utils.LabelsToLogFields(logLabels)).
+			Errorf("Prepare values for enabled check: %s", err)
+		return false, err
+	}
+
+	checksum, err := m.enabledInputsChecksum(values, precedingEnabledModules)
+	if err != nil {
+		return false, err
+	}
+
+	if enabled, has := m.moduleManager.enabledCache.Get(m.Name, checksum); has {
+		m.moduleManager.metricStorage.CounterAdd("{PREFIX}module_enabled_cache_hits_total", 1.0, metricLabels)
+		return enabled, nil
+	}
+	m.moduleManager.metricStorage.CounterAdd("{PREFIX}module_enabled_cache_misses_total", 1.0, metricLabels)
+
+	enabled, err := m.checkIsEnabled(values, precedingEnabledModules, logLabels)
+	if err != nil {
+		return false, err
+	}
+	m.moduleManager.enabledCache.Set(m.Name, checksum, enabled)
+	return enabled, nil
+}
+
+// enabledInputsChecksum returns a checksum of all inputs of checkIsEnabled.
+func (m *Module) enabledInputsChecksum(values utils.Values, precedingEnabledModules []string) (string, error) {
+	configValues, err := m.ConfigValues().JsonString()
+	if err != nil {
+		return "", err
+	}
+	valuesJson, err := values.JsonString()
+	if err != nil {
+		return "", err
+	}
+
+	// Go functions have no files, a function is identified by its address.
+	goFunc := ""
+	if enabledFunc := registry.Registry().EnabledFunc(m.Name); enabledFunc != nil {
+		goFunc = fmt.Sprintf("%x", reflect.ValueOf(enabledFunc).Pointer())
+	}
+
+	// CalculateStringsChecksum sorts strings, so each input has a prefix.
+	return utils.CalculateStringsChecksum(
+		"configValues:"+configValues,
+		"values:"+valuesJson,
+		"enabledModules:"+strings.Join(precedingEnabledModules, ","),
+		"script:"+m.enabledScriptFileChecksum(),
+		"expression:"+m.GetMetadata().Enabled,
+		"goFunc:"+goFunc,
+	), nil
+}
@@ -0,0 +1,59 @@
+package module_manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flant/addon-operator/pkg/helm"
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/utils"
+	"github.com/flant/addon-operator/sdk"
+)
+
+func Test_MainModuleManager_EnabledCache(t *testing.T) {
+	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+		return &helm.MockHelmClient{}
+	}
+	mm := NewMainModuleManager()
+	initModuleManager(t, mm, "discover_modules_state__enabled_expression")
+
+	betaRuns := 0
+	sdk.RegisterEnabledFunc("beta", func(input *sdk.EnabledInput) (bool, error) {
+		betaRuns++
+		return true, nil
+	})
+	defer sdk.RegisterEnabledFunc("beta", nil)
+
+	discover := func() []string {
+		modulesState, err := mm.DiscoverModulesState(map[string]string{})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return modulesState.EnabledModules
+	}
+
+	assert.Equal(t, []string{"alpha", "beta", "gamma", "delta"}, discover())
+	assert.Equal(t, 1, betaRuns)
+
+	// Inputs are not changed.
+	assert.Equal(t, []string{"alpha", "beta", "gamma", "delta"}, discover())
+	assert.Equal(t, 1, betaRuns)
+
+	// New ConfigMap values.
+	mm.kubeGlobalConfigValues = utils.Values{"global": map[string]interface{}{"clusterName": "test"}}
+	assert.Equal(t, []string{"alpha", "beta", "gamma", "delta"}, discover())
+	assert.Equal(t, 2, betaRuns)
+
+	// New 'enabled' expression disables alpha: preceding modules of beta are changed.
+	mm.GetModule("alpha").Metadata.Enabled = ".alpha.replicas > 1"
+	assert.Equal(t, []string{"beta", "delta"}, discover())
+	assert.Equal(t, 3, betaRuns)
+
+	// Errors are not cached.
+	mm.GetModule("alpha").Metadata.Enabled = ".alpha.replicas"
+	_, err := mm.DiscoverModulesState(map[string]string{})
+	assert.Error(t, err)
+	_, err = mm.DiscoverModulesState(map[string]string{})
+	assert.Error(t, err)
+}
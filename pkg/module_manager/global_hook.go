@@ -169,7 +169,13 @@ func (h *GlobalHook) Run(bindingType BindingType, context []BindingContext, logL
 		}
 
 		if configValuesPatchResult != nil && configValuesPatchResult.ValuesChanged {
-			err := h.moduleManager.kubeConfigManager.SetKubeGlobalValues(configValuesPatchResult.Values)
+			err := h.moduleManager.ValuesValidator.ValidateGlobalConfigValues(configValuesPatchResult.Values)
+			h.moduleManager.SetValuesValidationError(utils.GlobalValuesKey, ValidationSourceHook(h.Name), err)
+			if err != nil {
+				return fmt.Errorf("global hook '%s': kube config global values are rejected: %s", h.Name, err)
+			}
+
+			err = h.moduleManager.kubeConfigManager.SetKubeGlobalValues(configValuesPatchResult.Values)
 			if err != nil {
 				log.Debugf("Global hook '%s' kube config global values stay unchanged:\n%s", h.Name, h.moduleManager.kubeGlobalConfigValues.DebugString())
 				return fmt.Errorf("global hook '%s': set kube config failed: %s", h.Name, err)
@@ -193,7 +199,16 @@ func (h *GlobalHook) Run(bindingType BindingType, context []BindingContext, logL
 		// MemoryValuesPatch from global hook can contains patches for *Enabled keys
 		// and no patches for 'global' section — valuesPatchResult will be nil in this case.
 		if valuesPatchResult != nil && valuesPatchResult.ValuesChanged {
+			err := h.moduleManager.ValuesValidator.ValidateGlobalValues(valuesPatchResult.Values)
+			h.moduleManager.SetValuesValidationError(utils.GlobalValuesKey, ValidationSourceHook(h.Name), err)
+			if err != nil {
+				return fmt.Errorf("global hook '%s': dynamic global values are rejected: %s", h.Name, err)
+			}
+
 			h.moduleManager.globalDynamicValuesPatches = utils.AppendValuesPatch(h.moduleManager.globalDynamicValuesPatches, valuesPatchResult.ValuesPatch)
+			h.moduleManager.addDynamicValuesPatchSource(valuesPatchResult.ValuesPatch, h.Name, bindingType)
+			h.moduleManager.compactDynamicValuesPatches(utils.GlobalValuesKey)
+			h.moduleManager.saveDynamicValuesPatches(utils.GlobalValuesKey)
 			newGlobalValues, err := h.moduleManager.GlobalValues()
 			if err != nil {
 				return fmt.Errorf("global hook '%s': global values after patch apply: %s", h.Name, err)
@@ -234,6 +249,16 @@ func (h *GlobalHook) PrepareTmpFilesForHookRun(bindingContext []byte) (tmpFiles
 		return
 	}
 
+	tmpFiles["CONFIG_VALUES_MERGE_PATCH_PATH"], err = h.prepareConfigValuesMergePatchFile()
+	if err != nil {
+		return
+	}
+
+	tmpFiles["VALUES_MERGE_PATCH_PATH"], err = h.prepareValuesMergePatchFile()
+	if err != nil {
+		return
+	}
+
 	tmpFiles["METRICS_PATH"], err = h.prepareMetricsFile()
 	if err != nil {
 		return
@@ -323,6 +348,24 @@ func (h *GlobalHook) prepareValuesJsonPatchFile() (string, error) {
 	return path, nil
 }
 
+// CONFIG_VALUES_MERGE_PATCH_PATH
+func (h *GlobalHook) prepareConfigValuesMergePatchFile() (string, error) {
+	path := filepath.Join(h.TmpDir, fmt.Sprintf("%s.global-hook-config-values-%s.merge-patch", h.SafeName(), uuid.NewV4().String()))
+	if err := CreateEmptyWritableFile(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// VALUES_MERGE_PATCH_PATH
+func (h *GlobalHook) prepareValuesMergePatchFile() (string, error) {
+	path := filepath.Join(h.TmpDir, fmt.Sprintf("%s.global-hook-values-%s.merge-patch", h.SafeName(), uuid.NewV4().String()))
+	if err := CreateEmptyWritableFile(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
 // METRICS_PATH
 func (h *GlobalHook) prepareMetricsFile() (string, error) {
 	path := filepath.Join(h.TmpDir, fmt.Sprintf("%s.global-hook-metrics-%s.json", h.SafeName(), uuid.NewV4().String()))
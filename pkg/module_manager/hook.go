@@ -104,12 +104,26 @@ func (h *CommonHook) SynchronizationDone() bool {
 	return done
 }
 
-// SearchGlobalHooks recursively find all executables in hooksDir. Absent hooksDir is not an error.
-func SearchGlobalHooks(hooksDir string) (hooks []*GlobalHook, err error) {
+// SearchGlobalHooks recursively find all executables in hooksDirs. Absent directory is not an error.
+// A hook from a later directory overrides a hook with the same relative path from earlier directories.
+func SearchGlobalHooks(hooksDirs []string) (hooks []*GlobalHook, err error) {
 	hooks = make([]*GlobalHook, 0)
-	shellHooks, err := SearchGlobalShellHooks(hooksDir)
-	if err != nil {
-		return nil, err
+	shellHooks := make([]*GlobalHook, 0)
+	indexByName := make(map[string]int)
+	for _, hooksDir := range hooksDirs {
+		dirHooks, err := SearchGlobalShellHooks(hooksDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, hook := range dirHooks {
+			if idx, has := indexByName[hook.Name]; has {
+				log.Infof("Global hook '%s' is overridden by '%s'", shellHooks[idx].Path, hook.Path)
+				shellHooks[idx] = hook
+				continue
+			}
+			indexByName[hook.Name] = len(shellHooks)
+			shellHooks = append(shellHooks, hook)
+		}
 	}
 	hooks = append(hooks, shellHooks...)
 
@@ -260,7 +274,7 @@ func (mm *moduleManager) RegisterGlobalHooks() error {
 	mm.globalHooksOrder = make(map[BindingType][]*GlobalHook)
 	mm.globalHooksByName = make(map[string]*GlobalHook)
 
-	hooks, err := SearchGlobalHooks(mm.GlobalHooksDir)
+	hooks, err := SearchGlobalHooks(mm.globalHooksDirs())
 	if err != nil {
 		return err
 	}
@@ -18,16 +18,18 @@ import (
 )
 
 type HookExecutor struct {
-	Hook                  Hook
-	Context               []BindingContext
-	ConfigVersion         string
-	ConfigValuesPath      string
-	ValuesPath            string
-	ContextPath           string
-	ConfigValuesPatchPath string
-	ValuesPatchPath       string
-	MetricsPath           string
-	LogLabels             map[string]string
+	Hook                       Hook
+	Context                    []BindingContext
+	ConfigVersion              string
+	ConfigValuesPath           string
+	ValuesPath                 string
+	ContextPath                string
+	ConfigValuesPatchPath      string
+	ValuesPatchPath            string
+	ConfigValuesMergePatchPath string
+	ValuesMergePatchPath       string
+	MetricsPath                string
+	LogLabels                  map[string]string
 }
 
 func NewHookExecutor(h Hook, context []BindingContext, configVersion string) *HookExecutor {
@@ -75,6 +77,8 @@ func (e *HookExecutor) Run() (patches map[utils.ValuesPatchType]*utils.ValuesPat
 	}()
 	e.ConfigValuesPatchPath = tmpFiles["CONFIG_VALUES_JSON_PATCH_PATH"]
 	e.ValuesPatchPath = tmpFiles["VALUES_JSON_PATCH_PATH"]
+	e.ConfigValuesMergePatchPath = tmpFiles["CONFIG_VALUES_MERGE_PATCH_PATH"]
+	e.ValuesMergePatchPath = tmpFiles["VALUES_MERGE_PATCH_PATH"]
 	e.MetricsPath = tmpFiles["METRICS_PATH"]
 
 	envs := []string{}
@@ -91,14 +95,18 @@ func (e *HookExecutor) Run() (patches map[utils.ValuesPatchType]*utils.ValuesPat
 		return nil, nil, err
 	}
 
-	patches[utils.ConfigMapPatch], err = utils.ValuesPatchFromFile(e.ConfigValuesPatchPath)
+	patches[utils.ConfigMapPatch], err = readValuesPatches(e.ConfigValuesPatchPath, e.ConfigValuesMergePatchPath, e.Hook.GetConfigValues())
 	if err != nil {
-		return nil, nil, fmt.Errorf("got bad json patch for config values: %s", err)
+		return nil, nil, fmt.Errorf("got bad patch for config values: %s", err)
 	}
 
-	patches[utils.MemoryValuesPatch], err = utils.ValuesPatchFromFile(e.ValuesPatchPath)
+	values, err := e.Hook.GetValues()
 	if err != nil {
-		return nil, nil, fmt.Errorf("got bad json patch for values: %s", err)
+		return nil, nil, err
+	}
+	patches[utils.MemoryValuesPatch], err = readValuesPatches(e.ValuesPatchPath, e.ValuesMergePatchPath, values)
+	if err != nil {
+		return nil, nil, fmt.Errorf("got bad patch for values: %s", err)
 	}
 
 	metrics, err = metric_operation.MetricOperationsFromFile(e.MetricsPath)
@@ -109,6 +117,38 @@ func (e *HookExecutor) Run() (patches map[utils.ValuesPatchType]*utils.ValuesPat
 	return patches, metrics, nil
 }
 
+// readValuesPatches reads operations from the json patch file and converts the merge patch
+// from the other file into operations. The merge patch is applied after operations.
+func readValuesPatches(jsonPatchPath string, mergePatchPath string, values utils.Values) (*utils.ValuesPatch, error) {
+	patch, err := utils.ValuesPatchFromFile(jsonPatchPath, values)
+	if err != nil {
+		return nil, err
+	}
+	if mergePatchPath == "" {
+		return patch, nil
+	}
+
+	if patch != nil && len(patch.Operations) > 0 {
+		values, _, err = utils.ApplyValuesPatch(values, *patch)
+		if err != nil {
+			return nil, fmt.Errorf("apply json patch: %s", err)
+		}
+	}
+
+	mergePatch, err := utils.MergePatchFromFile(mergePatchPath, values)
+	if err != nil {
+		return nil, fmt.Errorf("merge patch: %s", err)
+	}
+	if mergePatch == nil {
+		return patch, nil
+	}
+	if patch == nil {
+		return mergePatch, nil
+	}
+	patch.MergeOperations(mergePatch)
+	return patch, nil
+}
+
 func (e *HookExecutor) RunGoHook() (patches map[utils.ValuesPatchType]*utils.ValuesPatch, metrics []metric_operation.MetricOperation, err error) {
 	goHook := e.Hook.GetGoHook()
 	if goHook == nil {
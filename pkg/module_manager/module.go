@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime/trace"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,6 +17,8 @@ import (
 	log "github.com/sirupsen/logrus"
 	uuid "gopkg.in/satori/go.uuid.v1"
 
+	. "github.com/flant/libjq-go"
+
 	. "github.com/flant/addon-operator/pkg/hook/types"
 	. "github.com/flant/shell-operator/pkg/hook/binding_context"
 	. "github.com/flant/shell-operator/pkg/hook/types"
@@ -30,6 +34,9 @@ import (
 	"github.com/flant/addon-operator/pkg/helm"
 	"github.com/flant/addon-operator/pkg/helm/client"
 	"github.com/flant/addon-operator/pkg/utils"
+	"github.com/flant/addon-operator/pkg/values_validation"
+	"github.com/flant/addon-operator/sdk"
+	"github.com/flant/addon-operator/sdk/registry"
 )
 
 type Module struct {
@@ -39,6 +46,12 @@ type Module struct {
 	CommonStaticConfig *utils.ModuleConfig
 	// module values from modules/<module name>/values.yaml
 	StaticConfig *utils.ModuleConfig
+	// module metadata from modules/<module name>/module.yaml
+	Metadata *ModuleMetadata
+	// Weight defines the order of modules without dependencies between them.
+	Weight int
+	// Checksum of the enabled script when the module is found. Empty if there is no script.
+	EnabledScriptChecksum string
 
 	LastReleaseManifests []manifest.Manifest
 
@@ -565,6 +578,13 @@ func (m *Module) PrepareValuesYamlFile() (string, error) {
 		return "", err
 	}
 
+	// Do not pass invalid values to helm.
+	err = m.moduleManager.ValuesValidator.ValidateModuleValues(m.Name, values)
+	m.moduleManager.SetValuesValidationError(m.Name, ValidationSourceHelm, err)
+	if err != nil {
+		return "", fmt.Errorf("module '%s' values for helm: %v", m.Name, err)
+	}
+
 	data, err := values.YamlBytes()
 	if err != nil {
 		return "", err
@@ -581,6 +601,28 @@ func (m *Module) PrepareValuesYamlFile() (string, error) {
 	return path, nil
 }
 
+// PrepareRedactedValuesYamlFile creates a values file for helm with redacted sensitive values.
+// It is used to render manifests for debug output.
+func (m *Module) PrepareRedactedValuesYamlFile() (string, error) {
+	values, err := m.Values()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := utils.RedactValues(values).YamlBytes()
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(m.moduleManager.TempDir, fmt.Sprintf("%s.module-values-redacted.yaml-%s", m.SafeName(), uuid.NewV4().String()))
+	err = dumpData(path, data)
+	if err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
 // VALUES_PATH
 func (m *Module) prepareValuesJsonFileWith(values utils.Values) (string, error) {
 	data, err := values.JsonBytes()
@@ -607,14 +649,6 @@ func (m *Module) prepareValuesJsonFile() (string, error) {
 	return m.prepareValuesJsonFileWith(values)
 }
 
-func (m *Module) prepareValuesJsonFileForEnabledScript(precedingEnabledModules []string) (string, error) {
-	values, err := m.valuesForEnabledScript(precedingEnabledModules)
-	if err != nil {
-		return "", err
-	}
-	return m.prepareValuesJsonFileWith(values)
-}
-
 // TODO run when module is registered and save bool value in Module’s field.
 func (m *Module) checkHelmChart() (bool, error) {
 	chartPath := filepath.Join(m.Path, "Chart.yaml")
@@ -646,42 +680,82 @@ func (m *Module) ConfigValues() utils.Values {
 
 // constructValues returns effective values for module hook:
 //
-// global section: static + kube + patches from hooks
+// global section: schema defaults + static + kube + patches from hooks
 //
-// module section: static + kube + patches from hooks
+// module section: schema defaults + static + kube + patches from hooks
 func (m *Module) constructValues() (utils.Values, error) {
-	var err error
+	return m.moduleManager.valuesCache.Get("module/"+m.Name, m.valuesCacheInputs(), func() (utils.Values, error) {
+		return m.constructValuesWithProvenance(nil)
+	})
+}
 
-	res := utils.MergeValues(
-		// global
-		utils.Values{"global": map[string]interface{}{}},
-		m.moduleManager.commonStaticValues.Global(),
-		m.moduleManager.kubeGlobalConfigValues,
-		// module
-		utils.Values{m.ValuesKey(): map[string]interface{}{}},
+// valuesCacheInputs returns inputs of constructValues to check cached values.
+// Enabled modules are not cached, they are added to values in Values and valuesForEnabledScript.
+func (m *Module) valuesCacheInputs() []interface{} {
+	mm := m.moduleManager
+	return []interface{}{
+		mm.ValuesValidator,
+		mm.ValuesValidator.GlobalSchemas,
+		mm.ValuesValidator.ModuleSchemas[m.Name],
+		mm.commonStaticValues,
+		m.CommonStaticConfig,
 		m.CommonStaticConfig.Values,
+		m.StaticConfig,
 		m.StaticConfig.Values,
-		m.moduleManager.kubeModulesConfigValues[m.Name],
-	)
+		mm.kubeGlobalConfigValues,
+		mm.kubeModulesConfigValues[m.Name],
+		mm.globalDynamicValuesPatches,
+		mm.modulesDynamicValuesPatches[m.Name],
+	}
+}
+
+// constructValuesWithProvenance returns effective values as constructValues
+// and records sources of values into provenance if it is not nil.
+func (m *Module) constructValuesWithProvenance(provenance *utils.ValuesProvenance) (utils.Values, error) {
+	var err error
+
+	res := m.baseValues(provenance)
 
 	for _, patches := range [][]utils.ValuesPatch{
 		m.moduleManager.globalDynamicValuesPatches,
 		m.moduleManager.modulesDynamicValuesPatches[m.Name],
 	} {
-		for _, patch := range patches {
-			// Invariant: do not store patches that does not apply
-			// Give user error for patches early, after patch receive
-
-			res, _, err = utils.ApplyValuesPatch(res, patch)
-			if err != nil {
-				return nil, fmt.Errorf("construct values, apply patch error: %s", err)
-			}
+		// Invariant: do not store patches that does not apply
+		// Give user error for patches early, after patch receive
+		res, err = m.moduleManager.applyDynamicValuesPatches(res, patches, provenance)
+		if err != nil {
+			return nil, fmt.Errorf("construct values, apply patch error: %s", err)
 		}
 	}
 
 	return res, nil
 }
 
+// baseValues returns values without dynamic patches: schema defaults + static + kube.
+func (m *Module) baseValues(provenance *utils.ValuesProvenance) utils.Values {
+	strategies := utils.MergeStrategies{}
+	for path, strategy := range m.moduleManager.ValuesValidator.GlobalMergeStrategies() {
+		strategies[path] = strategy
+	}
+	for path, strategy := range m.moduleManager.ValuesValidator.ModuleMergeStrategies(m.Name) {
+		strategies[path] = strategy
+	}
+
+	return mergeValuesLayers(provenance, strategies,
+		// global
+		valuesLayer{utils.Values{"global": map[string]interface{}{}}, utils.ValueSource{}},
+		valuesLayer{m.moduleManager.ValuesValidator.GlobalDefaultValues(), utils.ValueSource{Layer: utils.SchemaDefaultsLayer}},
+		valuesLayer{m.moduleManager.commonStaticValues.Global(), utils.ValueSource{Layer: utils.CommonStaticLayer}},
+		valuesLayer{m.moduleManager.kubeGlobalConfigValues, utils.ValueSource{Layer: utils.ConfigMapLayer}},
+		// module
+		valuesLayer{utils.Values{m.ValuesKey(): map[string]interface{}{}}, utils.ValueSource{}},
+		valuesLayer{m.moduleManager.ValuesValidator.ModuleDefaultValues(m.Name), utils.ValueSource{Layer: utils.SchemaDefaultsLayer}},
+		valuesLayer{m.CommonStaticConfig.Values, utils.ValueSource{Layer: utils.CommonStaticLayer}},
+		valuesLayer{m.StaticConfig.Values, utils.ValueSource{Layer: utils.ModuleStaticLayer}},
+		valuesLayer{m.moduleManager.kubeModulesConfigValues[m.Name], utils.ValueSource{Layer: utils.ConfigMapLayer}},
+	)
+}
+
 // valuesForEnabledScript returns merged values for enabled script.
 // There is enabledModules key in global section with previously enabled modules.
 func (m *Module) valuesForEnabledScript(precedingEnabledModules []string) (utils.Values, error) {
@@ -712,6 +786,23 @@ func (m *Module) Values() (utils.Values, error) {
 	return res, nil
 }
 
+// ValuesExplain returns values for hooks with the source of each leaf value.
+func (m *Module) ValuesExplain() ([]utils.ValueExplanation, error) {
+	provenance := utils.NewValuesProvenance()
+	res, err := m.constructValuesWithProvenance(provenance)
+	if err != nil {
+		return nil, err
+	}
+	enabledModules := utils.Values{
+		"global": map[string]interface{}{
+			"enabledModules": m.moduleManager.enabledModulesInOrder,
+		},
+	}
+	res = utils.MergeValues(res, enabledModules)
+	provenance.Merge(enabledModules, utils.ValueSource{Layer: utils.EnabledModulesLayer})
+	return provenance.Explain(res), nil
+}
+
 func (m *Module) ValuesKey() string {
 	return utils.ModuleNameToValuesKey(m.Name)
 }
@@ -745,7 +836,73 @@ func (m *Module) readModuleEnabledResult(filePath string) (bool, error) {
 	return false, fmt.Errorf("expected 'true' or 'false', got '%s'", value)
 }
 
-func (m *Module) checkIsEnabledByScript(precedingEnabledModules []string, logLabels map[string]string) (bool, error) {
+// checkIsEnabled returns the status of the module from the go enabled function, from the 'enabled'
+// expression in module.yaml or from the enabled script. The first defined source is used.
+// Values are prepared by valuesForEnabledScript with the same preceding enabled modules.
+func (m *Module) checkIsEnabled(values utils.Values, precedingEnabledModules []string, logLabels map[string]string) (bool, error) {
+	if enabledFunc := registry.Registry().EnabledFunc(m.Name); enabledFunc != nil {
+		return m.checkIsEnabledByGoFunc(enabledFunc, values, precedingEnabledModules, logLabels)
+	}
+	if m.GetMetadata().Enabled != "" {
+		return m.checkIsEnabledByExpression(values, precedingEnabledModules, logLabels)
+	}
+	return m.checkIsEnabledByScript(values, precedingEnabledModules, logLabels)
+}
+
+// checkIsEnabledByGoFunc runs the enabled function registered with sdk.RegisterEnabledFunc in process.
+func (m *Module) checkIsEnabledByGoFunc(enabledFunc sdk.EnabledFunc, values utils.Values, precedingEnabledModules []string, logLabels map[string]string) (bool, error) {
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+
+	logEntry.Debugf("Run go enabled function, preceding modules: %v", precedingEnabledModules)
+
+	moduleEnabled, err := enabledFunc(&sdk.EnabledInput{
+		Values:         values,
+		ConfigValues:   m.ConfigValues(),
+		EnabledModules: precedingEnabledModules,
+		LogLabels:      logLabels,
+		LogEntry:       logEntry.WithField("output", "golang"),
+	})
+	if err != nil {
+		logEntry.Errorf("Fail to run go enabled function: %s", err)
+		return false, err
+	}
+
+	logEntry.Infof("Go enabled function run successful, result '%v', module '%s'", moduleEnabled, m.Name)
+	return moduleEnabled, nil
+}
+
+// checkIsEnabledByExpression evaluates the 'enabled' jq expression from module.yaml in process.
+// The input is the same as the content of VALUES_PATH for the enabled script.
+func (m *Module) checkIsEnabledByExpression(values utils.Values, precedingEnabledModules []string, logLabels map[string]string) (bool, error) {
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+	expression := m.GetMetadata().Enabled
+
+	data, err := values.JsonString()
+	if err != nil {
+		logEntry.Errorf("Prepare values for enabled expression: %s", err)
+		return false, err
+	}
+
+	logEntry.Debugf("Evaluate enabled expression '%s', preceding modules: %v", expression, precedingEnabledModules)
+
+	out, err := Jq().WithLibPath(sh_app.JqLibraryPath).Program(expression).Cached().Run(data)
+	if err != nil {
+		logEntry.Errorf("Fail to evaluate enabled expression '%s': %s", expression, err)
+		return false, fmt.Errorf("evaluate enabled expression: %s", err)
+	}
+
+	value := strings.TrimSpace(out)
+	if value != "true" && value != "false" {
+		logEntry.Errorf("Enabled expression '%s' should return true or false, got '%s'", expression, value)
+		return false, fmt.Errorf("bad enabled result")
+	}
+	moduleEnabled := value == "true"
+
+	logEntry.Infof("Enabled expression evaluated, result '%v', module '%s'", moduleEnabled, m.Name)
+	return moduleEnabled, nil
+}
+
+func (m *Module) checkIsEnabledByScript(values utils.Values, precedingEnabledModules []string, logLabels map[string]string) (bool, error) {
 	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
 	enabledScriptPath := filepath.Join(m.Path, "enabled")
 
@@ -780,7 +937,7 @@ func (m *Module) checkIsEnabledByScript(precedingEnabledModules []string, logLab
 		}
 	}()
 
-	valuesPath, err := m.prepareValuesJsonFileForEnabledScript(precedingEnabledModules)
+	valuesPath, err := m.prepareValuesJsonFileWith(values)
 	if err != nil {
 		logEntry.Errorf("Prepare VALUES_PATH file for '%s': %s", enabledScriptPath, err)
 		return false, err
@@ -843,55 +1000,132 @@ func (m *Module) checkIsEnabledByScript(precedingEnabledModules []string, logLab
 	return moduleEnabled, nil
 }
 
-var ValidModuleNameRe = regexp.MustCompile(`^[0-9][0-9][0-9]-(.*)$`)
+// ValidModuleNameRe matches a directory name with a weight prefix, e.g. '010-module-name'.
+var ValidModuleNameRe = regexp.MustCompile(`^([0-9][0-9][0-9])-(.+)$`)
 
+// ModuleNameAndWeight returns the default name and weight of the module from the directory name:
+// '010-module-name' is a module 'module-name' with weight 10, a directory without
+// a prefix is a module with weight 0.
+func ModuleNameAndWeight(dirName string) (string, int) {
+	matchRes := ValidModuleNameRe.FindStringSubmatch(dirName)
+	if matchRes == nil {
+		return dirName, 0
+	}
+	weight, _ := strconv.Atoi(matchRes[1])
+	return matchRes[2], weight
+}
+
+// SearchModules returns modules from subdirectories of modulesDir sorted by weight.
+// Name and weight are defined in module.yaml or by the directory name. Modules
+// with equal weights are sorted by directory name. Hidden directories are ignored.
 func SearchModules(modulesDir string) (modules []*Module, err error) {
 	files, err := ioutil.ReadDir(modulesDir) // returns a list of modules sorted by filename
 	if err != nil {
 		return nil, fmt.Errorf("list modules directory '%s': %s", modulesDir, err)
 	}
 
-	badModulesDirs := make([]string, 0)
 	modules = make([]*Module, 0)
+	modulePaths := make(map[string]string)
 
 	for _, file := range files {
-		if !file.IsDir() {
+		if !file.IsDir() || strings.HasPrefix(file.Name(), ".") {
 			continue
 		}
-		matchRes := ValidModuleNameRe.FindStringSubmatch(file.Name())
-		if matchRes != nil {
-			moduleName := matchRes[1]
-			modulePath := filepath.Join(modulesDir, file.Name())
-			module := NewModule(moduleName, modulePath)
-			modules = append(modules, module)
-		} else {
-			badModulesDirs = append(badModulesDirs, filepath.Join(modulesDir, file.Name()))
+		modulePath := filepath.Join(modulesDir, file.Name())
+
+		metadata, err := loadModuleMetadata(modulePath)
+		if err != nil {
+			return nil, err
+		}
+
+		moduleName, weight := ModuleNameAndWeight(file.Name())
+		if metadata != nil && metadata.Name != "" {
+			moduleName = metadata.Name
+		}
+		if metadata != nil && metadata.Weight != nil {
+			weight = *metadata.Weight
 		}
+
+		if path, has := modulePaths[moduleName]; has {
+			return nil, fmt.Errorf("module '%s' is defined in '%s' and '%s'", moduleName, path, modulePath)
+		}
+		modulePaths[moduleName] = modulePath
+
+		module := NewModule(moduleName, modulePath)
+		module.Weight = weight
+		module.Metadata = metadata
+		module.EnabledScriptChecksum = module.enabledScriptFileChecksum()
+		modules = append(modules, module)
 	}
 
-	if len(badModulesDirs) > 0 {
-		return nil, fmt.Errorf("modules directory contains directories not matched ValidModuleRegex '%s': %s", ValidModuleNameRe, strings.Join(badModulesDirs, ", "))
+	sortModulesByWeight(modules)
+
+	return modules, nil
+}
+
+// SearchModulesInDirs returns modules from all directories sorted by weight. A module
+// from a later directory overrides a module with the same name from earlier directories.
+func SearchModulesInDirs(modulesDirs []string) ([]*Module, error) {
+	modules := make([]*Module, 0)
+	indexByName := make(map[string]int)
+
+	for _, modulesDir := range modulesDirs {
+		dirModules, err := SearchModules(modulesDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, module := range dirModules {
+			if idx, has := indexByName[module.Name]; has {
+				log.Debugf("Module '%s' from '%s' is overridden by '%s'", module.Name, modules[idx].Path, module.Path)
+				modules[idx] = module
+				continue
+			}
+			indexByName[module.Name] = len(modules)
+			modules = append(modules, module)
+		}
 	}
 
-	return
+	sortModulesByWeight(modules)
+
+	return modules, nil
+}
+
+// sortModulesByWeight sorts modules by weight, modules with equal weights are sorted by directory name.
+func sortModulesByWeight(modules []*Module) {
+	sort.SliceStable(modules, func(i, j int) bool {
+		if modules[i].Weight != modules[j].Weight {
+			return modules[i].Weight < modules[j].Weight
+		}
+		return filepath.Base(modules[i].Path) < filepath.Base(modules[j].Path)
+	})
 }
 
 // RegisterModules load all available modules from modules directory
-// FIXME: Only 000-name modules are loaded, allow non-prefixed modules.
+// Modules are registered in the order of weights and dependencies from module.yaml files.
 func (mm *moduleManager) RegisterModules() error {
 	log.Debug("Search and register modules")
 
-	modules, err := SearchModules(mm.ModulesDir)
+	modules, err := SearchModulesInDirs(mm.modulesDirs())
 	if err != nil {
 		return err
 	}
 	log.Debugf("Found %d modules", len(modules))
 
+	modules, err = SortModulesByDependencies(modules)
+	if err != nil {
+		return err
+	}
+
 	// load global and modules common static values from modules/values.yaml
 	if err := mm.loadCommonStaticValues(); err != nil {
 		return fmt.Errorf("load common values for modules: %s", err)
 	}
 
+	// load schemas for global values from global-hooks/openapi
+	if err := mm.loadGlobalValuesSchemas(); err != nil {
+		return err
+	}
+
 	for _, module := range modules {
 		logEntry := log.WithField("module", module.Name)
 
@@ -905,8 +1139,17 @@ func (mm *moduleManager) RegisterModules() error {
 			return fmt.Errorf("bad module values")
 		}
 
+		// load schemas for config values and values from openapi directory
+		err = module.loadValuesSchemas()
+		if err != nil {
+			logEntry.Errorf("Load OpenAPI schemas: %s", err)
+			return fmt.Errorf("bad module values schemas")
+		}
+
+		mm.modulesLock.Lock()
 		mm.allModulesByName[module.Name] = module
 		mm.allModulesNamesInOrder = append(mm.allModulesNamesInOrder, module.Name)
+		mm.modulesLock.Unlock()
 
 		logEntry.Infof("Module '%s' is registered", module.Name)
 	}
@@ -944,24 +1187,62 @@ func (m *Module) loadStaticValues() (err error) {
 	return nil
 }
 
-func (mm *moduleManager) loadCommonStaticValues() error {
-	valuesPath := filepath.Join(mm.ModulesDir, "values.yaml")
-	if _, err := os.Stat(valuesPath); os.IsNotExist(err) {
-		log.Debugf("No common static values file: %s", err)
-		return nil
+// loadValuesSchemas loads OpenAPI schemas for module values from the 'openapi' directory.
+func (m *Module) loadValuesSchemas() error {
+	configBytes, valuesBytes, err := values_validation.ReadSchemaFiles(filepath.Join(m.Path, values_validation.SchemasDir))
+	if err != nil {
+		return err
 	}
+	return m.moduleManager.ValuesValidator.AddModuleValuesSchemas(m.Name, configBytes, valuesBytes)
+}
 
-	valuesYaml, err := ioutil.ReadFile(valuesPath)
-	if err != nil {
-		return fmt.Errorf("load common values file '%s': %s", valuesPath, err)
+// loadGlobalValuesSchemas loads OpenAPI schemas for global values from the 'openapi' directory in global hooks directories.
+// A schema file from a later directory overrides the same file from earlier directories.
+func (mm *moduleManager) loadGlobalValuesSchemas() error {
+	var configBytes, valuesBytes []byte
+	for _, hooksDir := range mm.globalHooksDirs() {
+		dirConfigBytes, dirValuesBytes, err := values_validation.ReadSchemaFiles(filepath.Join(hooksDir, values_validation.SchemasDir))
+		if err != nil {
+			return err
+		}
+		if dirConfigBytes != nil {
+			configBytes = dirConfigBytes
+		}
+		if dirValuesBytes != nil {
+			valuesBytes = dirValuesBytes
+		}
 	}
+	return mm.ValuesValidator.AddGlobalValuesSchemas(configBytes, valuesBytes)
+}
 
-	values, err := utils.NewValuesFromBytes(valuesYaml)
-	if err != nil {
-		return err
+// loadCommonStaticValues loads values.yaml files from modules directories.
+// Values from later directories are merged over values from earlier directories.
+func (mm *moduleManager) loadCommonStaticValues() error {
+	valuesList := make([]utils.Values, 0)
+	for _, modulesDir := range mm.modulesDirs() {
+		valuesPath := filepath.Join(modulesDir, "values.yaml")
+		if _, err := os.Stat(valuesPath); os.IsNotExist(err) {
+			log.Debugf("No common static values file: %s", err)
+			continue
+		}
+
+		valuesYaml, err := ioutil.ReadFile(valuesPath)
+		if err != nil {
+			return fmt.Errorf("load common values file '%s': %s", valuesPath, err)
+		}
+
+		values, err := utils.NewValuesFromBytes(valuesYaml)
+		if err != nil {
+			return err
+		}
+		valuesList = append(valuesList, values)
+	}
+
+	if len(valuesList) == 0 {
+		return nil
 	}
 
-	mm.commonStaticValues = values
+	mm.commonStaticValues = utils.MergeValues(valuesList...)
 
 	log.Debugf("Successfully load common static values:\n%s", mm.commonStaticValues.DebugString())
 
@@ -174,7 +174,13 @@ func (h *ModuleHook) Run(bindingType BindingType, context []BindingContext, logL
 			return fmt.Errorf("module hook '%s': kube module config values update error: %s", h.Name, err)
 		}
 		if configValuesPatchResult.ValuesChanged {
-			err := h.moduleManager.kubeConfigManager.SetKubeModuleValues(moduleName, configValuesPatchResult.Values)
+			err := h.moduleManager.ValuesValidator.ValidateModuleConfigValues(moduleName, configValuesPatchResult.Values)
+			h.moduleManager.SetValuesValidationError(moduleName, ValidationSourceHook(h.Name), err)
+			if err != nil {
+				return fmt.Errorf("module hook '%s': kube module config values are rejected: %s", h.Name, err)
+			}
+
+			err = h.moduleManager.kubeConfigManager.SetKubeModuleValues(moduleName, configValuesPatchResult.Values)
 			if err != nil {
 				log.Debugf("Module hook '%s' kube module config values stay unchanged:\n%s", h.Name, h.moduleManager.kubeModulesConfigValues[moduleName].DebugString())
 				return fmt.Errorf("module hook '%s': set kube module config failed: %s", h.Name, err)
@@ -196,7 +202,16 @@ func (h *ModuleHook) Run(bindingType BindingType, context []BindingContext, logL
 			return fmt.Errorf("module hook '%s': dynamic module values update error: %s", h.Name, err)
 		}
 		if valuesPatchResult.ValuesChanged {
+			err := h.moduleManager.ValuesValidator.ValidateModuleValues(moduleName, valuesPatchResult.Values)
+			h.moduleManager.SetValuesValidationError(moduleName, ValidationSourceHook(h.Name), err)
+			if err != nil {
+				return fmt.Errorf("module hook '%s': dynamic module values are rejected: %s", h.Name, err)
+			}
+
 			h.moduleManager.modulesDynamicValuesPatches[moduleName] = utils.AppendValuesPatch(h.moduleManager.modulesDynamicValuesPatches[moduleName], valuesPatchResult.ValuesPatch)
+			h.moduleManager.addDynamicValuesPatchSource(valuesPatchResult.ValuesPatch, h.Name, bindingType)
+			h.moduleManager.compactDynamicValuesPatches(moduleName)
+			h.moduleManager.saveDynamicValuesPatches(moduleName)
 			newValues, err := h.Module.Values()
 			if err != nil {
 				return fmt.Errorf("get module values after values patch: %s", err)
@@ -239,6 +254,16 @@ func (h *ModuleHook) PrepareTmpFilesForHookRun(bindingContext []byte) (tmpFiles
 		return
 	}
 
+	tmpFiles["CONFIG_VALUES_MERGE_PATCH_PATH"], err = h.prepareConfigValuesMergePatchFile()
+	if err != nil {
+		return
+	}
+
+	tmpFiles["VALUES_MERGE_PATCH_PATH"], err = h.prepareValuesMergePatchFile()
+	if err != nil {
+		return
+	}
+
 	tmpFiles["METRICS_PATH"], err = h.prepareMetricsFile()
 	if err != nil {
 		return
@@ -296,6 +321,24 @@ func (h *ModuleHook) prepareValuesJsonPatchFile() (string, error) {
 	return path, nil
 }
 
+// CONFIG_VALUES_MERGE_PATCH_PATH
+func (h *ModuleHook) prepareConfigValuesMergePatchFile() (string, error) {
+	path := filepath.Join(h.TmpDir, fmt.Sprintf("%s.module-hook-config-values-%s.merge-patch", h.SafeName(), uuid.NewV4().String()))
+	if err := CreateEmptyWritableFile(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// VALUES_MERGE_PATCH_PATH
+func (h *ModuleHook) prepareValuesMergePatchFile() (string, error) {
+	path := filepath.Join(h.TmpDir, fmt.Sprintf("%s.module-hook-values-%s.merge-patch", h.SafeName(), uuid.NewV4().String()))
+	if err := CreateEmptyWritableFile(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
 // METRICS_PATH
 func (h *ModuleHook) prepareMetricsFile() (string, error) {
 	path := filepath.Join(h.TmpDir, fmt.Sprintf("%s.module-hook-metrics-%s.json", h.SafeName(), uuid.NewV4().String()))
@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	utils_checksum "github.com/flant/shell-operator/pkg/utils/checksum"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -28,7 +30,10 @@ import (
 	"github.com/flant/addon-operator/pkg/helm"
 	"github.com/flant/addon-operator/pkg/helm_resources_manager"
 	"github.com/flant/addon-operator/pkg/kube_config_manager"
+	"github.com/flant/addon-operator/pkg/module_status"
 	"github.com/flant/addon-operator/pkg/utils"
+	"github.com/flant/addon-operator/pkg/values_patches_storage"
+	"github.com/flant/addon-operator/pkg/values_validation"
 )
 
 // TODO separate modules and hooks storage, values storage and actions
@@ -47,6 +52,9 @@ type ModuleManager interface {
 	WithHelmResourcesManager(manager helm_resources_manager.HelmResourcesManager)
 	WithMetricStorage(storage *metric_storage.MetricStorage)
 	WithHookMetricStorage(storage *metric_storage.MetricStorage)
+	WithValuesPatchesStorage(storage values_patches_storage.ValuesPatchesStorage)
+	WithValuesPatchesLimits(maxOperations int, maxSize int)
+	WithModuleStatusReporter(reporter *module_status.StatusReporter)
 
 	GetGlobalHooksInOrder(bindingType BindingType) []string
 	GetGlobalHook(name string) *GlobalHook
@@ -60,6 +68,9 @@ type ModuleManager interface {
 	GlobalConfigValues() utils.Values
 	GlobalValues() (utils.Values, error)
 	GlobalValuesPatches() []utils.ValuesPatch
+	GlobalValuesExplain() ([]utils.ValueExplanation, error)
+	ValuesValidationErrors() map[string]map[string]string
+	ValidateKubeConfig(kubeConfig *kube_config_manager.Config) map[string]string
 
 	// Actions for tasks
 	DiscoverModulesState(logLabels map[string]string) (*ModulesState, error)
@@ -71,6 +82,10 @@ type ModuleManager interface {
 
 	RegisterModuleHooks(module *Module, logLabels map[string]string) error
 
+	WithDirsWatchInterval(interval time.Duration)
+	ReloadModule(moduleName string, logLabels map[string]string) (*ModuleReloadResult, error)
+	ReloadGlobalHooks(logLabels map[string]string) error
+
 	HandleKubeEvent(kubeEvent KubeEvent, createGlobalTaskFn func(*GlobalHook, controller.BindingExecutionInfo), createModuleTaskFn func(*Module, *ModuleHook, controller.BindingExecutionInfo))
 	HandleGlobalEnableKubernetesBindings(hookName string, createTaskFn func(*GlobalHook, controller.BindingExecutionInfo)) error
 	HandleModuleEnableKubernetesBindings(hookName string, createTaskFn func(*ModuleHook, controller.BindingExecutionInfo)) error
@@ -109,7 +124,8 @@ type moduleManager struct {
 
 	ValuesLock sync.Mutex
 
-	// Directories
+	// Directories. ModulesDir and GlobalHooksDir are lists of directories
+	// separated by os.PathListSeparator, later directories override earlier ones.
 	ModulesDir     string
 	GlobalHooksDir string
 	TempDir        string
@@ -122,6 +138,11 @@ type moduleManager struct {
 	HelmResourcesManager helm_resources_manager.HelmResourcesManager
 	metricStorage        *metric_storage.MetricStorage
 	hookMetricStorage    *metric_storage.MetricStorage
+	valuesPatchesStorage values_patches_storage.ValuesPatchesStorage
+
+	// Limits for dynamic values patches of a section to start compaction. 0 means no limit.
+	valuesPatchesMaxOperations int
+	valuesPatchesMaxSize       int
 
 	// Index of all modules in modules directory. Key is module name.
 	allModulesByName map[string]*Module
@@ -129,6 +150,11 @@ type moduleManager struct {
 	// Ordered list of all modules names for ordered iterations of allModulesByName.
 	allModulesNamesInOrder []string
 
+	// A lock for allModulesByName and allModulesNamesInOrder. The index is changed only
+	// from the main task queue goroutine, so the lock is required for changes and
+	// for reads from other goroutines: config handlers, the webhook and the debug server.
+	modulesLock sync.RWMutex
+
 	// TODO new layer of values for *Enabled values
 	// commonStaticEnabledValues utils.Values // modules/values.yaml
 	// kubeEnabledValues utils.Values // ConfigMap
@@ -177,6 +203,23 @@ type moduleManager struct {
 	globalDynamicValuesPatches []utils.ValuesPatch
 	// Pathces for dynamic module values
 	modulesDynamicValuesPatches map[string][]utils.ValuesPatch
+	// Hook name and binding for operations in dynamic values patches.
+	dynamicValuesPatchesSources map[*utils.ValuesPatchOperation]utils.ValueSource
+
+	// Effective values for global section and modules. Values are recomputed
+	// only when static values, ConfigMap values, schemas or patches are changed.
+	valuesCache *valuesCache
+	// Cached results of enabled scripts.
+	enabledCache *enabledCache
+
+	// OpenAPI schemas for global and modules values.
+	ValuesValidator *values_validation.ValuesValidator
+	// Last validation errors by section ('global' or module name) and by source of values.
+	// Errors are set by hooks and tasks and are read by the debug server.
+	valuesValidationErrors     map[string]map[string]string
+	valuesValidationErrorsLock sync.Mutex
+	// Reporter of validation errors into module statuses.
+	moduleStatusReporter *module_status.StatusReporter
 
 	// Internal event: module values are changed.
 	// This event leads to module run action.
@@ -191,6 +234,13 @@ type moduleManager struct {
 	moduleConfigsUpdateBeforeAmbiguos kube_config_manager.ModuleConfigs
 	// Internal event: module manager needs to be restarted.
 	retryOnAmbiguous chan bool
+
+	// Interval to check directories for changes, 0 to disable.
+	dirsWatchInterval time.Duration
+	// Checksums of directories from the last check.
+	dirsSnapshot *dirsSnapshot
+	// Modules reloaded from disk since the last discovery. They should run onStartup hooks again.
+	reloadedModules []string
 }
 
 var _ ModuleManager = &moduleManager{}
@@ -205,6 +255,10 @@ const (
 	GlobalChanged EventType = "GLOBAL_CHANGED"
 	// Something wrong with module manager.
 	AmbiguousState EventType = "AMBIGUOUS_STATE"
+	// Files in module directories are changed, added or removed.
+	ModuleFilesChanged EventType = "MODULE_FILES_CHANGED"
+	// Files in global hooks directories or common values.yaml files are changed.
+	GlobalFilesChanged EventType = "GLOBAL_FILES_CHANGED"
 )
 
 // ChangeType are types of module changes.
@@ -247,6 +301,11 @@ func NewMainModuleManager() *moduleManager {
 		kubeModulesConfigValues:     make(map[string]utils.Values),
 		globalDynamicValuesPatches:  make([]utils.ValuesPatch, 0),
 		modulesDynamicValuesPatches: make(map[string][]utils.ValuesPatch),
+		dynamicValuesPatchesSources: make(map[*utils.ValuesPatchOperation]utils.ValueSource),
+		valuesCache:                 newValuesCache(),
+		enabledCache:                newEnabledCache(),
+		ValuesValidator:             values_validation.NewValuesValidator(),
+		valuesValidationErrors:      make(map[string]map[string]string),
 
 		moduleValuesChanged: make(chan string, 1),
 		globalValuesChanged: make(chan bool, 1),
@@ -267,6 +326,16 @@ func (mm *moduleManager) WithDirectories(modulesDir string, globalHooksDir strin
 	return mm
 }
 
+// modulesDirs returns directories with modules in the order of override.
+func (mm *moduleManager) modulesDirs() []string {
+	return filepath.SplitList(mm.ModulesDir)
+}
+
+// globalHooksDirs returns directories with global hooks in the order of override.
+func (mm *moduleManager) globalHooksDirs() []string {
+	return filepath.SplitList(mm.GlobalHooksDir)
+}
+
 func (mm *moduleManager) WithKubeConfigManager(kubeConfigManager kube_config_manager.KubeConfigManager) ModuleManager {
 	mm.kubeConfigManager = kubeConfigManager
 	return mm
@@ -292,6 +361,23 @@ func (mm *moduleManager) WithHookMetricStorage(storage *metric_storage.MetricSto
 	mm.hookMetricStorage = storage
 }
 
+// WithValuesPatchesStorage enables persistence of dynamic values patches.
+func (mm *moduleManager) WithValuesPatchesStorage(storage values_patches_storage.ValuesPatchesStorage) {
+	mm.valuesPatchesStorage = storage
+}
+
+// WithModuleStatusReporter enables reporting of values validation errors into module statuses.
+func (mm *moduleManager) WithModuleStatusReporter(reporter *module_status.StatusReporter) {
+	mm.moduleStatusReporter = reporter
+}
+
+// WithValuesPatchesLimits sets limits for the number of operations and for the size in bytes
+// of dynamic values patches for a section. Patches are compacted when a limit is exceeded.
+func (mm *moduleManager) WithValuesPatchesLimits(maxOperations int, maxSize int) {
+	mm.valuesPatchesMaxOperations = maxOperations
+	mm.valuesPatchesMaxSize = maxSize
+}
+
 func (mm *moduleManager) WithContext(ctx context.Context) {
 	mm.ctx, mm.cancel = context.WithCancel(ctx)
 }
@@ -302,16 +388,30 @@ func (mm *moduleManager) Stop() {
 	}
 }
 
-// RunModulesEnabledScript runs enable script for each module that is enabled by config.
-// Enable script receives a list of previously enabled modules.
+// RunModulesEnabledScript runs go enabled function, enable script or evaluates 'enabled' expression
+// for each module that is enabled by config. Enable script receives a list of previously enabled modules.
+// Results are cached and the check is repeated only if its inputs are changed.
+// A module is disabled without running the script if one of its required modules is not enabled.
 func (mm *moduleManager) RunModulesEnabledScript(enabledByConfig []string, logLabels map[string]string) ([]string, error) {
 	enabledModules := make([]string, 0)
+	disabledReasons := make(map[string]string)
 
-	for _, name := range utils.SortByReference(enabledByConfig, mm.allModulesNamesInOrder) {
+	modulesByName, modulesInOrder := mm.modulesIndex()
+	for _, name := range utils.SortByReference(enabledByConfig, modulesInOrder) {
 		moduleLogLabels := utils.MergeLabels(logLabels)
 		moduleLogLabels["module"] = name
-		module := mm.allModulesByName[name]
-		moduleIsEnabled, err := module.checkIsEnabledByScript(enabledModules, moduleLogLabels)
+		module := modulesByName[name]
+
+		// Required modules precede the module, so they are already checked.
+		notEnabled := utils.ListSubtract(module.GetMetadata().Requires, enabledModules)
+		if len(notEnabled) > 0 {
+			disabledReasons[name] = fmt.Sprintf("required modules are not enabled: %s", strings.Join(notEnabled, ", "))
+			log.WithFields(utils.LabelsToLogFields(moduleLogLabels)).
+				Infof("Module '%s' is disabled: %s", name, disabledReasons[name])
+			continue
+		}
+
+		moduleIsEnabled, err := module.checkIsEnabledCached(enabledModules, moduleLogLabels)
 		if err != nil {
 			return nil, err
 		}
@@ -321,9 +421,24 @@ func (mm *moduleManager) RunModulesEnabledScript(enabledByConfig []string, logLa
 		}
 	}
 
+	mm.reportDisabledReasons(modulesInOrder, disabledReasons)
+
 	return enabledModules, nil
 }
 
+// reportDisabledReasons saves reasons why modules are disabled by dependencies into module statuses.
+func (mm *moduleManager) reportDisabledReasons(modulesInOrder []string, reasons map[string]string) {
+	for _, name := range modulesInOrder {
+		reason := reasons[name]
+		err := mm.moduleStatusReporter.Update(name, func(status *module_status.ModuleStatus) {
+			status.DisabledReason = reason
+		})
+		if err != nil {
+			log.Errorf("Cannot report disabled reason of '%s': %s", name, err)
+		}
+	}
+}
+
 // kubeUpdate
 type kubeUpdate struct {
 	EnabledModulesByConfig  []string
@@ -355,6 +470,14 @@ func (mm *moduleManager) handleNewKubeConfig(newConfig kube_config_manager.Confi
 		Events:                 []Event{{Type: GlobalChanged}},
 	}
 
+	// Keep previous global values if new global section is not valid.
+	err := mm.ValuesValidator.ValidateGlobalConfigValues(newConfig.Values)
+	mm.SetValuesValidationError(utils.GlobalValuesKey, ValidationSourceConfigMap, err)
+	if err != nil {
+		logEntry.Errorf("ConfigMap global section is rejected, previous values are kept: %v", err)
+		res.KubeGlobalConfigValues = mm.kubeGlobalConfigValues
+	}
+
 	var unknown []utils.ModuleConfig
 	res.EnabledModulesByConfig, res.KubeModulesConfigValues, unknown = mm.calculateEnabledModulesByConfig(newConfig.ModuleConfigs)
 
@@ -395,7 +518,8 @@ func (mm *moduleManager) handleNewKubeModuleConfigs(moduleConfigs kube_config_ma
 	// Detect removed module sections for statically enabled modules.
 	// This removal should be handled like kube config update.
 	updateOnSectionRemove := make(map[string]bool)
-	for moduleName, module := range mm.allModulesByName {
+	modulesByName, modulesInOrder := mm.modulesIndex()
+	for moduleName, module := range modulesByName {
 		_, hasKubeConfig := moduleConfigs[moduleName]
 		if !hasKubeConfig {
 			isEnabled := mergeEnabled(
@@ -410,7 +534,7 @@ func (mm *moduleManager) handleNewKubeModuleConfigs(moduleConfigs kube_config_ma
 	}
 
 	// New version of mm.enabledModulesByConfig
-	res.EnabledModulesByConfig = utils.SortByReference(res.EnabledModulesByConfig, mm.allModulesNamesInOrder)
+	res.EnabledModulesByConfig = utils.SortByReference(res.EnabledModulesByConfig, modulesInOrder)
 
 	// Run enable scripts
 	logEntry.Debugf("Run enabled script for %+v", res.EnabledModulesByConfig)
@@ -478,7 +602,8 @@ func (mm *moduleManager) calculateEnabledModulesByConfig(moduleConfigs kube_conf
 
 	log.Debugf("calculateEnabled: dynamicEnabled is %s", mm.DumpDynamicEnabled())
 
-	for moduleName, module := range mm.allModulesByName {
+	modulesByName, modulesInOrder := mm.modulesIndex()
+	for moduleName, module := range modulesByName {
 		kubeConfig, hasKubeConfig := moduleConfigs[moduleName]
 		if hasKubeConfig {
 			isEnabled := mergeEnabled(
@@ -489,7 +614,7 @@ func (mm *moduleManager) calculateEnabledModulesByConfig(moduleConfigs kube_conf
 
 			if isEnabled {
 				enabled = append(enabled, moduleName)
-				values[moduleName] = kubeConfig.Values
+				values[moduleName] = mm.validModuleConfigValues(moduleName, kubeConfig.Values)
 			}
 			log.Debugf("calculateEnabled: module '%s': static enabled %v, kubeConfig: enabled %v, updated %v, dynamic enabled: %v",
 				module.Name,
@@ -514,16 +639,86 @@ func (mm *moduleManager) calculateEnabledModulesByConfig(moduleConfigs kube_conf
 	}
 
 	for _, kubeConfig := range moduleConfigs {
-		if _, hasKey := mm.allModulesByName[kubeConfig.ModuleName]; !hasKey {
+		if _, hasKey := modulesByName[kubeConfig.ModuleName]; !hasKey {
 			unknown = append(unknown, kubeConfig)
 		}
 	}
 
-	enabled = utils.SortByReference(enabled, mm.allModulesNamesInOrder)
+	enabled = utils.SortByReference(enabled, modulesInOrder)
 
 	return
 }
 
+// validModuleConfigValues returns module values from ConfigMap if they are valid.
+// Previously accepted values are returned for invalid module section.
+func (mm *moduleManager) validModuleConfigValues(moduleName string, newValues utils.Values) utils.Values {
+	err := mm.ValuesValidator.ValidateModuleConfigValues(moduleName, newValues)
+	mm.SetValuesValidationError(moduleName, ValidationSourceConfigMap, err)
+	if err != nil {
+		log.WithField("module", moduleName).
+			Errorf("ConfigMap module section is rejected, previous values are kept: %v", err)
+		return mm.kubeModulesConfigValues[moduleName]
+	}
+	return newValues
+}
+
+// validateKubeConfig validates global and module sections of the ConfigMap.
+func (mm *moduleManager) validateKubeConfig(kubeConfig *kube_config_manager.Config) error {
+	err := mm.ValuesValidator.ValidateGlobalConfigValues(kubeConfig.Values)
+	mm.SetValuesValidationError(utils.GlobalValuesKey, ValidationSourceConfigMap, err)
+	if err != nil {
+		return err
+	}
+
+	for moduleName, moduleConfig := range kubeConfig.ModuleConfigs {
+		if _, has := mm.allModulesByName[moduleName]; !has {
+			continue
+		}
+		err := mm.ValuesValidator.ValidateModuleConfigValues(moduleName, moduleConfig.Values)
+		mm.SetValuesValidationError(moduleName, ValidationSourceConfigMap, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateKubeConfig checks the config without applying it and returns validation errors
+// by section ('global' or module name). Like on ConfigMap changes, sections are validated
+// only for modules enabled by values.yaml and the config. Sections of unknown modules are ignored.
+// Dynamic enabled flags are not used and modules are read from a copy of the modules index,
+// so the method is safe to call from other goroutines.
+func (mm *moduleManager) ValidateKubeConfig(kubeConfig *kube_config_manager.Config) map[string]string {
+	res := make(map[string]string)
+	modulesByName, _ := mm.modulesIndex()
+
+	err := mm.ValuesValidator.ValidateGlobalConfigValues(kubeConfig.Values)
+	if err != nil {
+		res[utils.GlobalValuesKey] = err.Error()
+	}
+
+	for moduleName, moduleConfig := range kubeConfig.ModuleConfigs {
+		module, has := modulesByName[moduleName]
+		if !has {
+			continue
+		}
+		isEnabled := mergeEnabled(
+			module.CommonStaticConfig.IsEnabled,
+			module.StaticConfig.IsEnabled,
+			moduleConfig.IsEnabled)
+		if !isEnabled {
+			continue
+		}
+		err := mm.ValuesValidator.ValidateModuleConfigValues(moduleName, moduleConfig.Values)
+		if err != nil {
+			res[moduleName] = err.Error()
+		}
+	}
+
+	return res
+}
+
 // Init — initialize module manager
 func (mm *moduleManager) Init() error {
 	log.Debug("Init ModuleManager")
@@ -536,7 +731,20 @@ func (mm *moduleManager) Init() error {
 		return err
 	}
 
+	// Values marked as sensitive in schemas are redacted in logs and in debug output.
+	mm.resetSensitivePaths()
+
+	// Values marked as sensitive in schemas are saved into the Secret.
+	mm.kubeConfigManager.SetSensitivePaths(utils.GlobalValuesKey, mm.ValuesValidator.GlobalSensitivePaths())
+	for _, moduleName := range mm.allModulesNamesInOrder {
+		mm.kubeConfigManager.SetSensitivePaths(moduleName, mm.ValuesValidator.ModuleSensitivePaths(moduleName))
+	}
+
 	kubeConfig := mm.kubeConfigManager.InitialConfig()
+	// There are no previous values to keep, so invalid ConfigMap is a fatal error.
+	if err := mm.validateKubeConfig(kubeConfig); err != nil {
+		return fmt.Errorf("ConfigMap/%s validation: %v", app.ConfigMapName, err)
+	}
 	mm.kubeGlobalConfigValues = kubeConfig.Values
 
 	var unknown []utils.ModuleConfig
@@ -550,6 +758,16 @@ func (mm *moduleManager) Init() error {
 		log.Warnf("ConfigMap/%s has values for absent modules: %+v", app.ConfigMapName, unknownNames)
 	}
 
+	mm.loadDynamicValuesPatches()
+
+	if mm.dirsWatchInterval > 0 {
+		snapshot, err := mm.takeDirsSnapshot()
+		if err != nil {
+			return fmt.Errorf("calculate checksums of directories: %s", err)
+		}
+		mm.dirsSnapshot = snapshot
+	}
+
 	return nil
 }
 
@@ -557,6 +775,10 @@ func (mm *moduleManager) Init() error {
 func (mm *moduleManager) Start() {
 	go mm.kubeConfigManager.Start()
 
+	if mm.dirsWatchInterval > 0 {
+		go mm.watchDirs()
+	}
+
 	go func() {
 		for {
 			select {
@@ -577,7 +799,7 @@ func (mm *moduleManager) Start() {
 					},
 				}
 
-			case newKubeConfig := <-kube_config_manager.ConfigUpdated:
+			case newKubeConfig := <-mm.kubeConfigManager.ConfigUpdated():
 				handleRes, err := mm.handleNewKubeConfig(newKubeConfig)
 				if err != nil {
 					log.Errorf("MODULE_MANAGER_RUN unable to handle kube config update: %s", err)
@@ -589,7 +811,7 @@ func (mm *moduleManager) Start() {
 					}
 				}
 
-			case newModuleConfigs := <-kube_config_manager.ModuleConfigsUpdated:
+			case newModuleConfigs := <-mm.kubeConfigManager.ModuleConfigsUpdated():
 				// Сбросить запомненные перед ошибкой конфиги
 				mm.moduleConfigsUpdateBeforeAmbiguos = kube_config_manager.ModuleConfigs{}
 
@@ -608,7 +830,7 @@ func (mm *moduleManager) Start() {
 			case <-mm.retryOnAmbiguous:
 				if len(mm.moduleConfigsUpdateBeforeAmbiguos) != 0 {
 					log.Infof("MODULE_MANAGER_RUN Retry saved moduleConfigs: %v", mm.moduleConfigsUpdateBeforeAmbiguos)
-					kube_config_manager.ModuleConfigsUpdated <- mm.moduleConfigsUpdateBeforeAmbiguos
+					mm.kubeConfigManager.ModuleConfigsUpdated() <- mm.moduleConfigsUpdateBeforeAmbiguos
 				} else {
 					log.Debugf("MODULE_MANAGER_RUN Retry IS NOT needed")
 				}
@@ -701,6 +923,10 @@ func (mm *moduleManager) DiscoverModulesState(logLabels map[string]string) (stat
 	state.EnabledModules = enabledModules
 
 	state.NewlyEnabledModules = utils.ListSubtract(enabledModules, mm.enabledModulesInOrder)
+	// Modules reloaded from disk have a new state and should run as newly enabled.
+	reloadedEnabled := utils.ListIntersection(enabledModules, mm.reloadedModules)
+	state.NewlyEnabledModules = utils.SortByReference(utils.ListUnion(state.NewlyEnabledModules, reloadedEnabled), enabledModules)
+	mm.reloadedModules = nil
 	// save enabled modules for future usages
 	mm.enabledModulesInOrder = enabledModules
 
@@ -730,7 +956,9 @@ func (mm *moduleManager) DiscoverModulesState(logLabels map[string]string) (stat
 
 // TODO replace with Module and ModuleShouldExists
 func (mm *moduleManager) GetModule(name string) *Module {
+	mm.modulesLock.RLock()
 	module, exist := mm.allModulesByName[name]
+	mm.modulesLock.RUnlock()
 	if exist {
 		return module
 	} else {
@@ -739,6 +967,21 @@ func (mm *moduleManager) GetModule(name string) *Module {
 	}
 }
 
+// modulesIndex returns copies of allModulesByName and allModulesNamesInOrder.
+// Use it to iterate over modules outside of the main task queue goroutine.
+func (mm *moduleManager) modulesIndex() (map[string]*Module, []string) {
+	mm.modulesLock.RLock()
+	defer mm.modulesLock.RUnlock()
+
+	modulesByName := make(map[string]*Module, len(mm.allModulesByName))
+	for name, module := range mm.allModulesByName {
+		modulesByName[name] = module
+	}
+	modulesInOrder := make([]string, len(mm.allModulesNamesInOrder))
+	copy(modulesInOrder, mm.allModulesNamesInOrder)
+	return modulesByName, modulesInOrder
+}
+
 func (mm *moduleManager) GetModuleNamesInOrder() []string {
 	return mm.enabledModulesInOrder
 }
@@ -953,26 +1196,52 @@ func (mm *moduleManager) GlobalConfigValues() utils.Values {
 	)
 }
 
-// GlobalValues return current global values with applied patches
+// GlobalValues return current global values with applied patches.
+// Defaults from schemas are the lowest layer.
 func (mm *moduleManager) GlobalValues() (utils.Values, error) {
-	var err error
+	return mm.valuesCache.Get(utils.GlobalValuesKey, mm.globalValuesCacheInputs(), func() (utils.Values, error) {
+		return mm.globalValues(nil)
+	})
+}
 
-	res := utils.MergeValues(
-		utils.Values{"global": map[string]interface{}{}},
-		mm.commonStaticValues.Global(),
+// globalValuesCacheInputs returns inputs of global values to check cached values.
+func (mm *moduleManager) globalValuesCacheInputs() []interface{} {
+	return []interface{}{
+		mm.ValuesValidator,
+		mm.ValuesValidator.GlobalSchemas,
+		mm.commonStaticValues,
 		mm.kubeGlobalConfigValues,
-	)
+		mm.globalDynamicValuesPatches,
+	}
+}
+
+// GlobalValuesExplain returns current global values with the source of each value.
+func (mm *moduleManager) GlobalValuesExplain() ([]utils.ValueExplanation, error) {
+	provenance := utils.NewValuesProvenance()
+	res, err := mm.globalValues(provenance)
+	if err != nil {
+		return nil, err
+	}
+	return provenance.Explain(res), nil
+}
+
+// globalValues merges layers of global values and records sources into provenance if it is not nil.
+func (mm *moduleManager) globalValues(provenance *utils.ValuesProvenance) (utils.Values, error) {
+	res := mm.globalBaseValues(provenance)
 
 	// Invariant: do not store patches that does not apply
 	// Give user error for patches early, after patch receive
-	for _, patch := range mm.globalDynamicValuesPatches {
-		res, _, err = utils.ApplyValuesPatch(res, patch)
-		if err != nil {
-			return nil, err
-		}
-	}
+	return mm.applyDynamicValuesPatches(res, mm.globalDynamicValuesPatches, provenance)
+}
 
-	return res, nil
+// globalBaseValues returns global values without dynamic patches.
+func (mm *moduleManager) globalBaseValues(provenance *utils.ValuesProvenance) utils.Values {
+	return mergeValuesLayers(provenance, mm.ValuesValidator.GlobalMergeStrategies(),
+		valuesLayer{utils.Values{"global": map[string]interface{}{}}, utils.ValueSource{}},
+		valuesLayer{mm.ValuesValidator.GlobalDefaultValues(), utils.ValueSource{Layer: utils.SchemaDefaultsLayer}},
+		valuesLayer{mm.commonStaticValues.Global(), utils.ValueSource{Layer: utils.CommonStaticLayer}},
+		valuesLayer{mm.kubeGlobalConfigValues, utils.ValueSource{Layer: utils.ConfigMapLayer}},
+	)
 }
 
 // GlobalValues return patches for global values
@@ -980,6 +1249,292 @@ func (mm *moduleManager) GlobalValuesPatches() []utils.ValuesPatch {
 	return mm.globalDynamicValuesPatches
 }
 
+// valuesLayer is a part of effective values with its source.
+type valuesLayer struct {
+	values utils.Values
+	source utils.ValueSource
+}
+
+// mergeValuesLayers merges layers in order and records their sources into provenance if it is not nil.
+// Arrays are merged according to strategies.
+func mergeValuesLayers(provenance *utils.ValuesProvenance, strategies utils.MergeStrategies, layers ...valuesLayer) utils.Values {
+	res := make(utils.Values)
+	for _, layer := range layers {
+		res = utils.MergeValuesWithStrategies(strategies, res, layer.values)
+		provenance.Merge(layer.values, layer.source)
+	}
+	return res
+}
+
+// applyDynamicValuesPatches applies patches to values. Operations are applied one by one
+// if provenance is not nil to record the hook and the binding for each operation.
+func (mm *moduleManager) applyDynamicValuesPatches(values utils.Values, patches []utils.ValuesPatch, provenance *utils.ValuesProvenance) (utils.Values, error) {
+	var err error
+	for _, patch := range patches {
+		if provenance == nil {
+			values, _, err = utils.ApplyValuesPatch(values, patch)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, op := range patch.Operations {
+			values, _, err = utils.ApplyValuesPatch(values, utils.ValuesPatch{Operations: []*utils.ValuesPatchOperation{op}})
+			if err != nil {
+				return nil, err
+			}
+			provenance.ApplyPatchOperation(op, mm.dynamicValuesPatchSource(op), values)
+		}
+	}
+	return values, nil
+}
+
+// addDynamicValuesPatchSource saves the hook name and the binding for operations in the patch.
+// Sources of operations that are squashed by patches compaction are forgotten.
+func (mm *moduleManager) addDynamicValuesPatchSource(patch utils.ValuesPatch, hookName string, binding BindingType) {
+	for _, op := range patch.Operations {
+		mm.dynamicValuesPatchesSources[op] = utils.ValueSource{
+			Layer:   utils.DynamicPatchLayer,
+			Hook:    hookName,
+			Binding: string(binding),
+		}
+	}
+
+	actualOps := make(map[*utils.ValuesPatchOperation]bool)
+	for _, patches := range mm.modulesDynamicValuesPatches {
+		for _, p := range patches {
+			for _, op := range p.Operations {
+				actualOps[op] = true
+			}
+		}
+	}
+	for _, p := range mm.globalDynamicValuesPatches {
+		for _, op := range p.Operations {
+			actualOps[op] = true
+		}
+	}
+	for op := range mm.dynamicValuesPatchesSources {
+		if !actualOps[op] {
+			delete(mm.dynamicValuesPatchesSources, op)
+		}
+	}
+}
+
+func (mm *moduleManager) dynamicValuesPatchSource(op *utils.ValuesPatchOperation) utils.ValueSource {
+	if source, has := mm.dynamicValuesPatchesSources[op]; has {
+		return source
+	}
+	return utils.ValueSource{Layer: utils.DynamicPatchLayer}
+}
+
+// loadDynamicValuesPatches restores dynamic values patches saved before restart.
+// Persistence is optional: errors are logged and hooks will calculate values again.
+// Patches for absent modules and patches that cannot be applied are ignored.
+func (mm *moduleManager) loadDynamicValuesPatches() {
+	if mm.valuesPatchesStorage == nil {
+		return
+	}
+
+	saved, err := mm.valuesPatchesStorage.LoadAll()
+	if err != nil {
+		log.Errorf("Load saved dynamic values patches: %s", err)
+		return
+	}
+	log.Infof("Load saved dynamic values patches for %d sections", len(saved))
+
+	// Global patches go first, module values include the global section.
+	if patches, has := saved[utils.GlobalValuesKey]; has {
+		mm.globalDynamicValuesPatches = patches
+		if _, err := mm.GlobalValues(); err != nil {
+			log.Errorf("Saved dynamic global values patches are ignored: %s", err)
+			mm.globalDynamicValuesPatches = make([]utils.ValuesPatch, 0)
+		}
+		mm.compactDynamicValuesPatches(utils.GlobalValuesKey)
+		delete(saved, utils.GlobalValuesKey)
+	}
+
+	for moduleName, patches := range saved {
+		module, has := mm.allModulesByName[moduleName]
+		if !has {
+			log.Warnf("Saved dynamic values patches for absent module '%s' are ignored", moduleName)
+			continue
+		}
+		mm.modulesDynamicValuesPatches[moduleName] = patches
+		if _, err := module.Values(); err != nil {
+			log.Errorf("Saved dynamic values patches for module '%s' are ignored: %s", moduleName, err)
+			delete(mm.modulesDynamicValuesPatches, moduleName)
+		}
+		mm.compactDynamicValuesPatches(moduleName)
+	}
+}
+
+// saveDynamicValuesPatches saves dynamic values patches for the section ('global' or module name)
+// if persistence is enabled. Errors are logged: values in memory are already updated.
+func (mm *moduleManager) saveDynamicValuesPatches(section string) {
+	if mm.valuesPatchesStorage == nil {
+		return
+	}
+
+	patches := mm.globalDynamicValuesPatches
+	if section != utils.GlobalValuesKey {
+		patches = mm.modulesDynamicValuesPatches[section]
+	}
+
+	if err := mm.valuesPatchesStorage.Save(section, patches); err != nil {
+		log.Errorf("Dynamic values patches are not persisted: %s", err)
+	}
+}
+
+// compactDynamicValuesPatches replaces dynamic values patches for the section ('global' or module name)
+// with a snapshot if the number of operations or their size exceeds limits. The snapshot gives
+// the same values for any base values, so it stays valid when ConfigMap or values.yaml are changed.
+func (mm *moduleManager) compactDynamicValuesPatches(section string) {
+	defer mm.updateDynamicValuesPatchesMetrics(section)
+
+	patches := mm.globalDynamicValuesPatches
+	if section != utils.GlobalValuesKey {
+		patches = mm.modulesDynamicValuesPatches[section]
+	}
+
+	count := utils.ValuesPatchesOperationsCount(patches)
+	size := utils.ValuesPatchesSize(patches)
+	tooMany := mm.valuesPatchesMaxOperations > 0 && count > mm.valuesPatchesMaxOperations
+	tooBig := mm.valuesPatchesMaxSize > 0 && size > mm.valuesPatchesMaxSize
+	if !tooMany && !tooBig {
+		return
+	}
+
+	snapshot := utils.SnapshotValuesPatches(patches)
+	mm.moveDynamicValuesPatchSources(patches, snapshot)
+
+	compacted := make([]utils.ValuesPatch, 0)
+	if len(snapshot.Operations) > 0 {
+		compacted = append(compacted, snapshot)
+	}
+	if section == utils.GlobalValuesKey {
+		mm.globalDynamicValuesPatches = compacted
+	} else {
+		mm.modulesDynamicValuesPatches[section] = compacted
+	}
+
+	log.Infof("Dynamic values patches for '%s' are compacted: %d operations (%d bytes) to %d operations",
+		section, count, size, len(snapshot.Operations))
+	mm.metricStorage.CounterAdd("{PREFIX}values_patches_compactions_total", 1.0, map[string]string{"module": valuesPatchesMetricLabel(section)})
+}
+
+// moveDynamicValuesPatchSources sets sources for snapshot operations from operations on the same path,
+// on a parent path or on a nested path. Sources of replaced operations are removed.
+func (mm *moduleManager) moveDynamicValuesPatchSources(patches []utils.ValuesPatch, snapshot utils.ValuesPatch) {
+	for _, newOp := range snapshot.Operations {
+		for _, patch := range patches {
+			for _, op := range patch.Operations {
+				related := op.Path == newOp.Path ||
+					strings.HasPrefix(newOp.Path, op.Path+"/") ||
+					strings.HasPrefix(op.Path, newOp.Path+"/")
+				if !related {
+					continue
+				}
+				if source, has := mm.dynamicValuesPatchesSources[op]; has {
+					mm.dynamicValuesPatchesSources[newOp] = source
+				}
+			}
+		}
+	}
+
+	for _, patch := range patches {
+		for _, op := range patch.Operations {
+			delete(mm.dynamicValuesPatchesSources, op)
+		}
+	}
+}
+
+// updateDynamicValuesPatchesMetrics sets the number of operations in dynamic values patches for the section.
+func (mm *moduleManager) updateDynamicValuesPatchesMetrics(section string) {
+	patches := mm.globalDynamicValuesPatches
+	if section != utils.GlobalValuesKey {
+		patches = mm.modulesDynamicValuesPatches[section]
+	}
+	mm.metricStorage.GaugeSet(
+		"{PREFIX}values_patches_operations",
+		float64(utils.ValuesPatchesOperationsCount(patches)),
+		map[string]string{"module": valuesPatchesMetricLabel(section)})
+}
+
+// valuesPatchesMetricLabel returns a 'module' label: empty for the global section
+// for label set consistency with other metrics.
+func valuesPatchesMetricLabel(section string) string {
+	if section == utils.GlobalValuesKey {
+		return ""
+	}
+	return section
+}
+
+// Sources of values for validation errors.
+const (
+	ValidationSourceConfigMap = "ConfigMap"
+	ValidationSourceHelm      = "helm"
+)
+
+// ValidationSourceHook returns a source name for values from the hook.
+func ValidationSourceHook(hookName string) string {
+	return fmt.Sprintf("hook '%s'", hookName)
+}
+
+// SetValuesValidationError saves the last validation error for the section
+// ('global' or module name) and the source of values. nil error clears the saved error.
+func (mm *moduleManager) SetValuesValidationError(section string, source string, err error) {
+	mm.valuesValidationErrorsLock.Lock()
+	if err == nil {
+		if _, has := mm.valuesValidationErrors[section]; has {
+			delete(mm.valuesValidationErrors[section], source)
+			if len(mm.valuesValidationErrors[section]) == 0 {
+				delete(mm.valuesValidationErrors, section)
+			}
+		}
+	} else {
+		if _, has := mm.valuesValidationErrors[section]; !has {
+			mm.valuesValidationErrors[section] = make(map[string]string)
+		}
+		mm.valuesValidationErrors[section][source] = err.Error()
+	}
+	var errors map[string]string
+	if len(mm.valuesValidationErrors[section]) > 0 {
+		errors = make(map[string]string, len(mm.valuesValidationErrors[section]))
+		for source, msg := range mm.valuesValidationErrors[section] {
+			errors[source] = msg
+		}
+	}
+	mm.valuesValidationErrorsLock.Unlock()
+
+	// The status is written without the lock, the reporter has its own.
+	mm.reportValuesValidationErrors(section, errors)
+}
+
+// reportValuesValidationErrors saves validation errors of the section into the module status.
+func (mm *moduleManager) reportValuesValidationErrors(section string, errors map[string]string) {
+	err := mm.moduleStatusReporter.Update(section, func(status *module_status.ModuleStatus) {
+		status.ValidationErrors = errors
+	})
+	if err != nil {
+		log.Errorf("Cannot report validation errors of '%s': %s", section, err)
+	}
+}
+
+// ValuesValidationErrors returns last validation errors for global section and modules.
+func (mm *moduleManager) ValuesValidationErrors() map[string]map[string]string {
+	mm.valuesValidationErrorsLock.Lock()
+	defer mm.valuesValidationErrorsLock.Unlock()
+
+	res := make(map[string]map[string]string, len(mm.valuesValidationErrors))
+	for section, errors := range mm.valuesValidationErrors {
+		res[section] = make(map[string]string, len(errors))
+		for source, msg := range errors {
+			res[section][source] = msg
+		}
+	}
+	return res
+}
+
 func (mm *moduleManager) HandleKubeEvent(kubeEvent KubeEvent, createGlobalTaskFn func(*GlobalHook, controller.BindingExecutionInfo), createModuleTaskFn func(*Module, *ModuleHook, controller.BindingExecutionInfo)) {
 	mm.LoopByBinding(OnKubernetesEvent, func(gh *GlobalHook, m *Module, mh *ModuleHook) {
 		if gh != nil {
@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
@@ -21,13 +23,15 @@ import (
 	"github.com/flant/addon-operator/pkg/helm/client"
 	"github.com/flant/addon-operator/pkg/kube_config_manager"
 	"github.com/flant/addon-operator/pkg/utils"
+	"github.com/flant/addon-operator/pkg/values_patches_storage"
+	"github.com/flant/addon-operator/sdk"
 	"github.com/flant/shell-operator/pkg/kube"
 	utils_file "github.com/flant/shell-operator/pkg/utils/file"
 	"k8s.io/api/core/v1"
 )
 
 // initModuleManager is a test version of an Init method
-func initModuleManager(t *testing.T, mm *moduleManager, configPath string) {
+func initModuleManager(t testing.TB, mm *moduleManager, configPath string) {
 	rootDir := filepath.Join("testdata", configPath)
 
 	var err error
@@ -1189,3 +1193,395 @@ func Test_MainModuleManager_DiscoverModulesState(t *testing.T) {
 	}
 
 }
+
+func Test_MainModuleManager_ValidateValues(t *testing.T) {
+	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+		return &helm.MockHelmClient{}
+	}
+	mm := NewMainModuleManager()
+
+	initModuleManager(t, mm, "validate_values__openapi")
+
+	validModuleValues := utils.Values{
+		"moduleOne": map[string]interface{}{"replicas": 2.0},
+	}
+	validGlobalValues := utils.Values{
+		"global": map[string]interface{}{"clusterName": "main", "logLevel": "Info"},
+	}
+
+	assert.Equal(t, validModuleValues, mm.kubeModulesConfigValues["module-one"])
+	assert.Equal(t, validGlobalValues, mm.kubeGlobalConfigValues)
+	assert.Len(t, mm.ValuesValidationErrors(), 0)
+
+	// Invalid module section is rejected, previous values are kept.
+	invalidModuleConfig := utils.NewModuleConfig("module-one").WithUpdated(true).WithValues(utils.Values{
+		"moduleOne": map[string]interface{}{"replicas": "two"},
+	})
+	res, err := mm.handleNewKubeModuleConfigs(kube_config_manager.ModuleConfigs{"module-one": *invalidModuleConfig})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, validModuleValues, res.KubeModulesConfigValues["module-one"])
+	assert.Contains(t, mm.ValuesValidationErrors()["module-one"][ValidationSourceConfigMap], "moduleOne.replicas")
+
+	// Invalid global section is rejected, previous values are kept.
+	res, err = mm.handleNewKubeConfig(kube_config_manager.Config{
+		Values: utils.Values{
+			"global": map[string]interface{}{"clusterName": "main", "logLevel": "Trace"},
+		},
+		ModuleConfigs: kube_config_manager.ModuleConfigs{},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, validGlobalValues, res.KubeGlobalConfigValues)
+	assert.Contains(t, mm.ValuesValidationErrors()["global"][ValidationSourceConfigMap], "global.logLevel")
+
+	// Valid sections clear errors.
+	validModuleConfig := utils.NewModuleConfig("module-one").WithUpdated(true).WithValues(utils.Values{
+		"moduleOne": map[string]interface{}{"replicas": 3.0, "image": "nginx"},
+	})
+	res, err = mm.handleNewKubeConfig(kube_config_manager.Config{
+		Values:        validGlobalValues,
+		ModuleConfigs: kube_config_manager.ModuleConfigs{"module-one": *validModuleConfig},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, validModuleConfig.Values, res.KubeModulesConfigValues["module-one"])
+	assert.Len(t, mm.ValuesValidationErrors(), 0)
+
+	// Invalid ConfigMap in Init is an error.
+	err = mm.validateKubeConfig(&kube_config_manager.Config{
+		Values:        validGlobalValues,
+		ModuleConfigs: kube_config_manager.ModuleConfigs{"module-one": *invalidModuleConfig},
+	})
+	assert.Error(t, err)
+
+	// Errors are saved by hooks and tasks and are read by the debug server concurrently.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			mm.SetValuesValidationError("module-two", fmt.Sprintf("hook 'hook-%d'", i), fmt.Errorf("error %d", i))
+			_ = mm.ValuesValidationErrors()
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, mm.ValuesValidationErrors()["module-two"], 10)
+}
+
+func Test_MainModuleManager_DefaultValuesFromSchemas(t *testing.T) {
+	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+		return &helm.MockHelmClient{}
+	}
+	mm := NewMainModuleManager()
+
+	initModuleManager(t, mm, "validate_values__openapi")
+
+	// Defaults are below ConfigMap values.
+	globalValues, err := mm.GlobalValues()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, utils.Values{
+		"global": map[string]interface{}{
+			"clusterName": "main",
+			"logLevel":    "Info",
+			"region":      "eu",
+		},
+	}, globalValues)
+
+	// Defaults are below values.yaml and ConfigMap values.
+	values, err := mm.GetModule("module-one").Values()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, map[string]interface{}{
+		"replicas": 2.0,
+		"image":    "nginx",
+		"internal": map[string]interface{}{
+			"ready": false,
+		},
+	}, values["moduleOne"])
+
+	// Defaults are below dynamic patches.
+	mm.modulesDynamicValuesPatches["module-one"] = []utils.ValuesPatch{
+		*utils.MustValuesPatch(utils.ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/moduleOne/internal/ready", "value": true}
+]`))),
+	}
+	values, err = mm.GetModule("module-one").Values()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, map[string]interface{}{"ready": true}, values["moduleOne"].(map[string]interface{})["internal"])
+
+	// Schema defaults are not changed by patches.
+	values, err = mm.GetModule("module-one").Values()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, false, mm.ValuesValidator.ModuleDefaultValues("module-one")["moduleOne"].(map[string]interface{})["internal"].(map[string]interface{})["ready"])
+}
+
+func Test_MainModuleManager_ValuesExplain(t *testing.T) {
+	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+		return &helm.MockHelmClient{}
+	}
+	mm := NewMainModuleManager()
+
+	initModuleManager(t, mm, "validate_values__openapi")
+
+	patch := *utils.MustValuesPatch(utils.ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/moduleOne/internal/ready", "value": true}
+]`)))
+	mm.modulesDynamicValuesPatches["module-one"] = utils.AppendValuesPatch(mm.modulesDynamicValuesPatches["module-one"], patch)
+	mm.addDynamicValuesPatchSource(patch, "000-module-one/hooks/hook-one", BeforeHelm)
+
+	explain, err := mm.GetModule("module-one").ValuesExplain()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	sources := map[string]utils.ValueSource{}
+	values := map[string]interface{}{}
+	for _, item := range explain {
+		sources[item.Path] = item.Source
+		values[item.Path] = item.Value
+	}
+
+	assert.Equal(t, utils.ValueSource{Layer: utils.ConfigMapLayer}, sources["/global/clusterName"])
+	assert.Equal(t, utils.ValueSource{Layer: utils.SchemaDefaultsLayer}, sources["/global/region"])
+	assert.Equal(t, utils.ValueSource{Layer: utils.EnabledModulesLayer}, sources["/global/enabledModules"])
+	// ConfigMap overrides module values.yaml.
+	assert.Equal(t, utils.ValueSource{Layer: utils.ConfigMapLayer}, sources["/moduleOne/replicas"])
+	assert.Equal(t, 2.0, values["/moduleOne/replicas"])
+	assert.Equal(t, utils.ValueSource{Layer: utils.SchemaDefaultsLayer}, sources["/moduleOne/image"])
+	assert.Equal(t, utils.ValueSource{
+		Layer:   utils.DynamicPatchLayer,
+		Hook:    "000-module-one/hooks/hook-one",
+		Binding: string(BeforeHelm),
+	}, sources["/moduleOne/internal/ready"])
+	assert.Equal(t, true, values["/moduleOne/internal/ready"])
+
+	globalExplain, err := mm.GlobalValuesExplain()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Len(t, globalExplain, 3)
+	for _, item := range globalExplain {
+		assert.True(t, strings.HasPrefix(item.Path, "/global/"), item.Path)
+	}
+}
+
+func Test_MainModuleManager_PersistDynamicValuesPatches(t *testing.T) {
+	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+		return &helm.MockHelmClient{}
+	}
+	mm := NewMainModuleManager()
+
+	initModuleManager(t, mm, "validate_values__openapi")
+
+	storage, err := values_patches_storage.NewValuesPatchesStorage(values_patches_storage.ConfigMapStorage)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	storage.WithKubeClient(kube.NewFakeKubernetesClient())
+	storage.WithNamespace("default")
+	storage.WithNamePrefix("addon-operator")
+	mm.WithValuesPatchesStorage(storage)
+
+	// Values patches are saved after hook run.
+	mm.modulesDynamicValuesPatches["module-one"] = utils.AppendValuesPatch(nil, *utils.MustValuesPatch(utils.ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/moduleOne/internal/ready", "value": true}
+]`))))
+	mm.saveDynamicValuesPatches("module-one")
+	mm.globalDynamicValuesPatches = utils.AppendValuesPatch(nil, *utils.MustValuesPatch(utils.ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/global/discovery", "value": "done"}
+]`))))
+	mm.saveDynamicValuesPatches(utils.GlobalValuesKey)
+	// Patches for absent modules are ignored on load.
+	err = storage.Save("module-absent", utils.AppendValuesPatch(nil, *utils.MustValuesPatch(utils.ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/moduleAbsent/a", "value": 1}
+]`)))))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	// Restart: patches are loaded from the storage.
+	mm.modulesDynamicValuesPatches = make(map[string][]utils.ValuesPatch)
+	mm.globalDynamicValuesPatches = make([]utils.ValuesPatch, 0)
+	mm.loadDynamicValuesPatches()
+
+	assert.Len(t, mm.modulesDynamicValuesPatches, 1)
+
+	values, err := mm.GetModule("module-one").Values()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, map[string]interface{}{"ready": true}, values["moduleOne"].(map[string]interface{})["internal"])
+	assert.Equal(t, "done", values["global"].(map[string]interface{})["discovery"])
+}
+
+func Test_MainModuleManager_MergeStrategies(t *testing.T) {
+	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+		return &helm.MockHelmClient{}
+	}
+	mm := NewMainModuleManager()
+
+	initModuleManager(t, mm, "merge_values__strategies")
+
+	values, err := mm.GetModule("module-one").Values()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	moduleValues := values["moduleOne"].(map[string]interface{})
+
+	// 'append': items from modules/values.yaml, module values.yaml and ConfigMap.
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "common", "operator": "Exists"},
+		map[string]interface{}{"key": "dedicated", "operator": "Exists"},
+		map[string]interface{}{"key": "node-role", "operator": "Exists"},
+	}, moduleValues["tolerations"])
+
+	// 'merge' by name with nested 'append' for args.
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "app", "image": "app:v2", "args": []interface{}{"--verbose", "--debug"}},
+		map[string]interface{}{"name": "sidecar", "image": "sidecar:v1"},
+		map[string]interface{}{"name": "exporter", "image": "exporter:v1"},
+	}, moduleValues["containers"])
+
+	// Default strategy is 'replace'.
+	assert.Equal(t, []interface{}{"b.example.com"}, moduleValues["hosts"])
+
+	// Layers are not changed by merge.
+	assert.Len(t, mm.GetModule("module-one").StaticConfig.Values["moduleOne"].(map[string]interface{})["tolerations"], 1)
+}
+
+func Test_MainModuleManager_CompactDynamicValuesPatches(t *testing.T) {
+	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+		return &helm.MockHelmClient{}
+	}
+	mm := NewMainModuleManager()
+	mm.WithValuesPatchesLimits(10, 0)
+
+	initModuleManager(t, mm, "validate_values__openapi")
+	module := mm.GetModule("module-one")
+
+	// The hook sets internal values as a whole and adds and removes keys in it. Replicas are set
+	// to the value from the ConfigMap.
+	initPatch := *utils.MustValuesPatch(utils.ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/moduleOne/internal", "value": {"hosts": ["a"]}},
+{"op": "add", "path": "/moduleOne/replicas", "value": 2}
+]`)))
+	mm.modulesDynamicValuesPatches["module-one"] = utils.AppendValuesPatch(nil, initPatch)
+	mm.addDynamicValuesPatchSource(initPatch, "hook.sh", OnStartup)
+	for i := 0; i < 20; i++ {
+		patch := *utils.MustValuesPatch(utils.ValuesPatchFromBytes([]byte(fmt.Sprintf(`[
+{"op": "add", "path": "/moduleOne/internal/key%d", "value": %d},
+{"op": "remove", "path": "/moduleOne/internal/key%d"}
+]`, i, i, i))))
+		if i == 19 {
+			patch = *utils.MustValuesPatch(utils.ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/moduleOne/internal/ready", "value": true}
+]`)))
+		}
+		mm.modulesDynamicValuesPatches["module-one"] = utils.AppendValuesPatch(mm.modulesDynamicValuesPatches["module-one"], patch)
+		mm.addDynamicValuesPatchSource(patch, "hook.sh", OnKubernetesEvent)
+	}
+
+	expected, err := module.Values()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.True(t, utils.ValuesPatchesOperationsCount(mm.modulesDynamicValuesPatches["module-one"]) > 10)
+	uncompacted := mm.modulesDynamicValuesPatches["module-one"]
+
+	mm.compactDynamicValuesPatches("module-one")
+
+	// Operations for internal keys are folded into one operation and values are identical.
+	assert.Equal(t, 2, utils.ValuesPatchesOperationsCount(mm.modulesDynamicValuesPatches["module-one"]))
+	actual, err := module.Values()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, expected, actual)
+
+	// ConfigMap is changed after compaction: values are identical to values with not compacted patches.
+	mm.kubeModulesConfigValues["module-one"] = utils.Values{
+		"moduleOne": map[string]interface{}{
+			"replicas": 3,
+			"internal": map[string]interface{}{"key1": 1},
+		},
+	}
+	actual, err = module.Values()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	compacted := mm.modulesDynamicValuesPatches["module-one"]
+	mm.modulesDynamicValuesPatches["module-one"] = uncompacted
+	expected, err = module.Values()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	mm.modulesDynamicValuesPatches["module-one"] = compacted
+	assert.Equal(t, expected, actual)
+	assert.Equal(t, 2.0, actual["moduleOne"].(map[string]interface{})["replicas"])
+
+	// The source of the value is kept.
+	explain, err := module.ValuesExplain()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	for _, item := range explain {
+		if item.Path == "/moduleOne/internal/ready" {
+			assert.Equal(t, "hook.sh", item.Source.Hook)
+		}
+	}
+
+	// Patches under limits are not compacted.
+	mm.WithValuesPatchesLimits(0, 0)
+	mm.modulesDynamicValuesPatches["module-one"] = utils.AppendValuesPatch(mm.modulesDynamicValuesPatches["module-one"], *utils.MustValuesPatch(utils.ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/moduleOne/internal/key", "value": 1},
+{"op": "remove", "path": "/moduleOne/internal/key"}
+]`))))
+	mm.compactDynamicValuesPatches("module-one")
+	assert.Equal(t, 4, utils.ValuesPatchesOperationsCount(mm.modulesDynamicValuesPatches["module-one"]))
+}
+
+func Test_MainModuleManager_GoEnabledFunc(t *testing.T) {
+	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+		return &helm.MockHelmClient{}
+	}
+	mm := NewMainModuleManager()
+	initModuleManager(t, mm, "discover_modules_state__enabled_expression")
+
+	var betaInput *sdk.EnabledInput
+	// Go function takes precedence over the 'enabled' expression of beta.
+	sdk.RegisterEnabledFunc("beta", func(input *sdk.EnabledInput) (bool, error) {
+		betaInput = input
+		return true, nil
+	})
+	defer sdk.RegisterEnabledFunc("beta", nil)
+
+	modulesState, err := mm.DiscoverModulesState(map[string]string{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	// delta is enabled after beta.
+	assert.Equal(t, []string{"alpha", "beta", "gamma", "delta"}, modulesState.EnabledModules)
+	if assert.NotNil(t, betaInput) {
+		assert.Equal(t, []string{"alpha"}, betaInput.EnabledModules)
+		assert.Equal(t, []string{"alpha"}, betaInput.Values["global"].(map[string]interface{})["enabledModules"])
+		assert.Equal(t, 0.0, betaInput.Values["beta"].(map[string]interface{})["replicas"])
+	}
+
+	sdk.RegisterEnabledFunc("beta", func(input *sdk.EnabledInput) (bool, error) {
+		return false, fmt.Errorf("cannot check beta")
+	})
+	_, err = mm.DiscoverModulesState(map[string]string{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,179 @@
+package module_manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/flant/libjq-go"
+	sh_app "github.com/flant/shell-operator/pkg/app"
+	"sigs.k8s.io/yaml"
+)
+
+// ModuleMetadataFileName is a name of the optional file with module metadata in the module directory.
+const ModuleMetadataFileName = "module.yaml"
+
+// ModuleMetadata is a content of the module.yaml file.
+type ModuleMetadata struct {
+	// Name is a name of the module. Default is a directory name without a weight prefix.
+	Name string `json:"name,omitempty"`
+	// Weight defines the order of modules. Default is a directory prefix or 0.
+	Weight      *int     `json:"weight,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Version     string   `json:"version,omitempty"`
+
+	// Requires is a list of modules that should be enabled for this module.
+	// The module is disabled if one of these modules is disabled.
+	Requires []string `json:"requires,omitempty"`
+	// After is a list of modules that should be run before this module if they are enabled.
+	After []string `json:"after,omitempty"`
+
+	// Enabled is a jq expression that returns the status of the module. It is evaluated
+	// instead of the enabled script with values for the enabled script as an input.
+	Enabled string `json:"enabled,omitempty"`
+}
+
+// Dependencies returns names of modules that should precede the module.
+func (m *ModuleMetadata) Dependencies() []string {
+	res := make([]string, 0, len(m.Requires)+len(m.After))
+	res = append(res, m.Requires...)
+	res = append(res, m.After...)
+	return res
+}
+
+// GetMetadata returns module metadata. Metadata is empty if the module has no module.yaml.
+func (m *Module) GetMetadata() *ModuleMetadata {
+	if m.Metadata == nil {
+		return &ModuleMetadata{}
+	}
+	return m.Metadata
+}
+
+// loadModuleMetadata loads module metadata from module.yaml in the module directory.
+// Metadata is nil if file is not exists. The 'enabled' expression is compiled to check its syntax.
+func loadModuleMetadata(modulePath string) (*ModuleMetadata, error) {
+	metadataPath := filepath.Join(modulePath, ModuleMetadataFileName)
+	if _, err := os.Stat(metadataPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(metadataPath)
+	if err != nil {
+		return nil, fmt.Errorf("read '%s': %s", metadataPath, err)
+	}
+
+	metadata := &ModuleMetadata{}
+	err = yaml.UnmarshalStrict(data, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("parse '%s': %s", metadataPath, err)
+	}
+
+	// A bad expression is an error of the module, not of each discovery.
+	if metadata.Enabled != "" {
+		_, err = Jq().WithLibPath(sh_app.JqLibraryPath).Program(metadata.Enabled).Precompile()
+		if err != nil {
+			return nil, fmt.Errorf("compile 'enabled' expression in '%s': %s", metadataPath, err)
+		}
+	}
+	return metadata, nil
+}
+
+// SortModulesByDependencies returns modules sorted so that each module follows modules
+// from its 'requires' and 'after' lists. Modules without dependencies between them keep
+// the order of weights. Unknown modules in dependencies are ignored: a module that
+// requires an unknown module is never enabled, and 'after' has no effect.
+//
+// An error is returned if dependencies have a cycle.
+func SortModulesByDependencies(modules []*Module) ([]*Module, error) {
+	known := make(map[string]bool, len(modules))
+	for _, module := range modules {
+		known[module.Name] = true
+	}
+
+	placed := make(map[string]bool, len(modules))
+	isReady := func(module *Module) bool {
+		for _, dep := range module.GetMetadata().Dependencies() {
+			if known[dep] && !placed[dep] {
+				return false
+			}
+		}
+		return true
+	}
+
+	res := make([]*Module, 0, len(modules))
+	pending := append([]*Module{}, modules...)
+	for len(pending) > 0 {
+		readyIdx := -1
+		for i, module := range pending {
+			if isReady(module) {
+				readyIdx = i
+				break
+			}
+		}
+		if readyIdx == -1 {
+			return nil, fmt.Errorf("modules dependency cycle: %s", strings.Join(dependencyCycle(pending, placed), " -> "))
+		}
+		res = append(res, pending[readyIdx])
+		placed[pending[readyIdx].Name] = true
+		pending = append(pending[:readyIdx], pending[readyIdx+1:]...)
+	}
+	return res, nil
+}
+
+// dependencyCycle returns names of modules in a cycle. Each pending module
+// has at least one pending dependency, so the walk always finds a cycle.
+func dependencyCycle(pending []*Module, placed map[string]bool) []string {
+	byName := make(map[string]*Module, len(pending))
+	for _, module := range pending {
+		byName[module.Name] = module
+	}
+
+	path := make([]string, 0)
+	visitedAt := make(map[string]int)
+	module := pending[0]
+	for {
+		if idx, visited := visitedAt[module.Name]; visited {
+			return append(path[idx:], module.Name)
+		}
+		visitedAt[module.Name] = len(path)
+		path = append(path, module.Name)
+
+		for _, dep := range module.GetMetadata().Dependencies() {
+			if next, has := byName[dep]; has && !placed[dep] {
+				module = next
+				break
+			}
+		}
+	}
+}
+
+// ModuleInfo is a description of the module for the module list.
+type ModuleInfo struct {
+	Name        string   `json:"name"`
+	Weight      int      `json:"weight"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	Requires    []string `json:"requires,omitempty"`
+	After       []string `json:"after,omitempty"`
+	// Path is a directory of the module. It shows which modules directory wins if modules have the same name.
+	Path string `json:"path"`
+}
+
+// Info returns a description of the module from its metadata.
+func (m *Module) Info() ModuleInfo {
+	metadata := m.GetMetadata()
+	return ModuleInfo{
+		Name:        m.Name,
+		Weight:      m.Weight,
+		Description: metadata.Description,
+		Tags:        metadata.Tags,
+		Version:     metadata.Version,
+		Requires:    metadata.Requires,
+		After:       metadata.After,
+		Path:        m.Path,
+	}
+}
@@ -0,0 +1,205 @@
+package module_manager
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flant/shell-operator/pkg/kube"
+
+	"github.com/flant/addon-operator/pkg/helm"
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/module_status"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func Test_SortModulesByDependencies(t *testing.T) {
+	newModule := func(name string, requires []string, after []string) *Module {
+		m := NewModule(name, "")
+		m.Metadata = &ModuleMetadata{Requires: requires, After: after}
+		return m
+	}
+	names := func(modules []*Module) []string {
+		res := make([]string, 0, len(modules))
+		for _, m := range modules {
+			res = append(res, m.Name)
+		}
+		return res
+	}
+
+	sorted, err := SortModulesByDependencies([]*Module{
+		newModule("a", []string{"c"}, nil),
+		newModule("b", nil, nil),
+		newModule("c", nil, []string{"d", "unknown"}),
+		newModule("d", nil, nil),
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"b", "d", "c", "a"}, names(sorted))
+	}
+
+	_, err = SortModulesByDependencies([]*Module{
+		newModule("a", nil, nil),
+		newModule("b", []string{"b"}, nil),
+	})
+	if assert.Error(t, err) {
+		assert.Equal(t, "modules dependency cycle: b -> b", err.Error())
+	}
+}
+
+func Test_MainModuleManager_ModuleDependencies(t *testing.T) {
+	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+		return &helm.MockHelmClient{}
+	}
+	mm := NewMainModuleManager()
+	reporter := module_status.NewStatusReporter()
+	reporter.WithKubeClient(kube.NewFakeKubernetesClient())
+	reporter.WithNamespace("default")
+	reporter.WithConfigMapName("addon-operator-status")
+	mm.WithModuleStatusReporter(reporter)
+
+	initModuleManager(t, mm, "discover_modules_state__dependencies")
+
+	assert.Equal(t, []string{"dns", "ingress-nginx", "cert-manager", "prometheus", "monitoring"}, mm.allModulesNamesInOrder)
+
+	modulesState, err := mm.DiscoverModulesState(map[string]string{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	// monitoring requires disabled prometheus.
+	assert.Equal(t, []string{"dns", "ingress-nginx", "cert-manager"}, modulesState.EnabledModules)
+	// Disabled modules were never enabled and have no releases.
+	assert.Equal(t, []string{}, modulesState.ModulesToDisable)
+	assert.Equal(t, "required modules are not enabled: prometheus", reporter.Statuses()["monitoring"].DisabledReason)
+
+	// Disabled ingress-nginx disables cert-manager, dns is still enabled.
+	mm.dynamicEnabled["ingress-nginx"] = &utils.ModuleDisabled
+	modulesState, err = mm.DiscoverModulesState(map[string]string{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"dns"}, modulesState.EnabledModules)
+	assert.Equal(t, []string{"cert-manager", "ingress-nginx"}, modulesState.ModulesToDisable)
+	assert.Equal(t, "required modules are not enabled: ingress-nginx", reporter.Statuses()["cert-manager"].DisabledReason)
+	assert.Equal(t, "", reporter.Statuses()["ingress-nginx"].DisabledReason)
+}
+
+func Test_MainModuleManager_ModuleDependenciesCycle(t *testing.T) {
+	mm := NewMainModuleManager()
+	tempDir, err := ioutil.TempDir("", "addon-operator-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootDir := filepath.Join("testdata", "discover_modules_state__dependencies_cycle")
+	mm.WithDirectories(filepath.Join(rootDir, "modules"), filepath.Join(rootDir, "global-hooks"), tempDir)
+
+	err = mm.RegisterModules()
+	if assert.Error(t, err) {
+		assert.Equal(t, "modules dependency cycle: alpha -> gamma -> beta -> alpha", err.Error())
+	}
+}
+
+func Test_SearchModules_Metadata(t *testing.T) {
+	modulesDir := filepath.Join("testdata", "search_modules__metadata", "modules")
+	modules, err := SearchModules(modulesDir)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	infos := make([]ModuleInfo, 0, len(modules))
+	for _, m := range modules {
+		infos = append(infos, m.Info())
+	}
+	assert.Equal(t, []ModuleInfo{
+		{Name: "plain-module", Weight: 0, Path: filepath.Join(modulesDir, "plain-module")},
+		{
+			Name:        "custom-name",
+			Weight:      50,
+			Description: "A module with metadata.",
+			Tags:        []string{"network", "example"},
+			Version:     "1.2.0",
+			Path:        filepath.Join(modulesDir, "200-renamed"),
+		},
+		{Name: "prefixed", Weight: 100, Path: filepath.Join(modulesDir, "100-prefixed")},
+	}, infos)
+
+	_, err = SearchModules(filepath.Join("testdata", "search_modules__duplicate_names", "modules"))
+	assert.Error(t, err)
+}
+
+func Test_SearchModules_BadEnabledExpression(t *testing.T) {
+	modulesDir := filepath.Join("testdata", "search_modules__bad_enabled_expression", "modules")
+	_, err := SearchModules(modulesDir)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), filepath.Join(modulesDir, "010-alpha", ModuleMetadataFileName))
+		assert.Contains(t, err.Error(), "compile 'enabled' expression")
+	}
+}
+
+func Test_MainModuleManager_OverrideDirectories(t *testing.T) {
+	rootDir := filepath.Join("testdata", "search_modules__override")
+	coreDir := filepath.Join(rootDir, "core")
+	customDir := filepath.Join(rootDir, "custom")
+
+	mm := NewMainModuleManager()
+	mm.WithDirectories(
+		filepath.Join(coreDir, "modules")+string(filepath.ListSeparator)+filepath.Join(customDir, "modules"),
+		filepath.Join(coreDir, "global-hooks")+string(filepath.ListSeparator)+filepath.Join(customDir, "global-hooks"),
+		"",
+	)
+
+	err := mm.RegisterModules()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"alpha", "beta", "gamma"}, mm.allModulesNamesInOrder)
+	beta := mm.GetModule("beta")
+	assert.Equal(t, filepath.Join(customDir, "modules", "020-beta"), beta.Info().Path)
+	assert.Equal(t, "Custom beta.", beta.Info().Description)
+	assert.Equal(t, filepath.Join(coreDir, "modules", "010-alpha"), mm.GetModule("alpha").Info().Path)
+
+	// values.yaml files are merged in the order of directories.
+	assert.Equal(t, utils.Values{
+		"global": map[string]interface{}{
+			"param1": "core",
+			"param2": "custom",
+		},
+		"alphaEnabled": true,
+	}, mm.commonStaticValues)
+
+	hooks, err := SearchGlobalHooks(mm.globalHooksDirs())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	shellHookPaths := make(map[string]string)
+	for _, h := range hooks {
+		if h.GoHook == nil {
+			shellHookPaths[h.Name] = h.Path
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"000-a.sh": filepath.Join(coreDir, "global-hooks", "000-a.sh"),
+		"100-b.sh": filepath.Join(customDir, "global-hooks", "100-b.sh"),
+	}, shellHookPaths)
+}
+
+func Test_MainModuleManager_EnabledExpression(t *testing.T) {
+	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+		return &helm.MockHelmClient{}
+	}
+	mm := NewMainModuleManager()
+	initModuleManager(t, mm, "discover_modules_state__enabled_expression")
+
+	modulesState, err := mm.DiscoverModulesState(map[string]string{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	// beta has no replicas, gamma follows enabled alpha, delta ignores its enabled script.
+	assert.Equal(t, []string{"alpha", "gamma"}, modulesState.EnabledModules)
+
+	// A non-boolean result is an error.
+	mm.GetModule("alpha").Metadata.Enabled = ".alpha.replicas"
+	_, err = mm.DiscoverModulesState(map[string]string{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,314 @@
+package module_manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	. "github.com/flant/shell-operator/pkg/hook/types"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// ModuleReloadResult describes actions needed after the module is reloaded from disk.
+type ModuleReloadResult struct {
+	// Module is added, removed or its order, metadata or enabled state can be changed:
+	// modules discovery is needed.
+	DiscoveryNeeded bool
+	// Module is enabled and its hooks are re-registered: ModuleRun is needed.
+	RunNeeded bool
+	// Module is removed from modules directories.
+	Removed bool
+}
+
+// dirsSnapshot contains checksums of modules and global hooks directories.
+type dirsSnapshot struct {
+	// Checksums of module directories by module name.
+	modules map[string]string
+	// Checksum of global hooks directories and common values.yaml files.
+	global string
+}
+
+// WithDirsWatchInterval sets an interval to check directories for changes. Directories are not watched if 0.
+func (mm *moduleManager) WithDirsWatchInterval(interval time.Duration) {
+	mm.dirsWatchInterval = interval
+}
+
+// takeDirsSnapshot calculates checksums of all modules and global hooks directories.
+func (mm *moduleManager) takeDirsSnapshot() (*dirsSnapshot, error) {
+	modules, err := SearchModulesInDirs(mm.modulesDirs())
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &dirsSnapshot{
+		modules: make(map[string]string, len(modules)),
+	}
+	for _, module := range modules {
+		checksum, err := utils.CalculateChecksumOfDirectory(module.Path)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.modules[module.Name] = fmt.Sprintf("%s:%s", module.Path, checksum)
+	}
+
+	globalChecksums := make([]string, 0)
+	for _, hooksDir := range mm.globalHooksDirs() {
+		if _, err := os.Stat(hooksDir); os.IsNotExist(err) {
+			continue
+		}
+		checksum, err := utils.CalculateChecksumOfDirectory(hooksDir)
+		if err != nil {
+			return nil, err
+		}
+		globalChecksums = append(globalChecksums, fmt.Sprintf("%s:%s", hooksDir, checksum))
+	}
+	for _, modulesDir := range mm.modulesDirs() {
+		valuesPath := filepath.Join(modulesDir, "values.yaml")
+		if _, err := os.Stat(valuesPath); os.IsNotExist(err) {
+			continue
+		}
+		checksum, err := utils.CalculateChecksumOfFile(valuesPath)
+		if err != nil {
+			return nil, err
+		}
+		globalChecksums = append(globalChecksums, fmt.Sprintf("%s:%s", valuesPath, checksum))
+	}
+	snapshot.global = utils.CalculateStringsChecksum(globalChecksums...)
+
+	return snapshot, nil
+}
+
+// changedModules returns names of added, changed and removed modules sorted by name.
+func (s *dirsSnapshot) changedModules(newSnapshot *dirsSnapshot) []string {
+	res := make([]string, 0)
+	for name, checksum := range newSnapshot.modules {
+		if s.modules[name] != checksum {
+			res = append(res, name)
+		}
+	}
+	for name := range s.modules {
+		if _, has := newSnapshot.modules[name]; !has {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// watchDirs periodically compares checksums of directories with the last snapshot
+// and sends events for changed modules and global hooks.
+func (mm *moduleManager) watchDirs() {
+	ticker := time.NewTicker(mm.dirsWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mm.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		snapshot, err := mm.takeDirsSnapshot()
+		if err != nil {
+			// Files can be in the middle of an update, try again on the next tick.
+			log.Errorf("MODULE_MANAGER_WATCH check directories: %s", err)
+			continue
+		}
+
+		if snapshot.global != mm.dirsSnapshot.global {
+			log.Infof("MODULE_MANAGER_WATCH global hooks or common values are changed")
+			mm.EventCh <- Event{Type: GlobalFilesChanged}
+		}
+
+		changed := mm.dirsSnapshot.changedModules(snapshot)
+		if len(changed) > 0 {
+			log.Infof("MODULE_MANAGER_WATCH files of modules %v are changed", changed)
+			event := Event{Type: ModuleFilesChanged}
+			for _, name := range changed {
+				event.ModulesChanges = append(event.ModulesChanges, ModuleChange{Name: name, ChangeType: Changed})
+			}
+			mm.EventCh <- event
+		}
+
+		mm.dirsSnapshot = snapshot
+	}
+}
+
+// ReloadModule searches the module in modules directories and replaces the registered module.
+// Hooks of the old module are stopped and unregistered. The new module has an initial state,
+// so its onStartup hooks and Synchronization are run again on the next ModuleRun.
+func (mm *moduleManager) ReloadModule(moduleName string, logLabels map[string]string) (*ModuleReloadResult, error) {
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels)).WithField("module", moduleName)
+	res := &ModuleReloadResult{}
+
+	// Check all modules to keep a valid order before changing indexes.
+	modules, err := SearchModulesInDirs(mm.modulesDirs())
+	if err != nil {
+		return nil, err
+	}
+	modules, err = SortModulesByDependencies(modules)
+	if err != nil {
+		return nil, err
+	}
+
+	var newModule *Module
+	newOrder := make([]string, 0, len(modules))
+	for _, module := range modules {
+		if module.Name == moduleName {
+			newModule = module
+		}
+		// Other new modules are registered by their own reload.
+		if _, has := mm.allModulesByName[module.Name]; has || module.Name == moduleName {
+			newOrder = append(newOrder, module.Name)
+		}
+	}
+	// Other removed modules are kept until their own reload.
+	newOrder = append(newOrder, utils.ListSubtract(mm.allModulesNamesInOrder, newOrder, []string{moduleName})...)
+
+	oldModule := mm.allModulesByName[moduleName]
+	if oldModule == nil && newModule == nil {
+		logEntry.Infof("Module is not registered and not found in modules directories, nothing to reload")
+		return res, nil
+	}
+
+	if newModule != nil {
+		newModule.WithModuleManager(mm)
+		newModule.WithMetricStorage(mm.metricStorage)
+		if err := newModule.loadStaticValues(); err != nil {
+			return nil, fmt.Errorf("load values.yaml: %s", err)
+		}
+		if err := newModule.loadValuesSchemas(); err != nil {
+			return nil, fmt.Errorf("load OpenAPI schemas: %s", err)
+		}
+	}
+
+	isEnabled := false
+	for _, name := range mm.enabledModulesInOrder {
+		if name == moduleName {
+			isEnabled = true
+		}
+	}
+
+	if oldModule != nil {
+		// Stop informers and schedules of old hooks.
+		mm.DisableModuleHooks(moduleName)
+		delete(mm.modulesHooksOrderByName, moduleName)
+	}
+
+	res.DiscoveryNeeded = oldModule == nil || newModule == nil ||
+		!reflect.DeepEqual(mm.allModulesNamesInOrder, newOrder) ||
+		!reflect.DeepEqual(oldModule.GetMetadata(), newModule.GetMetadata()) ||
+		oldModule.staticEnabled() != newModule.staticEnabled() ||
+		oldModule.EnabledScriptChecksum != newModule.EnabledScriptChecksum
+
+	if oldModule != nil && newModule != nil {
+		newModule.LastReleaseManifests = oldModule.LastReleaseManifests
+	}
+
+	// Readers in other goroutines use copies of the index, see modulesIndex.
+	mm.modulesLock.Lock()
+	mm.allModulesNamesInOrder = newOrder
+	if newModule == nil {
+		delete(mm.allModulesByName, moduleName)
+	} else {
+		mm.allModulesByName[moduleName] = newModule
+	}
+	mm.modulesLock.Unlock()
+
+	if newModule == nil {
+		res.Removed = true
+		// Helm release of the removed module is purged as a release of an unknown module.
+		mm.enabledCache.Delete(moduleName)
+		if mm.HelmResourcesManager != nil {
+			mm.HelmResourcesManager.StopMonitor(moduleName)
+		}
+		mm.enabledModulesByConfig = utils.ListSubtract(mm.enabledModulesByConfig, []string{moduleName})
+		mm.enabledModulesInOrder = utils.ListSubtract(mm.enabledModulesInOrder, []string{moduleName})
+		logEntry.Infof("Module '%s' is removed", moduleName)
+		return res, nil
+	}
+
+	mm.kubeConfigManager.SetSensitivePaths(moduleName, mm.ValuesValidator.ModuleSensitivePaths(moduleName))
+	mm.resetSensitivePaths()
+	logEntry.Infof("Module '%s' is reloaded from '%s'", moduleName, newModule.Path)
+
+	if res.DiscoveryNeeded {
+		// Hooks are registered by discovery, module should run its onStartup hooks if it is still enabled.
+		mm.reloadedModules = utils.ListUnion(mm.reloadedModules, []string{moduleName})
+		return res, nil
+	}
+
+	if isEnabled {
+		if err := mm.RegisterModuleHooks(newModule, logLabels); err != nil {
+			return nil, err
+		}
+		res.RunNeeded = true
+	}
+
+	return res, nil
+}
+
+// ReloadGlobalHooks stops and re-registers global hooks and reloads common static values
+// and global schemas from directories.
+func (mm *moduleManager) ReloadGlobalHooks(logLabels map[string]string) error {
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+
+	for _, hookName := range mm.GetGlobalHooksInOrder(OnKubernetesEvent) {
+		mm.GetGlobalHook(hookName).HookController.StopMonitors()
+	}
+	for _, hookName := range mm.GetGlobalHooksInOrder(Schedule) {
+		mm.GetGlobalHook(hookName).HookController.DisableScheduleBindings()
+	}
+	// Synchronization of new hooks starts from scratch.
+	mm.kubernetesBindingSynchronizationState = make(map[string]*KubernetesBindingSynchronizationState)
+
+	if err := mm.RegisterGlobalHooks(); err != nil {
+		return err
+	}
+
+	mm.commonStaticValues = make(utils.Values)
+	if err := mm.loadCommonStaticValues(); err != nil {
+		return fmt.Errorf("load common values for modules: %s", err)
+	}
+	if err := mm.loadGlobalValuesSchemas(); err != nil {
+		return err
+	}
+	for _, moduleName := range mm.allModulesNamesInOrder {
+		if err := mm.allModulesByName[moduleName].loadStaticValues(); err != nil {
+			return fmt.Errorf("load values.yaml of module '%s': %s", moduleName, err)
+		}
+	}
+
+	mm.kubeConfigManager.SetSensitivePaths(utils.GlobalValuesKey, mm.ValuesValidator.GlobalSensitivePaths())
+	mm.resetSensitivePaths()
+
+	logEntry.Infof("Global hooks are reloaded")
+	return nil
+}
+
+// resetSensitivePaths replaces patterns registered by this module manager with patterns from current schemas.
+// Patterns from the command line and from other module managers are kept.
+func (mm *moduleManager) resetSensitivePaths() {
+	utils.ReplaceSensitivePaths(mm, mm.ValuesValidator.SensitivePathPatterns()...)
+}
+
+// staticEnabled returns a module enabled flag from values.yaml files.
+func (m *Module) staticEnabled() bool {
+	return mergeEnabled(m.CommonStaticConfig.IsEnabled, m.StaticConfig.IsEnabled)
+}
+
+// enabledScriptFileChecksum returns a checksum of the enabled script file or an empty string if there is no script.
+// The file can be changed after the module is found, the checksum at that moment is in EnabledScriptChecksum.
+func (m *Module) enabledScriptFileChecksum() string {
+	checksum, err := utils.CalculateChecksumOfFile(filepath.Join(m.Path, "enabled"))
+	if err != nil {
+		return ""
+	}
+	return checksum
+}
@@ -0,0 +1,247 @@
+package module_manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flant/addon-operator/pkg/helm"
+	"github.com/flant/addon-operator/pkg/helm/client"
+)
+
+// copyDir copies the directory with a fixture to modify files in tests.
+func copyDir(t *testing.T, src string, dst string) {
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		dstPath := filepath.Join(dst, relPath)
+		if info.IsDir() {
+			return os.MkdirAll(dstPath, info.Mode())
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(dstPath, data, info.Mode())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_MainModuleManager_ReloadModule(t *testing.T) {
+	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+		return &helm.MockHelmClient{}
+	}
+
+	tempDir, err := ioutil.TempDir("", "addon-operator-reload-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	copyDir(t, filepath.Join("testdata", "reload_module"), tempDir)
+	modulesDir := filepath.Join(tempDir, "modules")
+
+	mm := NewMainModuleManager()
+	// initModuleManager expects a path relative to testdata.
+	testdataDir, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath, err := filepath.Rel(testdataDir, tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initModuleManager(t, mm, configPath)
+
+	_, err = mm.DiscoverModulesState(map[string]string{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"alpha", "beta"}, mm.enabledModulesInOrder)
+
+	snapshot, err := mm.takeDirsSnapshot()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	// Changed values.yaml: module is re-registered and should be run.
+	oldBeta := mm.GetModule("beta")
+	err = ioutil.WriteFile(filepath.Join(modulesDir, "020-beta", "values.yaml"), []byte("beta:\n  replicas: 2\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSnapshot, err := mm.takeDirsSnapshot()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"beta"}, snapshot.changedModules(newSnapshot))
+	assert.Equal(t, snapshot.global, newSnapshot.global)
+
+	res, err := mm.ReloadModule("beta", map[string]string{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, &ModuleReloadResult{DiscoveryNeeded: false, RunNeeded: true}, res)
+	}
+	assert.False(t, oldBeta == mm.GetModule("beta"), "module should be a new object")
+	values, err := mm.GetModule("beta").Values()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2.0, values["beta"].(map[string]interface{})["replicas"])
+	}
+
+	// New enabled script: the checksum of the registered module differs, discovery is needed.
+	err = ioutil.WriteFile(filepath.Join(modulesDir, "020-beta", "enabled"), []byte("#!/bin/bash\necho true > $MODULE_ENABLED_RESULT\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = mm.ReloadModule("beta", map[string]string{})
+	if assert.NoError(t, err) {
+		assert.True(t, res.DiscoveryNeeded)
+	}
+
+	// Edited enabled script: discovery is needed.
+	err = ioutil.WriteFile(filepath.Join(modulesDir, "020-beta", "enabled"), []byte("#!/bin/bash\necho 'true' > $MODULE_ENABLED_RESULT\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = mm.ReloadModule("beta", map[string]string{})
+	if assert.NoError(t, err) {
+		assert.True(t, res.DiscoveryNeeded)
+	}
+
+	// Unchanged enabled script: discovery is not needed.
+	res, err = mm.ReloadModule("beta", map[string]string{})
+	if assert.NoError(t, err) {
+		assert.False(t, res.DiscoveryNeeded)
+	}
+	modulesState, err := mm.DiscoverModulesState(map[string]string{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"alpha", "beta"}, modulesState.EnabledModules)
+	}
+
+	// New module: discovery is needed, the module runs as newly enabled.
+	snapshot, err = mm.takeDirsSnapshot()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	err = os.MkdirAll(filepath.Join(modulesDir, "030-gamma"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSnapshot, err = mm.takeDirsSnapshot()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"gamma"}, snapshot.changedModules(newSnapshot))
+
+	res, err = mm.ReloadModule("gamma", map[string]string{})
+	if assert.NoError(t, err) {
+		assert.True(t, res.DiscoveryNeeded)
+	}
+	assert.Equal(t, []string{"alpha", "beta", "gamma"}, mm.allModulesNamesInOrder)
+
+	modulesState, err = mm.DiscoverModulesState(map[string]string{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"alpha", "beta", "gamma"}, modulesState.EnabledModules)
+		assert.Equal(t, []string{"gamma"}, modulesState.NewlyEnabledModules)
+	}
+
+	// Removed module: discovery is needed, the module is unregistered.
+	err = os.RemoveAll(filepath.Join(modulesDir, "010-alpha"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot = newSnapshot
+	newSnapshot, err = mm.takeDirsSnapshot()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"alpha"}, snapshot.changedModules(newSnapshot))
+
+	res, err = mm.ReloadModule("alpha", map[string]string{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, &ModuleReloadResult{DiscoveryNeeded: true, Removed: true}, res)
+	}
+	assert.Nil(t, mm.allModulesByName["alpha"])
+	assert.Equal(t, []string{"beta", "gamma"}, mm.allModulesNamesInOrder)
+	assert.Equal(t, []string{"beta", "gamma"}, mm.enabledModulesInOrder)
+}
+
+// Config handlers and the webhook read modules while modules are reloaded in the main goroutine.
+// Run with -race to detect unguarded access to the modules index.
+func Test_MainModuleManager_ReloadModule_ConcurrentReads(t *testing.T) {
+	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+		return &helm.MockHelmClient{}
+	}
+
+	tempDir, err := ioutil.TempDir("", "addon-operator-reload-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	copyDir(t, filepath.Join("testdata", "reload_module"), tempDir)
+	modulesDir := filepath.Join(tempDir, "modules")
+
+	mm := NewMainModuleManager()
+	testdataDir, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath, err := filepath.Rel(testdataDir, tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initModuleManager(t, mm, configPath)
+
+	_, err = mm.DiscoverModulesState(map[string]string{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	kubeConfig := mm.kubeConfigManager.CurrentConfig()
+
+	done := make(chan struct{})
+	read := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			mm.ValidateKubeConfig(kubeConfig)
+			mm.calculateEnabledModulesByConfig(kubeConfig.ModuleConfigs)
+			mm.GetModule("alpha")
+			select {
+			case <-done:
+				return
+			case read <- struct{}{}:
+			}
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		// The reader starts the next read while the module is reloaded.
+		<-read
+		if i%2 == 0 {
+			err = os.MkdirAll(filepath.Join(modulesDir, "030-gamma"), 0755)
+		} else {
+			err = os.RemoveAll(filepath.Join(modulesDir, "030-gamma"))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = mm.ReloadModule("gamma", map[string]string{})
+		assert.NoError(t, err)
+	}
+	close(done)
+	wg.Wait()
+
+	assert.Equal(t, []string{"alpha", "beta"}, mm.allModulesNamesInOrder)
+}
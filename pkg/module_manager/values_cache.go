@@ -0,0 +1,97 @@
+package module_manager
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// valuesCache stores effective values for the global section and for modules.
+//
+// Values are computed from static values, ConfigMap values, schemas and dynamic patches.
+// These inputs are never changed in place: new values and new patch lists replace
+// previous ones. So an entry is valid while references to its inputs are the same.
+// An entry keeps references to inputs, so their memory cannot be reused for new inputs.
+type valuesCache struct {
+	m       sync.Mutex
+	entries map[string]valuesCacheEntry
+}
+
+type valuesCacheEntry struct {
+	inputs []interface{}
+	values utils.Values
+}
+
+func newValuesCache() *valuesCache {
+	return &valuesCache{
+		entries: make(map[string]valuesCacheEntry),
+	}
+}
+
+// Get returns a copy of cached values for the key if inputs are not changed.
+// Otherwise, values are computed with compute and cached.
+func (c *valuesCache) Get(key string, inputs []interface{}, compute func() (utils.Values, error)) (utils.Values, error) {
+	c.m.Lock()
+	entry, has := c.entries[key]
+	c.m.Unlock()
+	if has && sameInputs(entry.inputs, inputs) {
+		return entry.values.Copy(), nil
+	}
+
+	values, err := compute()
+	if err != nil {
+		return nil, err
+	}
+
+	c.m.Lock()
+	c.entries[key] = valuesCacheEntry{
+		inputs: inputs,
+		values: values.Copy(),
+	}
+	c.m.Unlock()
+
+	return values, nil
+}
+
+// Reset removes all entries.
+func (c *valuesCache) Reset() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.entries = make(map[string]valuesCacheEntry)
+}
+
+// sameInputs compares inputs by reference: maps and slices are the same if they point
+// to the same memory and have the same length, pointers are compared as is.
+func sameInputs(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameInput(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameInput(a, b interface{}) bool {
+	va := reflect.ValueOf(a)
+	vb := reflect.ValueOf(b)
+	if !va.IsValid() || !vb.IsValid() {
+		return va.IsValid() == vb.IsValid()
+	}
+	if va.Kind() != vb.Kind() || va.Type() != vb.Type() {
+		return false
+	}
+	switch va.Kind() {
+	case reflect.Map, reflect.Slice:
+		if va.IsNil() != vb.IsNil() {
+			return false
+		}
+		return va.Pointer() == vb.Pointer() && va.Len() == vb.Len()
+	case reflect.Ptr:
+		return va.Pointer() == vb.Pointer()
+	}
+	return a == b
+}
@@ -0,0 +1,117 @@
+package module_manager
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flant/addon-operator/pkg/helm"
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func Test_MainModuleManager_ValuesCache(t *testing.T) {
+	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+		return &helm.MockHelmClient{}
+	}
+	mm := NewMainModuleManager()
+
+	initModuleManager(t, mm, "validate_values__openapi")
+	module := mm.GetModule("module-one")
+
+	values, err := module.Values()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, 2.0, values["moduleOne"].(map[string]interface{})["replicas"])
+
+	// Changes in returned values do not change cached values.
+	values["moduleOne"].(map[string]interface{})["replicas"] = 10.0
+	values, err = module.Values()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, 2.0, values["moduleOne"].(map[string]interface{})["replicas"])
+
+	// New patches invalidate cached values.
+	mm.modulesDynamicValuesPatches["module-one"] = utils.AppendValuesPatch(mm.modulesDynamicValuesPatches["module-one"], *utils.MustValuesPatch(utils.ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/moduleOne/replicas", "value": 3}
+]`))))
+	values, err = module.Values()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, 3.0, values["moduleOne"].(map[string]interface{})["replicas"])
+
+	// New ConfigMap values invalidate cached values.
+	mm.kubeGlobalConfigValues = utils.Values{"global": map[string]interface{}{"clusterName": "test"}}
+	values, err = module.Values()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "test", values["global"].(map[string]interface{})["clusterName"])
+
+	globalValues, err := mm.GlobalValues()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "test", globalValues["global"].(map[string]interface{})["clusterName"])
+
+	// Enabled modules are not cached.
+	mm.enabledModulesInOrder = []string{"module-one"}
+	values, err = module.Values()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"module-one"}, values["global"].(map[string]interface{})["enabledModules"])
+}
+
+func Test_SameInputs(t *testing.T) {
+	a := utils.Values{"a": 1}
+	b := utils.Values{"a": 1}
+	patches := []utils.ValuesPatch{{}, {}}
+
+	assert.True(t, sameInputs([]interface{}{a, patches, nil}, []interface{}{a, patches, nil}))
+	assert.False(t, sameInputs([]interface{}{a}, []interface{}{b}))
+	assert.False(t, sameInputs([]interface{}{patches}, []interface{}{patches[:1]}))
+	assert.False(t, sameInputs([]interface{}{a}, []interface{}{nil}))
+	assert.True(t, sameInputs([]interface{}{utils.Values(nil)}, []interface{}{utils.Values(nil)}))
+}
+
+// Benchmark_ModuleValues compares cached and computed values of a module with many patches.
+func Benchmark_ModuleValues(b *testing.B) {
+	helm.NewClient = func(logLabels ...map[string]string) client.HelmClient {
+		return &helm.MockHelmClient{}
+	}
+
+	for _, patchesCount := range []int{10, 100, 500} {
+		mm := NewMainModuleManager()
+		initModuleManager(b, mm, "validate_values__openapi")
+		module := mm.GetModule("module-one")
+
+		// Patches for different paths are not compacted.
+		for i := 0; i < patchesCount; i++ {
+			patch := utils.MustValuesPatch(utils.ValuesPatchFromBytes([]byte(fmt.Sprintf(`[
+{"op": "add", "path": "/moduleOne/internal/key%d", "value": %d}
+]`, i, i))))
+			mm.modulesDynamicValuesPatches["module-one"] = utils.AppendValuesPatch(mm.modulesDynamicValuesPatches["module-one"], *patch)
+		}
+
+		b.Run(fmt.Sprintf("computed/%d", patchesCount), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := module.constructValuesWithProvenance(nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("cached/%d", patchesCount), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := module.Values(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package module_status
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/yaml"
+
+	"github.com/flant/shell-operator/pkg/kube"
+
+	"github.com/flant/addon-operator/pkg/kube_config_manager"
+)
+
+// Results of the last run.
+const (
+	RunSuccess = "Success"
+	RunFail    = "Fail"
+)
+
+// ModuleStatus is a status of the module or of the global section in the status ConfigMap.
+type ModuleStatus struct {
+	Enabled bool `json:"enabled"`
+	// ConfigChecksum is a checksum of config values applied by the last successful ModuleRun.
+	ConfigChecksum string `json:"configChecksum,omitempty"`
+	// ValidationErrors are last values validation errors by the source of values.
+	ValidationErrors map[string]string `json:"validationErrors,omitempty"`
+	// DisabledReason is set if the module is disabled because of its dependencies.
+	DisabledReason string     `json:"disabledReason,omitempty"`
+	LastRun        *RunStatus `json:"lastRun,omitempty"`
+}
+
+// RunStatus is a result of the last ModuleRun or ModuleDelete task.
+// Time is the time of the run that changed the result.
+type RunStatus struct {
+	Result string    `json:"result"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// NewRunStatus returns a RunStatus for the task error.
+func NewRunStatus(err error, t time.Time) *RunStatus {
+	if err != nil {
+		return &RunStatus{Result: RunFail, Error: err.Error(), Time: t.UTC()}
+	}
+	return &RunStatus{Result: RunSuccess, Time: t.UTC()}
+}
+
+// StatusReporter writes statuses of modules into a ConfigMap: a key per module
+// and the 'global' key with YAML encoded ModuleStatus. The ConfigMap is updated only
+// if the status is changed, so 'kubectl get' shows whether a change in the config is applied.
+//
+// Methods are safe to call on nil StatusReporter, they do nothing.
+type StatusReporter struct {
+	KubeClient    kube.KubernetesClient
+	Namespace     string
+	ConfigMapName string
+
+	m        sync.Mutex
+	statuses map[string]ModuleStatus
+}
+
+func NewStatusReporter() *StatusReporter {
+	return &StatusReporter{
+		statuses: make(map[string]ModuleStatus),
+	}
+}
+
+func (r *StatusReporter) WithKubeClient(client kube.KubernetesClient) {
+	r.KubeClient = client
+}
+
+func (r *StatusReporter) WithNamespace(namespace string) {
+	r.Namespace = namespace
+}
+
+func (r *StatusReporter) WithConfigMapName(name string) {
+	r.ConfigMapName = name
+}
+
+// Update changes the status of the section ('global' or module name) with updateFunc
+// and saves it into the ConfigMap if the status is changed.
+func (r *StatusReporter) Update(section string, updateFunc func(status *ModuleStatus)) error {
+	if r == nil {
+		return nil
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	status := copyStatus(r.statuses[section])
+	updateFunc(&status)
+	// The time of the run with the same result is not a change, or the ConfigMap is written on every run.
+	if lastRun := r.statuses[section].LastRun; lastRun != nil && status.LastRun != nil &&
+		lastRun.Result == status.LastRun.Result && lastRun.Error == status.LastRun.Error {
+		status.LastRun.Time = lastRun.Time
+	}
+	if reflect.DeepEqual(status, r.statuses[section]) {
+		return nil
+	}
+
+	err := r.save(section, status)
+	if err != nil {
+		return fmt.Errorf("save status of '%s' to ConfigMap/%s: %s", section, r.ConfigMapName, err)
+	}
+	r.statuses[section] = status
+	return nil
+}
+
+// Statuses returns last saved statuses by section.
+func (r *StatusReporter) Statuses() map[string]ModuleStatus {
+	res := make(map[string]ModuleStatus)
+	if r == nil {
+		return res
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	for section, status := range r.statuses {
+		res[section] = copyStatus(status)
+	}
+	return res
+}
+
+// save puts the status into the ConfigMap. Only the key of the section is changed,
+// so conflicts are retried with the actual ConfigMap.
+func (r *StatusReporter) save(section string, status ModuleStatus) error {
+	data, err := yaml.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	return retry.OnError(kube_config_manager.ConflictRetry, kube_config_manager.IsConflict, func() error {
+		obj, err := r.KubeClient.CoreV1().ConfigMaps(r.Namespace).Get(r.ConfigMapName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			obj = &v1.ConfigMap{}
+			obj.Name = r.ConfigMapName
+			obj.Data = map[string]string{section: string(data)}
+			_, err = r.KubeClient.CoreV1().ConfigMaps(r.Namespace).Create(obj)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if obj.Data == nil {
+			obj.Data = make(map[string]string)
+		}
+		obj.Data[section] = string(data)
+		_, err = r.KubeClient.CoreV1().ConfigMaps(r.Namespace).Update(obj)
+		if err == nil {
+			log.Debugf("Status of '%s' is saved to ConfigMap/%s", section, r.ConfigMapName)
+		}
+		return err
+	})
+}
+
+func copyStatus(status ModuleStatus) ModuleStatus {
+	res := status
+	if status.ValidationErrors != nil {
+		res.ValidationErrors = make(map[string]string, len(status.ValidationErrors))
+		for source, msg := range status.ValidationErrors {
+			res.ValidationErrors[source] = msg
+		}
+	}
+	if status.LastRun != nil {
+		lastRun := *status.LastRun
+		res.LastRun = &lastRun
+	}
+	return res
+}
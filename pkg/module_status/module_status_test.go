@@ -0,0 +1,138 @@
+package module_status
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/flant/shell-operator/pkg/kube"
+)
+
+func Test_StatusReporter_Update(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := kube.NewFakeKubernetesClient()
+	reporter := NewStatusReporter()
+	reporter.WithKubeClient(kubeClient)
+	reporter.WithNamespace("default")
+	reporter.WithConfigMapName("addon-operator-status")
+
+	runTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := reporter.Update("module-one", func(status *ModuleStatus) {
+		status.Enabled = true
+		status.ConfigChecksum = "123"
+		status.LastRun = NewRunStatus(nil, runTime)
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	err = reporter.Update("module-two", func(status *ModuleStatus) {
+		status.ValidationErrors = map[string]string{"ConfigMap": "bad value"}
+		status.LastRun = NewRunStatus(fmt.Errorf("helm failed"), runTime)
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	obj, err := kubeClient.CoreV1().ConfigMaps("default").Get("addon-operator-status", metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(obj.Data).Should(HaveLen(2))
+
+	var status ModuleStatus
+	g.Expect(yaml.Unmarshal([]byte(obj.Data["module-one"]), &status)).Should(Succeed())
+	g.Expect(status.Enabled).Should(BeTrue())
+	g.Expect(status.ConfigChecksum).Should(Equal("123"))
+	g.Expect(status.LastRun.Result).Should(Equal(RunSuccess))
+	g.Expect(status.LastRun.Time.Equal(runTime)).Should(BeTrue())
+
+	status = ModuleStatus{}
+	g.Expect(yaml.Unmarshal([]byte(obj.Data["module-two"]), &status)).Should(Succeed())
+	g.Expect(status.Enabled).Should(BeFalse())
+	g.Expect(status.ValidationErrors).Should(Equal(map[string]string{"ConfigMap": "bad value"}))
+	g.Expect(status.LastRun.Result).Should(Equal(RunFail))
+	g.Expect(status.LastRun.Error).Should(Equal("helm failed"))
+
+	// The ConfigMap is not updated if the status is not changed.
+	delete(obj.Data, "module-one")
+	_, err = kubeClient.CoreV1().ConfigMaps("default").Update(obj)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	err = reporter.Update("module-one", func(status *ModuleStatus) {
+		status.Enabled = true
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	obj, err = kubeClient.CoreV1().ConfigMaps("default").Get("addon-operator-status", metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(obj.Data).ShouldNot(HaveKey("module-one"))
+
+	// Other keys are preserved on update.
+	err = reporter.Update("module-two", func(status *ModuleStatus) {
+		status.ValidationErrors = nil
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	obj, err = kubeClient.CoreV1().ConfigMaps("default").Get("addon-operator-status", metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(obj.Data).Should(HaveLen(1))
+	g.Expect(obj.Data["module-two"]).ShouldNot(ContainSubstring("validationErrors"))
+
+	g.Expect(reporter.Statuses()).Should(HaveLen(2))
+}
+
+// Runs with the same result do not update the ConfigMap.
+func Test_StatusReporter_RunTime(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := kube.NewFakeKubernetesClient()
+	reporter := NewStatusReporter()
+	reporter.WithKubeClient(kubeClient)
+	reporter.WithNamespace("default")
+	reporter.WithConfigMapName("addon-operator-status")
+
+	runTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := reporter.Update("module-one", func(status *ModuleStatus) {
+		status.LastRun = NewRunStatus(nil, runTime)
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	obj, err := kubeClient.CoreV1().ConfigMaps("default").Get("addon-operator-status", metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	delete(obj.Data, "module-one")
+	_, err = kubeClient.CoreV1().ConfigMaps("default").Update(obj)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// The next successful run is not saved.
+	err = reporter.Update("module-one", func(status *ModuleStatus) {
+		status.LastRun = NewRunStatus(nil, runTime.Add(time.Minute))
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	obj, err = kubeClient.CoreV1().ConfigMaps("default").Get("addon-operator-status", metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(obj.Data).ShouldNot(HaveKey("module-one"))
+	g.Expect(reporter.Statuses()["module-one"].LastRun.Time.Equal(runTime)).Should(BeTrue())
+
+	// A failed run is saved with its time.
+	failTime := runTime.Add(2 * time.Minute)
+	err = reporter.Update("module-one", func(status *ModuleStatus) {
+		status.LastRun = NewRunStatus(fmt.Errorf("helm failed"), failTime)
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	obj, err = kubeClient.CoreV1().ConfigMaps("default").Get("addon-operator-status", metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	var status ModuleStatus
+	g.Expect(yaml.Unmarshal([]byte(obj.Data["module-one"]), &status)).Should(Succeed())
+	g.Expect(status.LastRun.Result).Should(Equal(RunFail))
+	g.Expect(status.LastRun.Time.Equal(failTime)).Should(BeTrue())
+}
+
+func Test_StatusReporter_Nil(t *testing.T) {
+	g := NewWithT(t)
+
+	var reporter *StatusReporter
+	err := reporter.Update("module-one", func(status *ModuleStatus) {
+		status.Enabled = true
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(reporter.Statuses()).Should(BeEmpty())
+}
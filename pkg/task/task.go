@@ -22,4 +22,8 @@ const (
 	ModulePurge task.TaskType = "ModulePurge"
 	// Task to call ModuleManager.Retry
 	ModuleManagerRetry task.TaskType = "ModuleManagerRetry"
+
+	// Re-register module or global hooks after changes in directories
+	ModuleReload      task.TaskType = "ModuleReload"
+	GlobalHooksReload task.TaskType = "GlobalHooksReload"
 )
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"sort"
 )
 
@@ -27,30 +28,35 @@ func CalculateChecksumOfFile(path string) (string, error) {
 	return CalculateStringsChecksum(string(content)), nil
 }
 
+// CalculateChecksumOfDirectory returns a checksum of names, permissions and contents
+// of all files in the directory. Symlinks are followed.
 func CalculateChecksumOfDirectory(dir string) (string, error) {
-	res := ""
+	fileChecksums := make([]string, 0)
 
 	var checkErr error
-	files, err := FilesFromRoot(dir, func(dir string, name string, info os.FileInfo) bool {
-		fPath := path.Join(dir, name)
+	_, err := FilesFromRoot(dir, func(fDir string, name string, info os.FileInfo) bool {
+		fPath := path.Join(fDir, name)
 		checksum, err := CalculateChecksumOfFile(fPath)
 		if err != nil {
-			// return only bad files for logging
-			checkErr = err
-			return true
+			checkErr = fmt.Errorf("calculate checksum of '%s': %v", fPath, err)
+			return false
 		}
-		res = CalculateStringsChecksum(res, checksum)
-		// good files are skipped
+		relPath, err := filepath.Rel(dir, fPath)
+		if err != nil {
+			relPath = fPath
+		}
+		fileChecksums = append(fileChecksums, fmt.Sprintf("%s:%s:%s", relPath, info.Mode().Perm(), checksum))
+		// files map is not needed
 		return false
 	})
 	if err != nil {
 		return "", err
 	}
 	if checkErr != nil {
-		return "", fmt.Errorf("calculate checksum of %+v: %v", files, err)
+		return "", checkErr
 	}
 
-	return res, nil
+	return CalculateStringsChecksum(fileChecksums...), nil
 }
 
 func CalculateChecksumOfPaths(paths ...string) (string, error) {
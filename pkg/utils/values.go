@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"reflect"
 	"sort"
 	"strings"
@@ -78,8 +77,9 @@ type ValuesPatchOperation struct {
 	Value interface{} `json:"value,omitempty"`
 }
 
+// ToString returns the value of the operation for error messages. Sensitive values are redacted.
 func (op *ValuesPatchOperation) ToString() string {
-	data, err := json.Marshal(op.Value)
+	data, err := json.Marshal(RedactValue(PointerToPath(op.Path), op.Value))
 	if err != nil {
 		// This should not happen, because ValuesPatchOperation is created with Unmarshal!
 		return fmt.Sprintf("{\"op\":\"%s\", \"path\":\"%s\", \"value-error\": \"%s\" }", op.Op, op.Path, err)
@@ -251,19 +251,6 @@ func ValuesPatchFromBytes(data []byte) (*ValuesPatch, error) {
 	return &ValuesPatch{Operations: operations}, nil
 }
 
-func ValuesPatchFromFile(filePath string) (*ValuesPatch, error) {
-	data, err := ioutil.ReadFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("cannot read %s: %s", filePath, err)
-	}
-
-	if len(data) == 0 {
-		return nil, nil
-	}
-
-	return ValuesPatchFromBytes(data)
-}
-
 func AppendValuesPatch(valuesPatches []ValuesPatch, newValuesPatch ValuesPatch) []ValuesPatch {
 	return CompactValuesPatches(valuesPatches, newValuesPatch)
 }
@@ -437,15 +424,24 @@ func MergeValues(values ...Values) Values {
 	return res
 }
 
-// DebugString returns values as yaml or an error line if dump is failed
+// DebugString returns values as yaml or an error line if dump is failed.
+// Sensitive values are redacted.
 func (v Values) DebugString() string {
-	b, err := v.YamlBytes()
+	b, err := RedactValues(v).YamlBytes()
 	if err != nil {
 		return "bad values: " + err.Error()
 	}
 	return string(b)
 }
 
+// Copy returns a deep copy of values.
+func (v Values) Copy() Values {
+	if v == nil {
+		return nil
+	}
+	return Values(copyValue(v).(map[string]interface{}))
+}
+
 func (v Values) Checksum() (string, error) {
 	valuesJson, err := json.Marshal(v)
 	if err != nil {
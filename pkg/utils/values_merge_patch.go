@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// IsMergePatch returns true if the object from a patches stream is an RFC 7386 merge patch,
+// not a single RFC 6902 operation. Operations always have the 'op' field.
+func IsMergePatch(obj map[string]interface{}) bool {
+	_, hasOp := obj["op"]
+	return !hasOp
+}
+
+// MergePatchToValuesPatch converts RFC 7386 merge patch into json patch operations.
+// values are the document to apply the merge patch to. It is needed to convert
+// merge semantics: objects are merged with existing objects, objects absent in values
+// are added as a whole, nulls for absent keys are ignored.
+func MergePatchToValuesPatch(values Values, mergePatch map[string]interface{}) *ValuesPatch {
+	patch := NewValuesPatch()
+	mergePatchOperations(patch, "", values, mergePatch)
+	return patch
+}
+
+func mergePatchOperations(patch *ValuesPatch, path string, doc map[string]interface{}, mergePatch map[string]interface{}) {
+	// Sort keys to get the same operations for the same merge patch.
+	keys := make([]string, 0, len(mergePatch))
+	for key := range mergePatch {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := mergePatch[key]
+		subPath := path + "/" + escapePathKey(key)
+		current, has := doc[key]
+
+		if value == nil {
+			if has {
+				patch.Operations = append(patch.Operations, &ValuesPatchOperation{Op: "remove", Path: subPath})
+			}
+			continue
+		}
+
+		obj, isObject := asObject(value)
+		if !isObject {
+			patch.Operations = append(patch.Operations, &ValuesPatchOperation{Op: "add", Path: subPath, Value: value})
+			continue
+		}
+
+		if currentObj, ok := asObject(current); has && ok {
+			mergePatchOperations(patch, subPath, currentObj, obj)
+			continue
+		}
+
+		patch.Operations = append(patch.Operations, &ValuesPatchOperation{Op: "add", Path: subPath, Value: withoutNulls(obj)})
+	}
+}
+
+// withoutNulls returns a copy of the merge patch object without null values,
+// as if the object is merged into an empty object.
+func withoutNulls(obj map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(obj))
+	for key, value := range obj {
+		if value == nil {
+			continue
+		}
+		if nested, ok := asObject(value); ok {
+			res[key] = withoutNulls(nested)
+			continue
+		}
+		res[key] = value
+	}
+	return res
+}
+
+// ValuesPatchFromFile reads a JSON stream of json patches, single operations and
+// merge patches from the file and returns a ValuesPatch with all operations.
+// Merge patches are converted into operations against values with previous
+// operations applied.
+func ValuesPatchFromFile(filePath string, values Values) (*ValuesPatch, error) {
+	data, err := readPatchFile(filePath)
+	if data == nil || err != nil {
+		return nil, err
+	}
+
+	return valuesPatchFromStream(data, values, false)
+}
+
+// MergePatchFromFile reads a JSON stream of merge patches from the file and
+// converts them into a ValuesPatch against values.
+func MergePatchFromFile(filePath string, values Values) (*ValuesPatch, error) {
+	data, err := readPatchFile(filePath)
+	if data == nil || err != nil {
+		return nil, err
+	}
+
+	return valuesPatchFromStream(data, values, true)
+}
+
+func readPatchFile(filePath string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %s", filePath, err)
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+
+	return data, nil
+}
+
+// checkPatchOperations returns an error for operations not defined by RFC 6902.
+// Merge patches are objects without the 'op' field, there is no 'merge' operation.
+func checkPatchOperations(patch *ValuesPatch) error {
+	for _, op := range patch.Operations {
+		switch op.Op {
+		case "add", "remove", "replace", "move", "copy", "test":
+		default:
+			return fmt.Errorf("unknown patch operation '%s': '%s'", op.Op, op.ToString())
+		}
+	}
+	return nil
+}
+
+func valuesPatchFromStream(data []byte, values Values, mergeOnly bool) (*ValuesPatch, error) {
+	res := NewValuesPatch()
+
+	// Operations are collected and decoded with ValuesPatchFromBytes to keep its checks.
+	var pendingOperations bytes.Buffer
+	flush := func() error {
+		if pendingOperations.Len() == 0 {
+			return nil
+		}
+		patch, err := ValuesPatchFromBytes(pendingOperations.Bytes())
+		if err != nil {
+			return err
+		}
+		if err := checkPatchOperations(patch); err != nil {
+			return err
+		}
+		res.MergeOperations(patch)
+		pendingOperations.Reset()
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var item interface{}
+		if err := dec.Decode(&item); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("bad patch data: %s\n%s", err, string(data))
+		}
+
+		obj, isObject := item.(map[string]interface{})
+		if mergeOnly && !isObject {
+			return nil, fmt.Errorf("bad merge patch data: expect JSON object, got %T\n%s", item, string(data))
+		}
+		if !mergeOnly && (!isObject || !IsMergePatch(obj)) {
+			itemBytes, err := json.Marshal(item)
+			if err != nil {
+				return nil, err
+			}
+			pendingOperations.Write(itemBytes)
+			pendingOperations.WriteString("\n")
+			continue
+		}
+
+		if err := flush(); err != nil {
+			return nil, err
+		}
+
+		doc, err := applyForMergePatch(values, res)
+		if err != nil {
+			return nil, err
+		}
+		res.MergeOperations(MergePatchToValuesPatch(doc, obj))
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// applyForMergePatch returns values with operations from patch applied.
+func applyForMergePatch(values Values, patch *ValuesPatch) (Values, error) {
+	if values == nil {
+		values = Values{}
+	}
+	if len(patch.Operations) == 0 {
+		return values, nil
+	}
+	doc, _, err := ApplyValuesPatch(values, *patch)
+	if err != nil {
+		return nil, fmt.Errorf("apply operations before merge patch: %s", err)
+	}
+	return doc, nil
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_MergePatchToValuesPatch(t *testing.T) {
+	g := NewWithT(t)
+
+	values := Values{
+		"moduleOne": map[string]interface{}{
+			"replicas": 1.0,
+			"hosts":    []interface{}{"a", "b"},
+			"auth": map[string]interface{}{
+				"user":     "admin",
+				"password": "qwerty",
+			},
+			"https": true,
+		},
+	}
+
+	mergePatch := map[string]interface{}{
+		"moduleOne": map[string]interface{}{
+			"replicas": 2.0,
+			"hosts":    []interface{}{"c"},
+			"auth": map[string]interface{}{
+				"password": nil,
+			},
+			"https": map[string]interface{}{
+				"mode":   "CertManager",
+				"issuer": nil,
+			},
+			"absent": nil,
+			"internal": map[string]interface{}{
+				"ready": true,
+			},
+		},
+	}
+
+	patch := MergePatchToValuesPatch(values, mergePatch)
+	g.Expect(patch.Operations).Should(Equal([]*ValuesPatchOperation{
+		{Op: "remove", Path: "/moduleOne/auth/password"},
+		{Op: "add", Path: "/moduleOne/hosts", Value: []interface{}{"c"}},
+		{Op: "add", Path: "/moduleOne/https", Value: map[string]interface{}{"mode": "CertManager"}},
+		{Op: "add", Path: "/moduleOne/internal", Value: map[string]interface{}{"ready": true}},
+		{Op: "add", Path: "/moduleOne/replicas", Value: 2.0},
+	}))
+
+	res, _, err := ApplyValuesPatch(values, *patch)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(res).Should(Equal(Values{
+		"moduleOne": map[string]interface{}{
+			"replicas": 2.0,
+			"hosts":    []interface{}{"c"},
+			"auth": map[string]interface{}{
+				"user": "admin",
+			},
+			"https": map[string]interface{}{
+				"mode": "CertManager",
+			},
+			"internal": map[string]interface{}{
+				"ready": true,
+			},
+		},
+	}))
+}
+
+func Test_ValuesPatchFromFile_MergePatch(t *testing.T) {
+	g := NewWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "values-patch")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	values := Values{
+		"moduleOne": map[string]interface{}{
+			"a": "x",
+		},
+	}
+
+	// A stream with json patch operations and a merge patch detected by content.
+	path := filepath.Join(tmpDir, "values.json-patch")
+	g.Expect(ioutil.WriteFile(path, []byte(`
+[{"op": "add", "path": "/moduleOne/b", "value": {"c": 1}}]
+{"moduleOne": {"b": {"d": 2}, "a": null}}
+`), 0644)).Should(Succeed())
+
+	patch, err := ValuesPatchFromFile(path, values)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(patch.Operations).Should(Equal([]*ValuesPatchOperation{
+		{Op: "add", Path: "/moduleOne/b", Value: map[string]interface{}{"c": 1.0}},
+		{Op: "remove", Path: "/moduleOne/a"},
+		{Op: "add", Path: "/moduleOne/b/d", Value: 2.0},
+	}))
+	g.Expect(ValidateHookValuesPatch(*patch, "moduleOne")).Should(Succeed())
+
+	res, _, err := ApplyValuesPatch(values, *patch)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(res).Should(Equal(Values{
+		"moduleOne": map[string]interface{}{
+			"b": map[string]interface{}{"c": 1.0, "d": 2.0},
+		},
+	}))
+
+	// Empty file.
+	emptyPath := filepath.Join(tmpDir, "empty.merge-patch")
+	g.Expect(ioutil.WriteFile(emptyPath, []byte{}, 0644)).Should(Succeed())
+	patch, err = MergePatchFromFile(emptyPath, values)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(patch).Should(BeNil())
+
+	// Merge patch file accepts only objects.
+	badPath := filepath.Join(tmpDir, "bad.merge-patch")
+	g.Expect(ioutil.WriteFile(badPath, []byte(`[{"op": "remove", "path": "/moduleOne/a"}]`), 0644)).Should(Succeed())
+	_, err = MergePatchFromFile(badPath, values)
+	g.Expect(err).Should(HaveOccurred())
+
+	// Only RFC 6902 operations are accepted in json patch files.
+	mergeOpPath := filepath.Join(tmpDir, "merge-op.json-patch")
+	g.Expect(ioutil.WriteFile(mergeOpPath, []byte(`{"op": "merge", "path": "/moduleOne", "value": {"a": "y"}}`), 0644)).Should(Succeed())
+	_, err = ValuesPatchFromFile(mergeOpPath, values)
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(err.Error()).Should(ContainSubstring("unknown patch operation 'merge'"))
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Strategies to merge arrays from different layers of values.
+const (
+	// ReplaceArrays replaces the array with the array from the next layer. It is the default.
+	ReplaceArrays = "replace"
+	// AppendArrays appends items from the next layer.
+	AppendArrays = "append"
+	// MergeArraysByKey merges objects with the same value of the key field
+	// and appends other items.
+	MergeArraysByKey = "merge"
+)
+
+// ArrayMergeStrategy defines how to merge an array with the array from the next layer.
+type ArrayMergeStrategy struct {
+	Strategy string
+	// Key is a field of array items for MergeArraysByKey.
+	Key string
+}
+
+// MergeStrategies are array merge strategies by a dot-separated path from the root of values,
+// e.g. 'moduleOne.tolerations'. '*' is used for array items: 'moduleOne.containers.*.ports'.
+type MergeStrategies map[string]ArrayMergeStrategy
+
+// Validate checks strategy names and keys.
+func (s ArrayMergeStrategy) Validate() error {
+	switch s.Strategy {
+	case ReplaceArrays, AppendArrays:
+		return nil
+	case MergeArraysByKey:
+		if s.Key == "" {
+			return fmt.Errorf("merge strategy '%s' requires a key", s.Strategy)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown merge strategy '%s'", s.Strategy)
+}
+
+// MergeValuesWithStrategies merges values as MergeValues, but arrays are merged
+// according to strategies. Input values are not changed.
+func MergeValuesWithStrategies(strategies MergeStrategies, values ...Values) Values {
+	if len(strategies) == 0 {
+		return MergeValues(values...)
+	}
+
+	res := make(map[string]interface{})
+	for _, v := range values {
+		res = mergeObjectsWithStrategies(res, v, nil, strategies)
+	}
+
+	return Values(res)
+}
+
+func mergeObjectsWithStrategies(dst map[string]interface{}, src map[string]interface{}, path []string, strategies MergeStrategies) map[string]interface{} {
+	for key, srcValue := range src {
+		keyPath := append(append([]string{}, path...), key)
+		dstValue, has := dst[key]
+		if !has {
+			dst[key] = copyValue(srcValue)
+			continue
+		}
+		dst[key] = mergeValueWithStrategies(dstValue, srcValue, keyPath, strategies)
+	}
+	return dst
+}
+
+func mergeValueWithStrategies(dst interface{}, src interface{}, path []string, strategies MergeStrategies) interface{} {
+	dstObj, isDstObj := asObject(dst)
+	srcObj, isSrcObj := asObject(src)
+	if isDstObj && isSrcObj {
+		return mergeObjectsWithStrategies(dstObj, srcObj, path, strategies)
+	}
+
+	dstArr, isDstArr := dst.([]interface{})
+	srcArr, isSrcArr := src.([]interface{})
+	if !isDstArr || !isSrcArr {
+		return copyValue(src)
+	}
+
+	strategy := strategies[strings.Join(path, ".")]
+	switch strategy.Strategy {
+	case AppendArrays:
+		res := make([]interface{}, 0, len(dstArr)+len(srcArr))
+		res = append(res, dstArr...)
+		for _, item := range srcArr {
+			res = append(res, copyValue(item))
+		}
+		return res
+	case MergeArraysByKey:
+		return mergeArraysByKey(dstArr, srcArr, strategy.Key, append(append([]string{}, path...), "*"), strategies)
+	}
+	return copyValue(src)
+}
+
+// mergeArraysByKey merges objects with the same value in the key field. Other items are appended.
+func mergeArraysByKey(dst []interface{}, src []interface{}, key string, itemPath []string, strategies MergeStrategies) []interface{} {
+	res := make([]interface{}, 0, len(dst)+len(src))
+	res = append(res, dst...)
+
+	for _, srcItem := range src {
+		srcObj, ok := asObject(srcItem)
+		if !ok || srcObj[key] == nil {
+			res = append(res, copyValue(srcItem))
+			continue
+		}
+
+		merged := false
+		for i, dstItem := range res {
+			dstObj, ok := asObject(dstItem)
+			if !ok || fmt.Sprintf("%v", dstObj[key]) != fmt.Sprintf("%v", srcObj[key]) {
+				continue
+			}
+			res[i] = mergeObjectsWithStrategies(copyValue(dstObj).(map[string]interface{}), srcObj, itemPath, strategies)
+			merged = true
+			break
+		}
+		if !merged {
+			res = append(res, copyValue(srcItem))
+		}
+	}
+
+	return res
+}
+
+// copyValue returns a deep copy of maps and arrays, so merged values do not share
+// nested objects with layers.
+func copyValue(in interface{}) interface{} {
+	switch v := in.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			res[k] = copyValue(item)
+		}
+		return res
+	case Values:
+		res := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			res[k] = copyValue(item)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			res[i] = copyValue(item)
+		}
+		return res
+	default:
+		return v
+	}
+}
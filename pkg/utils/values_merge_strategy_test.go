@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_MergeValuesWithStrategies(t *testing.T) {
+	g := NewWithT(t)
+
+	strategies := MergeStrategies{
+		"moduleOne.tolerations":        {Strategy: AppendArrays},
+		"moduleOne.containers":         {Strategy: MergeArraysByKey, Key: "name"},
+		"moduleOne.containers.*.ports": {Strategy: MergeArraysByKey, Key: "containerPort"},
+	}
+
+	defaults := Values{"moduleOne": map[string]interface{}{
+		"hosts": []interface{}{"a"},
+	}}
+	static := Values{"moduleOne": map[string]interface{}{
+		"tolerations": []interface{}{map[string]interface{}{"key": "a"}},
+		"containers": []interface{}{
+			map[string]interface{}{"name": "app", "image": "app:v1", "ports": []interface{}{
+				map[string]interface{}{"containerPort": 80.0, "name": "http"},
+			}},
+		},
+	}}
+	config := Values{"moduleOne": map[string]interface{}{
+		"hosts":       []interface{}{"b"},
+		"tolerations": []interface{}{map[string]interface{}{"key": "b"}},
+		"containers": []interface{}{
+			map[string]interface{}{"name": "app", "ports": []interface{}{
+				map[string]interface{}{"containerPort": 80.0, "name": "web"},
+				map[string]interface{}{"containerPort": 443.0, "name": "https"},
+			}},
+			"not-an-object",
+		},
+	}}
+
+	res := MergeValuesWithStrategies(strategies, defaults, static, config)
+	g.Expect(res).Should(Equal(Values{"moduleOne": map[string]interface{}{
+		"hosts": []interface{}{"b"},
+		"tolerations": []interface{}{
+			map[string]interface{}{"key": "a"},
+			map[string]interface{}{"key": "b"},
+		},
+		"containers": []interface{}{
+			map[string]interface{}{"name": "app", "image": "app:v1", "ports": []interface{}{
+				map[string]interface{}{"containerPort": 80.0, "name": "web"},
+				map[string]interface{}{"containerPort": 443.0, "name": "https"},
+			}},
+			"not-an-object",
+		},
+	}}))
+
+	// Layers are not changed.
+	g.Expect(static["moduleOne"].(map[string]interface{})["tolerations"]).Should(HaveLen(1))
+	g.Expect(static["moduleOne"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})["ports"]).Should(HaveLen(1))
+
+	// Without strategies arrays are replaced.
+	res = MergeValuesWithStrategies(nil, static, config)
+	g.Expect(res["moduleOne"].(map[string]interface{})["tolerations"]).Should(Equal([]interface{}{map[string]interface{}{"key": "b"}}))
+}
+
+func Test_ArrayMergeStrategy_Validate(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(ArrayMergeStrategy{Strategy: AppendArrays}.Validate()).Should(Succeed())
+	g.Expect(ArrayMergeStrategy{Strategy: MergeArraysByKey, Key: "name"}.Validate()).Should(Succeed())
+	g.Expect(ArrayMergeStrategy{Strategy: MergeArraysByKey}.Validate()).ShouldNot(Succeed())
+	g.Expect(ArrayMergeStrategy{Strategy: "prepend"}.Validate()).ShouldNot(Succeed())
+}
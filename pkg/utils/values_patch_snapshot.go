@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ValuesPatchesOperationsCount returns the number of operations in patches.
+func ValuesPatchesOperationsCount(patches []ValuesPatch) int {
+	count := 0
+	for _, patch := range patches {
+		count += len(patch.Operations)
+	}
+	return count
+}
+
+// ValuesPatchesSize returns the size of operations in patches in JSON.
+func ValuesPatchesSize(patches []ValuesPatch) int {
+	size := 0
+	for _, patch := range patches {
+		data, err := json.Marshal(patch.Operations)
+		if err != nil {
+			continue
+		}
+		size += len(data)
+	}
+	return size
+}
+
+// SnapshotValuesPatches returns one patch that gives the same values as patches
+// for any base values. Operations are compacted with CompactPatches, so guard operations
+// are kept. Then operations for nested paths are folded into the value of the 'add' operation
+// for the parent path: the parent is replaced as a whole, so the result does not depend on base values.
+func SnapshotValuesPatches(patches []ValuesPatch) ValuesPatch {
+	operations := make([]*ValuesPatchOperation, 0)
+	for _, patch := range patches {
+		operations = append(operations, patch.Operations...)
+	}
+	compacted := CompactPatches(operations)
+
+	res := make([]*ValuesPatchOperation, 0, len(compacted.Operations))
+	// Index of the last operation for the path in res.
+	lastOps := make(map[string]int)
+	for _, op := range compacted.Operations {
+		if idx, ok := parentAddOperation(res, lastOps, op.Path); ok {
+			if folded, ok := foldOperation(res[idx], op); ok {
+				res[idx] = folded
+				continue
+			}
+		}
+		lastOps[op.Path] = len(res)
+		res = append(res, op)
+	}
+
+	return ValuesPatch{Operations: res}
+}
+
+// parentAddOperation returns the index of the nearest 'add' operation for a parent path.
+// An 'add' operation followed by a 'remove' operation for the same path is not returned.
+func parentAddOperation(ops []*ValuesPatchOperation, lastOps map[string]int, path string) (int, bool) {
+	for i := strings.LastIndex(path, "/"); i > 0; i = strings.LastIndex(path[:i], "/") {
+		if idx, ok := lastOps[path[:i]]; ok {
+			return idx, ops[idx].Op == "add"
+		}
+	}
+	return 0, false
+}
+
+// foldOperation applies the operation for a nested path to the value of the parent 'add' operation.
+func foldOperation(parent *ValuesPatchOperation, op *ValuesPatchOperation) (*ValuesPatchOperation, bool) {
+	doc := Values{"value": parent.Value}
+	nestedOp := &ValuesPatchOperation{
+		Op:    op.Op,
+		Path:  "/value" + strings.TrimPrefix(op.Path, parent.Path),
+		Value: op.Value,
+	}
+	res, _, err := ApplyValuesPatch(doc, ValuesPatch{Operations: []*ValuesPatchOperation{nestedOp}})
+	if err != nil {
+		return nil, false
+	}
+	return &ValuesPatchOperation{Op: "add", Path: parent.Path, Value: res["value"]}, true
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_SnapshotValuesPatches(t *testing.T) {
+	g := NewWithT(t)
+
+	base := Values{
+		"global": map[string]interface{}{"a": 1},
+		"moduleOne": map[string]interface{}{
+			"replicas": 1,
+			"auth":     map[string]interface{}{"user": "admin", "password": "qwerty"},
+			"static":   "value",
+		},
+	}
+
+	// Hook adds and removes many keys.
+	patches := AppendValuesPatch(nil, *MustValuesPatch(ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/moduleOne/items", "value": {}}
+]`))))
+	for i := 0; i < 50; i++ {
+		patches = AppendValuesPatch(patches, *MustValuesPatch(ValuesPatchFromBytes([]byte(fmt.Sprintf(`[
+{"op": "add", "path": "/moduleOne/items/item%d", "value": %d}
+]`, i, i)))))
+		if i%2 == 0 {
+			patches = AppendValuesPatch(patches, *MustValuesPatch(ValuesPatchFromBytes([]byte(fmt.Sprintf(`[
+{"op": "remove", "path": "/moduleOne/items/item%d"}
+]`, i)))))
+		}
+	}
+	patches = AppendValuesPatch(patches, *MustValuesPatch(ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/moduleOne/auth", "value": {"user": "admin", "password": "secret"}},
+{"op": "remove", "path": "/moduleOne/static"},
+{"op": "add", "path": "/moduleOne/replicas", "value": 1}
+]`))))
+
+	// Add and remove operations are accumulated: 25 add+remove pairs for removed items,
+	// 26 operations to add items, a guard and a remove for 'static' and 2 other operations.
+	g.Expect(ValuesPatchesOperationsCount(patches)).Should(Equal(80))
+
+	// Nested operations are folded into the 'add' operation for items. Guard and remove
+	// operations for 'static' are kept, operations for replicas and auth are kept as is.
+	snapshot := SnapshotValuesPatches(patches)
+	g.Expect(snapshot.Operations).Should(HaveLen(5))
+	g.Expect(snapshot.Operations[0]).Should(Equal(&ValuesPatchOperation{Op: "add", Path: "/moduleOne/auth", Value: map[string]interface{}{"user": "admin", "password": "secret"}}))
+	g.Expect(snapshot.Operations[1].Path).Should(Equal("/moduleOne/items"))
+	g.Expect(snapshot.Operations[1].Value).Should(HaveLen(25))
+	g.Expect(snapshot.Operations[2]).Should(Equal(&ValuesPatchOperation{Op: "add", Path: "/moduleOne/replicas", Value: 1.0}))
+	g.Expect(snapshot.Operations[3]).Should(Equal(&ValuesPatchOperation{Op: "add", Path: "/moduleOne/static", Value: "guard-patch-for-successful-remove"}))
+	g.Expect(snapshot.Operations[4]).Should(Equal(&ValuesPatchOperation{Op: "remove", Path: "/moduleOne/static"}))
+
+	// Values are identical for the base values and for changed base values.
+	changedBase := Values{
+		"global":    map[string]interface{}{"a": 1},
+		"moduleOne": map[string]interface{}{"replicas": 3},
+	}
+	for _, values := range []Values{base, changedBase} {
+		expected := values
+		var err error
+		for _, patch := range patches {
+			expected, _, err = ApplyValuesPatch(expected, patch)
+			g.Expect(err).ShouldNot(HaveOccurred())
+		}
+		actual, _, err := ApplyValuesPatch(values, snapshot)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		g.Expect(actual).Should(Equal(expected))
+	}
+}
+
+func Test_SnapshotValuesPatches_AbsentSection(t *testing.T) {
+	g := NewWithT(t)
+
+	patches := []ValuesPatch{*MustValuesPatch(ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/moduleOne", "value": {}},
+{"op": "add", "path": "/moduleOne/a", "value": "b"},
+{"op": "add", "path": "/moduleOne/c", "value": {"d": 1}}
+]`)))}
+
+	snapshot := SnapshotValuesPatches(patches)
+	g.Expect(snapshot.Operations).Should(Equal([]*ValuesPatchOperation{
+		{Op: "add", Path: "/moduleOne", Value: map[string]interface{}{"a": "b", "c": map[string]interface{}{"d": 1.0}}},
+	}))
+
+	// The section is replaced as a whole if it is already in values.
+	res, _, err := ApplyValuesPatch(Values{"moduleOne": map[string]interface{}{"a": "b", "x": "y"}}, snapshot)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(res).Should(Equal(Values{"moduleOne": map[string]interface{}{"a": "b", "c": map[string]interface{}{"d": 1.0}}}))
+}
@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Layers of effective values in order of precedence.
+const (
+	SchemaDefaultsLayer = "schema defaults"
+	CommonStaticLayer   = "modules/values.yaml"
+	ModuleStaticLayer   = "module values.yaml"
+	ConfigMapLayer      = "ConfigMap"
+	DynamicPatchLayer   = "dynamic patch"
+	EnabledModulesLayer = "enabled modules"
+)
+
+// ValueSource describes a layer that sets the value.
+// Hook and Binding are set for values from dynamic patches.
+type ValueSource struct {
+	Layer   string `json:"layer"`
+	Hook    string `json:"hook,omitempty"`
+	Binding string `json:"binding,omitempty"`
+}
+
+// ValueExplanation is a leaf value with its source.
+type ValueExplanation struct {
+	Path   string      `json:"path"`
+	Value  interface{} `json:"value"`
+	Source ValueSource `json:"source"`
+}
+
+// ValuesProvenance records sources of leaf values while layers of values
+// are merged and patches are applied. A leaf is a scalar, an array or an empty object.
+// Paths are JSON pointers, as in patches. Arrays are not merged, so an array is
+// always a leaf: a patch operation on an item changes the source of the whole array.
+//
+// Methods are safe to call on nil ValuesProvenance, they do nothing.
+type ValuesProvenance struct {
+	sources map[string]ValueSource
+}
+
+func NewValuesProvenance() *ValuesProvenance {
+	return &ValuesProvenance{
+		sources: make(map[string]ValueSource),
+	}
+}
+
+// Merge records sources for values merged with MergeValues:
+// objects are merged, other values are replaced.
+func (p *ValuesProvenance) Merge(values Values, source ValueSource) {
+	if p == nil {
+		return
+	}
+	p.mergeObject("", values, source)
+}
+
+// ApplyPatchOperation records the source of the operation. values are
+// the values after the operation is applied.
+func (p *ValuesProvenance) ApplyPatchOperation(op *ValuesPatchOperation, source ValueSource, values Values) {
+	if p == nil {
+		return
+	}
+
+	if arrayPath, ok := arrayAncestor(values, op.Path); ok {
+		p.set(arrayPath, source)
+		return
+	}
+
+	switch op.Op {
+	case "add":
+		obj, ok := asObject(op.Value)
+		if ok && len(obj) > 0 {
+			p.clear(op.Path)
+			p.clearAncestors(op.Path)
+			p.mergeObject(op.Path, obj, source)
+			return
+		}
+		p.set(op.Path, source)
+	case "remove":
+		p.clear(op.Path)
+	}
+}
+
+// Explain returns leaf values with their sources sorted by path.
+// Leaves without recorded source are not returned.
+func (p *ValuesProvenance) Explain(values Values) []ValueExplanation {
+	res := make([]ValueExplanation, 0)
+	if p == nil {
+		return res
+	}
+
+	for path, source := range p.sources {
+		value, ok := lookupPath(values, path)
+		if !ok {
+			continue
+		}
+		res = append(res, ValueExplanation{
+			Path:   path,
+			Value:  value,
+			Source: source,
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Path < res[j].Path
+	})
+
+	return res
+}
+
+func (p *ValuesProvenance) mergeObject(path string, obj map[string]interface{}, source ValueSource) {
+	for key, value := range obj {
+		subPath := path + "/" + escapePathKey(key)
+		nested, ok := asObject(value)
+		if ok {
+			// Empty objects do not change existing values.
+			p.mergeObject(subPath, nested, source)
+			continue
+		}
+		p.set(subPath, source)
+	}
+}
+
+// set records a new leaf: previous leaves under the path and above the path are replaced.
+func (p *ValuesProvenance) set(path string, source ValueSource) {
+	p.clear(path)
+	p.clearAncestors(path)
+	p.sources[path] = source
+}
+
+// clear removes the path and all its subpaths.
+func (p *ValuesProvenance) clear(path string) {
+	for subPath := range p.sources {
+		if subPath == path || strings.HasPrefix(subPath, path+"/") {
+			delete(p.sources, subPath)
+		}
+	}
+}
+
+func (p *ValuesProvenance) clearAncestors(path string) {
+	for i := strings.LastIndex(path, "/"); i > 0; i = strings.LastIndex(path[:i], "/") {
+		delete(p.sources, path[:i])
+	}
+}
+
+// arrayAncestor returns the path of the outermost array on the way to the path.
+func arrayAncestor(values Values, path string) (string, bool) {
+	var current interface{} = map[string]interface{}(values)
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		switch v := current.(type) {
+		case []interface{}:
+			return strings.Join(parts[:i], "/"), true
+		case map[string]interface{}:
+			current = v[unescapePathKey(parts[i])]
+		case Values:
+			current = v[unescapePathKey(parts[i])]
+		default:
+			return "", false
+		}
+	}
+	return "", false
+}
+
+func lookupPath(values Values, path string) (interface{}, bool) {
+	var current interface{} = map[string]interface{}(values)
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		switch v := current.(type) {
+		case []interface{}:
+			idx, err := strconv.Atoi(parts[i])
+			if err != nil || idx < 0 || idx >= len(v) {
+				return nil, false
+			}
+			current = v[idx]
+		case map[string]interface{}:
+			item, ok := v[unescapePathKey(parts[i])]
+			if !ok {
+				return nil, false
+			}
+			current = item
+		case Values:
+			item, ok := v[unescapePathKey(parts[i])]
+			if !ok {
+				return nil, false
+			}
+			current = item
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func asObject(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case Values:
+		return v, true
+	}
+	return nil, false
+}
+
+// escapePathKey escapes a key for JSON pointer (RFC 6901).
+func escapePathKey(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+func unescapePathKey(key string) string {
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(key)
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_ValuesProvenance_Layers(t *testing.T) {
+	g := NewWithT(t)
+
+	defaults := Values{"moduleOne": map[string]interface{}{
+		"replicas": 1,
+		"image":    map[string]interface{}{"name": "nginx", "tag": "latest"},
+	}}
+	static := Values{"moduleOne": map[string]interface{}{
+		"image": map[string]interface{}{"tag": "1.19"},
+		"hosts": []interface{}{"a", "b"},
+	}}
+	config := Values{"moduleOne": map[string]interface{}{
+		"image": "nginx:1.20",
+	}}
+
+	p := NewValuesProvenance()
+	p.Merge(defaults, ValueSource{Layer: SchemaDefaultsLayer})
+	p.Merge(static, ValueSource{Layer: ModuleStaticLayer})
+	p.Merge(config, ValueSource{Layer: ConfigMapLayer})
+	values := MergeValues(defaults, static, config)
+
+	source := ValueSource{Layer: DynamicPatchLayer, Hook: "hook", Binding: "beforeHelm"}
+	for _, op := range []*ValuesPatchOperation{
+		{Op: "add", Path: "/moduleOne/hosts/-", Value: "c"},
+		{Op: "add", Path: "/moduleOne/internal", Value: map[string]interface{}{"ready": true}},
+	} {
+		var err error
+		values, _, err = ApplyValuesPatch(values, ValuesPatch{Operations: []*ValuesPatchOperation{op}})
+		g.Expect(err).ShouldNot(HaveOccurred())
+		p.ApplyPatchOperation(op, source, values)
+	}
+
+	explain := p.Explain(values)
+	g.Expect(explain).Should(Equal([]ValueExplanation{
+		{Path: "/moduleOne/hosts", Value: []interface{}{"a", "b", "c"}, Source: source},
+		{Path: "/moduleOne/image", Value: "nginx:1.20", Source: ValueSource{Layer: ConfigMapLayer}},
+		{Path: "/moduleOne/internal/ready", Value: true, Source: source},
+		{Path: "/moduleOne/replicas", Value: 1.0, Source: ValueSource{Layer: SchemaDefaultsLayer}},
+	}))
+}
+
+func Test_ValuesProvenance_Remove(t *testing.T) {
+	g := NewWithT(t)
+
+	values := Values{"global": map[string]interface{}{
+		"a": map[string]interface{}{"b": 1.0, "c": 2.0},
+	}}
+
+	p := NewValuesProvenance()
+	p.Merge(values, ValueSource{Layer: ConfigMapLayer})
+
+	op := &ValuesPatchOperation{Op: "remove", Path: "/global/a/b"}
+	values, _, err := ApplyValuesPatch(values, ValuesPatch{Operations: []*ValuesPatchOperation{op}})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	p.ApplyPatchOperation(op, ValueSource{Layer: DynamicPatchLayer}, values)
+
+	g.Expect(p.Explain(values)).Should(Equal([]ValueExplanation{
+		{Path: "/global/a/c", Value: 2.0, Source: ValueSource{Layer: ConfigMapLayer}},
+	}))
+}
+
+func Test_ValuesProvenance_Nil(t *testing.T) {
+	g := NewWithT(t)
+
+	var p *ValuesProvenance
+	p.Merge(Values{"a": 1}, ValueSource{Layer: ConfigMapLayer})
+	g.Expect(p.Explain(Values{"a": 1})).Should(BeEmpty())
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RedactedValue replaces sensitive values in logs and in debug output.
+const RedactedValue = "<redacted>"
+
+// sensitivePaths is a registry of path patterns for sensitive values.
+// A pattern is a dot-separated path from the root of values, e.g. 'moduleOne.auth.password'.
+// '*' matches any key or array index. Values under the matched path are redacted too.
+//
+// Values are redacted in logs by Values.DebugString, so the registry is shared by the process.
+// Patterns are stored by owner: each module manager replaces only its own patterns, and values
+// matched by patterns of any owner are redacted. So with two operators in one process, values
+// of one operator can be redacted by patterns from schemas of the other one.
+var sensitivePaths = struct {
+	sync.RWMutex
+	byOwner map[interface{}][][]string
+}{
+	byOwner: make(map[interface{}][][]string),
+}
+
+// AddSensitivePaths registers path patterns of sensitive values for the whole process,
+// e.g. patterns from the command line.
+func AddSensitivePaths(patterns ...string) {
+	sensitivePaths.Lock()
+	defer sensitivePaths.Unlock()
+	sensitivePaths.byOwner[nil] = append(sensitivePaths.byOwner[nil], splitPatterns(patterns)...)
+}
+
+// ReplaceSensitivePaths replaces path patterns registered by the owner. Patterns of other owners
+// are kept. No patterns remove the owner from the registry.
+func ReplaceSensitivePaths(owner interface{}, patterns ...string) {
+	sensitivePaths.Lock()
+	defer sensitivePaths.Unlock()
+	split := splitPatterns(patterns)
+	if len(split) == 0 {
+		delete(sensitivePaths.byOwner, owner)
+		return
+	}
+	sensitivePaths.byOwner[owner] = split
+}
+
+func splitPatterns(patterns []string) [][]string {
+	res := make([][]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		res = append(res, strings.Split(pattern, "."))
+	}
+	return res
+}
+
+// IsSensitivePath returns true if the path or one of its parents matches a registered pattern.
+func IsSensitivePath(path []string) bool {
+	sensitivePaths.RLock()
+	defer sensitivePaths.RUnlock()
+	for _, patterns := range sensitivePaths.byOwner {
+		for _, pattern := range patterns {
+			if matchPathPattern(pattern, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasSensitivePaths() bool {
+	sensitivePaths.RLock()
+	defer sensitivePaths.RUnlock()
+	for _, patterns := range sensitivePaths.byOwner {
+		if len(patterns) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPathPattern(pattern []string, path []string) bool {
+	if len(path) < len(pattern) {
+		return false
+	}
+	for i, part := range pattern {
+		if part != "*" && part != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// RedactValues returns a copy of values with sensitive values replaced with RedactedValue.
+// values are returned as is if there are no registered patterns.
+func RedactValues(values Values) Values {
+	if !hasSensitivePaths() || values == nil {
+		return values
+	}
+	return Values(redactObject(values, nil))
+}
+
+// RedactValue returns a copy of the value at the path with sensitive values replaced with RedactedValue.
+func RedactValue(path []string, value interface{}) interface{} {
+	if !hasSensitivePaths() {
+		return value
+	}
+	return redactValue(path, value)
+}
+
+// RedactValuesPatches returns a copy of patches with sensitive values in operations replaced with RedactedValue.
+func RedactValuesPatches(patches []ValuesPatch) []ValuesPatch {
+	if !hasSensitivePaths() {
+		return patches
+	}
+	res := make([]ValuesPatch, 0, len(patches))
+	for _, patch := range patches {
+		ops := make([]*ValuesPatchOperation, 0, len(patch.Operations))
+		for _, op := range patch.Operations {
+			ops = append(ops, &ValuesPatchOperation{
+				Op:    op.Op,
+				Path:  op.Path,
+				Value: RedactValue(PointerToPath(op.Path), op.Value),
+			})
+		}
+		res = append(res, ValuesPatch{Operations: ops})
+	}
+	return res
+}
+
+// PointerToPath splits JSON pointer into keys.
+func PointerToPath(pointer string) []string {
+	if pointer == "" || pointer == "/" {
+		return []string{}
+	}
+	parts := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, part := range parts {
+		parts[i] = unescapePathKey(part)
+	}
+	return parts
+}
+
+func redactValue(path []string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	if IsSensitivePath(path) {
+		return RedactedValue
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return redactObject(v, path)
+	case Values:
+		return redactObject(v, path)
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			res[i] = redactValue(appendPath(path, strconv.Itoa(i)), item)
+		}
+		return res
+	}
+	return value
+}
+
+func redactObject(obj map[string]interface{}, path []string) map[string]interface{} {
+	res := make(map[string]interface{}, len(obj))
+	for key, value := range obj {
+		res[key] = redactValue(appendPath(path, key), value)
+	}
+	return res
+}
+
+func appendPath(path []string, key string) []string {
+	return append(append([]string{}, path...), key)
+}
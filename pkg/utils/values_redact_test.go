@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_RedactValues(t *testing.T) {
+	g := NewWithT(t)
+
+	ReplaceSensitivePaths(t, "global.registry.dockercfg", "*.auth", "moduleOne.hosts.*.token")
+	defer ReplaceSensitivePaths(t)
+
+	values := Values{
+		"global": map[string]interface{}{
+			"registry": map[string]interface{}{
+				"address":   "registry.example.com",
+				"dockercfg": "c2VjcmV0",
+			},
+		},
+		"moduleOne": map[string]interface{}{
+			"auth": map[string]interface{}{
+				"password": "qwerty",
+			},
+			"hosts": []interface{}{
+				map[string]interface{}{"name": "a", "token": "t1"},
+			},
+		},
+	}
+
+	g.Expect(RedactValues(values)).Should(Equal(Values{
+		"global": map[string]interface{}{
+			"registry": map[string]interface{}{
+				"address":   "registry.example.com",
+				"dockercfg": RedactedValue,
+			},
+		},
+		"moduleOne": map[string]interface{}{
+			"auth": RedactedValue,
+			"hosts": []interface{}{
+				map[string]interface{}{"name": "a", "token": RedactedValue},
+			},
+		},
+	}))
+
+	// Original values are not changed.
+	g.Expect(values["global"].(map[string]interface{})["registry"].(map[string]interface{})["dockercfg"]).Should(Equal("c2VjcmV0"))
+
+	g.Expect(values.DebugString()).ShouldNot(ContainSubstring("qwerty"))
+	g.Expect(strings.Contains(values.DebugString(), RedactedValue)).Should(BeTrue())
+}
+
+// Each owner replaces only its own patterns.
+func Test_ReplaceSensitivePaths(t *testing.T) {
+	g := NewWithT(t)
+
+	one, two := new(int), new(int)
+	ReplaceSensitivePaths(one, "moduleOne.password")
+	defer ReplaceSensitivePaths(one)
+	ReplaceSensitivePaths(two, "moduleTwo.password")
+	defer ReplaceSensitivePaths(two)
+
+	ReplaceSensitivePaths(one, "moduleOne.token")
+	g.Expect(IsSensitivePath([]string{"moduleOne", "password"})).Should(BeFalse())
+	g.Expect(IsSensitivePath([]string{"moduleOne", "token"})).Should(BeTrue())
+	g.Expect(IsSensitivePath([]string{"moduleTwo", "password"})).Should(BeTrue())
+
+	ReplaceSensitivePaths(two)
+	g.Expect(IsSensitivePath([]string{"moduleTwo", "password"})).Should(BeFalse())
+	g.Expect(IsSensitivePath([]string{"moduleOne", "token"})).Should(BeTrue())
+}
+
+func Test_RedactValuesPatches(t *testing.T) {
+	g := NewWithT(t)
+
+	ReplaceSensitivePaths(t, "moduleOne.auth.password")
+	defer ReplaceSensitivePaths(t)
+
+	patches := []ValuesPatch{
+		*MustValuesPatch(ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/moduleOne/auth", "value": {"user": "admin", "password": "qwerty"}},
+{"op": "add", "path": "/moduleOne/auth/password", "value": "qwerty"},
+{"op": "add", "path": "/moduleOne/replicas", "value": 2}
+]`))),
+	}
+
+	redacted := RedactValuesPatches(patches)
+	g.Expect(redacted[0].Operations[0].Value).Should(Equal(map[string]interface{}{"user": "admin", "password": RedactedValue}))
+	g.Expect(redacted[0].Operations[1].Value).Should(Equal(RedactedValue))
+	g.Expect(redacted[0].Operations[2].Value).Should(Equal(2.0))
+
+	// Original patches are not changed.
+	g.Expect(patches[0].Operations[1].Value).Should(Equal("qwerty"))
+
+	// Errors for rejected operations do not contain sensitive values.
+	err := ValidateHookValuesPatch(patches[0], "moduleTwo")
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(err.Error()).ShouldNot(ContainSubstring("qwerty"))
+}
+
+func Test_RedactValues_NoPatterns(t *testing.T) {
+	g := NewWithT(t)
+
+	values := Values{"a": "b"}
+	g.Expect(RedactValues(values)).Should(Equal(values))
+}
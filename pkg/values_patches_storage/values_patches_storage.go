@@ -0,0 +1,200 @@
+package values_patches_storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/flant/shell-operator/pkg/kube"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// Kinds of objects to store dynamic values patches.
+const (
+	NoStorage        = "none"
+	ConfigMapStorage = "ConfigMap"
+	SecretStorage    = "Secret"
+)
+
+const (
+	// SectionLabel marks objects with patches. The value is a section of values: 'global' or a module name.
+	SectionLabel = "addon-operator/values-patches-section"
+	// PatchesKey is a key in object's data with JSON patch operations.
+	PatchesKey = "patches.json"
+)
+
+// ValuesPatchesStorage saves dynamic values patches to persist them across restarts.
+// There is one object per section: the global section or a module.
+type ValuesPatchesStorage interface {
+	WithKubeClient(client kube.KubernetesClient)
+	WithNamespace(namespace string)
+	WithNamePrefix(prefix string)
+	Save(section string, patches []utils.ValuesPatch) error
+	LoadAll() (map[string][]utils.ValuesPatch, error)
+}
+
+type kubeValuesPatchesStorage struct {
+	KubeClient kube.KubernetesClient
+	Namespace  string
+	NamePrefix string
+	Kind       string
+}
+
+// kubeValuesPatchesStorage should implement ValuesPatchesStorage
+var _ ValuesPatchesStorage = &kubeValuesPatchesStorage{}
+
+// NewValuesPatchesStorage returns a storage that uses ConfigMaps or Secrets.
+func NewValuesPatchesStorage(kind string) (ValuesPatchesStorage, error) {
+	if kind != ConfigMapStorage && kind != SecretStorage {
+		return nil, fmt.Errorf("unknown values patches storage '%s'", kind)
+	}
+	return &kubeValuesPatchesStorage{Kind: kind}, nil
+}
+
+func (s *kubeValuesPatchesStorage) WithKubeClient(client kube.KubernetesClient) {
+	s.KubeClient = client
+}
+
+func (s *kubeValuesPatchesStorage) WithNamespace(namespace string) {
+	s.Namespace = namespace
+}
+
+func (s *kubeValuesPatchesStorage) WithNamePrefix(prefix string) {
+	s.NamePrefix = prefix
+}
+
+// ObjectName returns a name of the object for the section.
+func (s *kubeValuesPatchesStorage) ObjectName(section string) string {
+	return fmt.Sprintf("%s-values-patches-%s", s.NamePrefix, section)
+}
+
+// Save replaces saved operations for the section with operations from patches.
+func (s *kubeValuesPatchesStorage) Save(section string, patches []utils.ValuesPatch) error {
+	operations := make([]*utils.ValuesPatchOperation, 0)
+	for _, patch := range patches {
+		operations = append(operations, patch.Operations...)
+	}
+
+	data, err := json.Marshal(operations)
+	if err != nil {
+		return fmt.Errorf("marshal values patches for '%s': %s", section, err)
+	}
+
+	name := s.ObjectName(section)
+	switch s.Kind {
+	case SecretStorage:
+		err = s.saveSecret(name, section, data)
+	default:
+		err = s.saveConfigMap(name, section, data)
+	}
+	if err != nil {
+		return fmt.Errorf("save values patches for '%s' to %s/%s: %s", section, s.Kind, name, err)
+	}
+
+	log.Debugf("Values patches for '%s' are saved to %s/%s", section, s.Kind, name)
+	return nil
+}
+
+// LoadAll returns saved patches by section. Operations for each section are compacted into one patch.
+// Objects of other instances in the same namespace are ignored: they have names with other prefixes.
+func (s *kubeValuesPatchesStorage) LoadAll() (map[string][]utils.ValuesPatch, error) {
+	listOptions := metav1.ListOptions{LabelSelector: SectionLabel}
+
+	dataBySection := make(map[string][]byte)
+	switch s.Kind {
+	case SecretStorage:
+		list, err := s.KubeClient.CoreV1().Secrets(s.Namespace).List(listOptions)
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %s", s.Kind, err)
+		}
+		for _, obj := range list.Items {
+			if s.isOwnObject(obj.Name, obj.Labels) {
+				dataBySection[obj.Labels[SectionLabel]] = obj.Data[PatchesKey]
+			}
+		}
+	default:
+		list, err := s.KubeClient.CoreV1().ConfigMaps(s.Namespace).List(listOptions)
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %s", s.Kind, err)
+		}
+		for _, obj := range list.Items {
+			if s.isOwnObject(obj.Name, obj.Labels) {
+				dataBySection[obj.Labels[SectionLabel]] = []byte(obj.Data[PatchesKey])
+			}
+		}
+	}
+
+	res := make(map[string][]utils.ValuesPatch)
+	for section, data := range dataBySection {
+		if section == "" || len(data) == 0 {
+			continue
+		}
+		patch, err := utils.ValuesPatchFromBytes(data)
+		if err != nil {
+			return nil, fmt.Errorf("load values patches for '%s' from %s/%s: %s", section, s.Kind, s.ObjectName(section), err)
+		}
+		if len(patch.Operations) == 0 {
+			continue
+		}
+		res[section] = utils.CompactValuesPatches(nil, *patch)
+	}
+
+	return res, nil
+}
+
+// isOwnObject returns true if the object is saved by this instance for the section from the label.
+func (s *kubeValuesPatchesStorage) isOwnObject(name string, labels map[string]string) bool {
+	section := labels[SectionLabel]
+	return section != "" && name == s.ObjectName(section)
+}
+
+func (s *kubeValuesPatchesStorage) saveConfigMap(name string, section string, data []byte) error {
+	obj, err := s.KubeClient.CoreV1().ConfigMaps(s.Namespace).Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		obj = &v1.ConfigMap{}
+		obj.Name = name
+		obj.Labels = map[string]string{SectionLabel: section}
+		obj.Data = map[string]string{PatchesKey: string(data)}
+		_, err = s.KubeClient.CoreV1().ConfigMaps(s.Namespace).Create(obj)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if obj.Labels == nil {
+		obj.Labels = make(map[string]string)
+	}
+	obj.Labels[SectionLabel] = section
+	obj.Data = map[string]string{PatchesKey: string(data)}
+	_, err = s.KubeClient.CoreV1().ConfigMaps(s.Namespace).Update(obj)
+	return err
+}
+
+func (s *kubeValuesPatchesStorage) saveSecret(name string, section string, data []byte) error {
+	obj, err := s.KubeClient.CoreV1().Secrets(s.Namespace).Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		obj = &v1.Secret{}
+		obj.Name = name
+		obj.Labels = map[string]string{SectionLabel: section}
+		obj.Data = map[string][]byte{PatchesKey: data}
+		_, err = s.KubeClient.CoreV1().Secrets(s.Namespace).Create(obj)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if obj.Labels == nil {
+		obj.Labels = make(map[string]string)
+	}
+	obj.Labels[SectionLabel] = section
+	obj.Data = map[string][]byte{PatchesKey: data}
+	_, err = s.KubeClient.CoreV1().Secrets(s.Namespace).Update(obj)
+	return err
+}
@@ -0,0 +1,82 @@
+package values_patches_storage
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/shell-operator/pkg/kube"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func Test_ValuesPatchesStorage_SaveAndLoad(t *testing.T) {
+	for _, kind := range []string{ConfigMapStorage, SecretStorage} {
+		t.Run(kind, func(t *testing.T) {
+			g := NewWithT(t)
+
+			kubeClient := kube.NewFakeKubernetesClient()
+			storage, err := NewValuesPatchesStorage(kind)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			storage.WithKubeClient(kubeClient)
+			storage.WithNamespace("default")
+			storage.WithNamePrefix("addon-operator")
+
+			// Another instance in the same namespace.
+			otherStorage, err := NewValuesPatchesStorage(kind)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			otherStorage.WithKubeClient(kubeClient)
+			otherStorage.WithNamespace("default")
+			otherStorage.WithNamePrefix("other-operator")
+
+			modulePatch := *utils.MustValuesPatch(utils.ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/moduleOne/a", "value": "x"},
+{"op": "add", "path": "/moduleOne/b", "value": 1}
+]`)))
+			globalPatch := *utils.MustValuesPatch(utils.ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/global/discovery", "value": {"ready": true}}
+]`)))
+
+			g.Expect(storage.Save("module-one", []utils.ValuesPatch{modulePatch})).Should(Succeed())
+			g.Expect(storage.Save(utils.GlobalValuesKey, []utils.ValuesPatch{globalPatch})).Should(Succeed())
+
+			// Save again to update the object.
+			modulePatch = *utils.MustValuesPatch(utils.ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/moduleOne/a", "value": "y"}
+]`)))
+			g.Expect(storage.Save("module-one", []utils.ValuesPatch{modulePatch})).Should(Succeed())
+
+			otherPatch := *utils.MustValuesPatch(utils.ValuesPatchFromBytes([]byte(`[
+{"op": "add", "path": "/moduleOne/a", "value": "other"}
+]`)))
+			g.Expect(otherStorage.Save("module-one", []utils.ValuesPatch{otherPatch})).Should(Succeed())
+			g.Expect(otherStorage.Save("module-two", []utils.ValuesPatch{otherPatch})).Should(Succeed())
+
+			saved, err := storage.LoadAll()
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(saved).Should(HaveLen(2))
+
+			values, _, err := utils.ApplyValuesPatch(utils.Values{"moduleOne": map[string]interface{}{}}, saved["module-one"][0])
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(values).Should(Equal(utils.Values{"moduleOne": map[string]interface{}{"a": "y"}}))
+
+			values, _, err = utils.ApplyValuesPatch(utils.Values{"global": map[string]interface{}{}}, saved[utils.GlobalValuesKey][0])
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(values).Should(Equal(utils.Values{"global": map[string]interface{}{
+				"discovery": map[string]interface{}{"ready": true},
+			}}))
+
+			otherSaved, err := otherStorage.LoadAll()
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(otherSaved).Should(HaveLen(2))
+			g.Expect(otherSaved).Should(HaveKey("module-two"))
+		})
+	}
+}
+
+func Test_ValuesPatchesStorage_UnknownKind(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := NewValuesPatchesStorage("Deployment")
+	g.Expect(err).Should(HaveOccurred())
+}
@@ -0,0 +1,82 @@
+package values_validation
+
+import (
+	"github.com/go-openapi/spec"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// GlobalDefaultValues returns values with 'global' section filled with defaults from schemas.
+// Defaults from values schema override defaults from config-values schema.
+func (v *ValuesValidator) GlobalDefaultValues() utils.Values {
+	return defaultValuesForSection(utils.GlobalValuesKey, v.GlobalSchemas)
+}
+
+// ModuleDefaultValues returns values with module section filled with defaults from schemas.
+// Defaults from values schema override defaults from config-values schema.
+func (v *ValuesValidator) ModuleDefaultValues(moduleName string) utils.Values {
+	return defaultValuesForSection(utils.ModuleNameToValuesKey(moduleName), v.ModuleSchemas[moduleName])
+}
+
+func defaultValuesForSection(key string, schemas map[SchemaType]*spec.Schema) utils.Values {
+	res := utils.Values{}
+	if len(schemas) == 0 {
+		return res
+	}
+
+	defaults := utils.MergeValues(
+		DefaultsFromSchema(schemas[ConfigValuesSchema]),
+		DefaultsFromSchema(schemas[ValuesSchema]),
+	)
+	if len(defaults) == 0 {
+		return res
+	}
+
+	res[key] = map[string]interface{}(defaults)
+	return res
+}
+
+// DefaultsFromSchema returns a tree of 'default' fields of object properties.
+// Objects without defaults in nested properties are omitted.
+// Defaults for array items are not supported: there is no place to materialize them.
+func DefaultsFromSchema(s *spec.Schema) utils.Values {
+	res := utils.Values{}
+	if s == nil {
+		return res
+	}
+
+	for name, prop := range s.Properties {
+		prop := prop
+		if prop.Default != nil {
+			res[name] = deepCopy(prop.Default)
+			continue
+		}
+		nested := DefaultsFromSchema(&prop)
+		if len(nested) > 0 {
+			res[name] = map[string]interface{}(nested)
+		}
+	}
+
+	return res
+}
+
+// deepCopy copies maps and arrays from the schema to not modify defaults in schema by
+// consequent merges and patches.
+func deepCopy(in interface{}) interface{} {
+	switch v := in.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			res[k] = deepCopy(item)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			res[i] = deepCopy(item)
+		}
+		return res
+	default:
+		return v
+	}
+}
@@ -0,0 +1,72 @@
+package values_validation
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func Test_DefaultValues(t *testing.T) {
+	g := NewWithT(t)
+
+	configSchema := `
+type: object
+properties:
+  replicas:
+    type: integer
+    default: 1
+  image:
+    type: object
+    properties:
+      repository:
+        type: string
+        default: nginx
+      tag:
+        type: string
+  tolerations:
+    type: array
+    default: []
+    items:
+      type: object
+      properties:
+        key:
+          type: string
+          default: node-role
+`
+	valuesSchema := `
+type: object
+properties:
+  replicas:
+    type: integer
+    default: 3
+  internal:
+    type: object
+    properties:
+      ready:
+        type: boolean
+        default: false
+`
+
+	v := NewValuesValidator()
+	err := v.AddModuleValuesSchemas("module-one", []byte(configSchema), []byte(valuesSchema))
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	g.Expect(v.ModuleDefaultValues("module-one")).Should(Equal(utils.Values{
+		"moduleOne": map[string]interface{}{
+			"replicas": 3.0,
+			"image": map[string]interface{}{
+				"repository": "nginx",
+			},
+			"tolerations": []interface{}{},
+			"internal": map[string]interface{}{
+				"ready": false,
+			},
+		},
+	}))
+
+	// No schemas — no defaults.
+	g.Expect(v.ModuleDefaultValues("module-two")).Should(HaveLen(0))
+	g.Expect(v.GlobalDefaultValues()).Should(HaveLen(0))
+}
@@ -0,0 +1,65 @@
+package values_validation
+
+import (
+	"strings"
+
+	"github.com/go-openapi/spec"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+const (
+	// MergeStrategyExtension sets a strategy to merge an array property with arrays from other layers of values.
+	MergeStrategyExtension = "x-merge-strategy"
+	// MergeKeyExtension sets a field of array items for 'merge' strategy.
+	MergeKeyExtension = "x-merge-key"
+)
+
+// GlobalMergeStrategies returns array merge strategies from schemas for the global section.
+func (v *ValuesValidator) GlobalMergeStrategies() utils.MergeStrategies {
+	return sectionMergeStrategies(utils.GlobalValuesKey, v.GlobalSchemas)
+}
+
+// ModuleMergeStrategies returns array merge strategies from schemas for the module section.
+func (v *ValuesValidator) ModuleMergeStrategies(moduleName string) utils.MergeStrategies {
+	return sectionMergeStrategies(utils.ModuleNameToValuesKey(moduleName), v.ModuleSchemas[moduleName])
+}
+
+// sectionMergeStrategies returns strategies with paths prefixed with the section key.
+// Strategies from values schema override strategies from config-values schema.
+func sectionMergeStrategies(key string, schemas map[SchemaType]*spec.Schema) utils.MergeStrategies {
+	res := utils.MergeStrategies{}
+	for _, schemaType := range []SchemaType{ConfigValuesSchema, ValuesSchema} {
+		for path, strategy := range MergeStrategiesFromSchema(schemas[schemaType]) {
+			res[key+"."+path] = strategy
+		}
+	}
+	return res
+}
+
+// MergeStrategiesFromSchema returns strategies for array properties with 'x-merge-strategy' field.
+// Paths are relative to the section, '*' is used for array items.
+func MergeStrategiesFromSchema(s *spec.Schema) utils.MergeStrategies {
+	res := utils.MergeStrategies{}
+	mergeStrategies(s, nil, res)
+	return res
+}
+
+func mergeStrategies(s *spec.Schema, prefix []string, res utils.MergeStrategies) {
+	if s == nil {
+		return
+	}
+
+	for name, prop := range s.Properties {
+		prop := prop
+		path := append(append([]string{}, prefix...), name)
+		if strategy, ok := prop.Extensions.GetString(MergeStrategyExtension); ok {
+			key, _ := prop.Extensions.GetString(MergeKeyExtension)
+			res[strings.Join(path, ".")] = utils.ArrayMergeStrategy{Strategy: strategy, Key: key}
+		}
+		mergeStrategies(&prop, path, res)
+		if prop.Items != nil && prop.Items.Schema != nil {
+			mergeStrategies(prop.Items.Schema, append(path, "*"), res)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package values_validation
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func Test_MergeStrategies(t *testing.T) {
+	g := NewWithT(t)
+
+	configSchema := `
+type: object
+properties:
+  tolerations:
+    type: array
+    x-merge-strategy: append
+    items:
+      type: object
+`
+	valuesSchema := `
+type: object
+properties:
+  tolerations:
+    type: array
+    x-merge-strategy: replace
+  containers:
+    type: array
+    x-merge-strategy: merge
+    x-merge-key: name
+    items:
+      type: object
+      properties:
+        args:
+          type: array
+          x-merge-strategy: append
+`
+	v := NewValuesValidator()
+	err := v.AddModuleValuesSchemas("module-one", []byte(configSchema), []byte(valuesSchema))
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	g.Expect(v.ModuleMergeStrategies("module-one")).Should(Equal(utils.MergeStrategies{
+		"moduleOne.tolerations":       {Strategy: utils.ReplaceArrays},
+		"moduleOne.containers":        {Strategy: utils.MergeArraysByKey, Key: "name"},
+		"moduleOne.containers.*.args": {Strategy: utils.AppendArrays},
+	}))
+	g.Expect(v.GlobalMergeStrategies()).Should(BeEmpty())
+
+	// Unknown strategy.
+	err = v.AddGlobalValuesSchemas(nil, []byte(`
+type: object
+properties:
+  hosts:
+    type: array
+    x-merge-strategy: prepend
+`))
+	g.Expect(err).Should(HaveOccurred())
+}
@@ -0,0 +1,146 @@
+package values_validation
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/spec"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// SensitiveExtension marks properties with credentials and other sensitive values.
+const SensitiveExtension = "x-sensitive"
+
+// GlobalSensitivePaths returns paths of sensitive properties in the config-values schema for the global section.
+func (v *ValuesValidator) GlobalSensitivePaths() [][]string {
+	return SensitivePathsFromSchema(v.GetGlobalValuesSchema(ConfigValuesSchema))
+}
+
+// ModuleSensitivePaths returns paths of sensitive properties in the config-values schema for the module.
+func (v *ValuesValidator) ModuleSensitivePaths(moduleName string) [][]string {
+	return SensitivePathsFromSchema(v.GetModuleValuesSchema(moduleName, ConfigValuesSchema))
+}
+
+// SensitivePathPatterns returns dot-separated paths of sensitive properties from all schemas
+// prefixed with the section key. They are used to redact values in logs and in debug output.
+func (v *ValuesValidator) SensitivePathPatterns() []string {
+	res := make([]string, 0)
+	res = append(res, sectionSensitivePatterns(utils.GlobalValuesKey, v.GlobalSchemas)...)
+	for moduleName, schemas := range v.ModuleSchemas {
+		res = append(res, sectionSensitivePatterns(utils.ModuleNameToValuesKey(moduleName), schemas)...)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func sectionSensitivePatterns(key string, schemas map[SchemaType]*spec.Schema) []string {
+	res := make([]string, 0)
+	for _, schemaType := range []SchemaType{ConfigValuesSchema, ValuesSchema} {
+		for _, path := range SensitivePathsFromSchema(schemas[schemaType]) {
+			res = append(res, strings.Join(append([]string{key}, path...), "."))
+		}
+	}
+	return res
+}
+
+// SensitivePathsFromSchema returns paths of object properties marked with 'x-sensitive: true'.
+// Paths are relative to the section. Nested properties of a sensitive property are not returned.
+func SensitivePathsFromSchema(s *spec.Schema) [][]string {
+	res := sensitivePaths(s, nil)
+	sort.Slice(res, func(i, j int) bool {
+		return strings.Join(res[i], ".") < strings.Join(res[j], ".")
+	})
+	return res
+}
+
+func sensitivePaths(s *spec.Schema, prefix []string) [][]string {
+	res := make([][]string, 0)
+	if s == nil {
+		return res
+	}
+
+	for name, prop := range s.Properties {
+		prop := prop
+		path := append(append([]string{}, prefix...), name)
+		if isSensitive, ok := prop.Extensions.GetBool(SensitiveExtension); ok && isSensitive {
+			res = append(res, path)
+			continue
+		}
+		res = append(res, sensitivePaths(&prop, path)...)
+	}
+
+	return res
+}
+
+// redactError replaces sensitive string values of the section in the error message with utils.RedactedValue.
+// Errors for wrong formats contain values. Values are sensitive if they are marked in schemas
+// of the section or match registered patterns, see utils.IsSensitivePath.
+func redactError(err error, key string, obj interface{}, schemas map[SchemaType]*spec.Schema) error {
+	paths := make([][]string, 0)
+	for _, schemaType := range []SchemaType{ConfigValuesSchema, ValuesSchema} {
+		for _, path := range SensitivePathsFromSchema(schemas[schemaType]) {
+			paths = append(paths, append([]string{key}, path...))
+		}
+	}
+
+	secrets := make([]string, 0)
+	collectSensitiveStrings(obj, []string{key}, paths, false, &secrets)
+	if len(secrets) == 0 {
+		return err
+	}
+	// Longer values first, so a value is not partially replaced as a part of another value.
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+
+	msg := err.Error()
+	for _, secret := range secrets {
+		msg = strings.Replace(msg, secret, utils.RedactedValue, -1)
+	}
+	return errors.New(msg)
+}
+
+func collectSensitiveStrings(value interface{}, path []string, paths [][]string, isSensitive bool, res *[]string) {
+	if !isSensitive {
+		isSensitive = utils.IsSensitivePath(path) || hasPathPrefix(path, paths)
+	}
+
+	switch v := value.(type) {
+	case string:
+		if isSensitive && v != "" {
+			*res = append(*res, v)
+		}
+	case map[string]interface{}:
+		for k, item := range v {
+			collectSensitiveStrings(item, append(append([]string{}, path...), k), paths, isSensitive, res)
+		}
+	case utils.Values:
+		collectSensitiveStrings(map[string]interface{}(v), path, paths, isSensitive, res)
+	case []interface{}:
+		for i, item := range v {
+			collectSensitiveStrings(item, append(append([]string{}, path...), strconv.Itoa(i)), paths, isSensitive, res)
+		}
+	}
+}
+
+func hasPathPrefix(path []string, prefixes [][]string) bool {
+	for _, prefix := range prefixes {
+		if len(path) < len(prefix) {
+			continue
+		}
+		matched := true
+		for i := range prefix {
+			if prefix[i] != path[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package values_validation
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func Test_SensitivePaths(t *testing.T) {
+	g := NewWithT(t)
+
+	configSchema := `
+type: object
+properties:
+  replicas:
+    type: integer
+  password:
+    type: string
+    x-sensitive: true
+  db:
+    type: object
+    properties:
+      host:
+        type: string
+      credentials:
+        type: object
+        x-sensitive: true
+        properties:
+          user:
+            type: string
+`
+	v := NewValuesValidator()
+	err := v.AddModuleValuesSchemas("module-one", []byte(configSchema), nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	g.Expect(v.ModuleSensitivePaths("module-one")).Should(Equal([][]string{
+		{"db", "credentials"},
+		{"password"},
+	}))
+	g.Expect(v.GlobalSensitivePaths()).Should(BeEmpty())
+	g.Expect(v.ModuleSensitivePaths("unknown")).Should(BeEmpty())
+}
+
+func Test_SensitivePathPatterns(t *testing.T) {
+	g := NewWithT(t)
+
+	v := NewValuesValidator()
+	err := v.AddGlobalValuesSchemas([]byte(`
+type: object
+properties:
+  registry:
+    type: object
+    properties:
+      dockercfg:
+        type: string
+        x-sensitive: true
+`), nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	err = v.AddModuleValuesSchemas("module-one", nil, []byte(`
+type: object
+properties:
+  internal:
+    type: object
+    properties:
+      token:
+        type: string
+        x-sensitive: true
+`))
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	g.Expect(v.SensitivePathPatterns()).Should(Equal([]string{
+		"global.registry.dockercfg",
+		"moduleOne.internal.token",
+	}))
+}
+
+// Validation errors can contain values, sensitive values are redacted.
+func Test_ValidateModuleConfigValues_RedactsSensitiveValues(t *testing.T) {
+	g := NewWithT(t)
+
+	configSchema := `
+type: object
+properties:
+  email:
+    type: string
+    format: email
+  password:
+    type: string
+    format: email
+    x-sensitive: true
+  db:
+    type: object
+    x-sensitive: true
+    properties:
+      url:
+        type: string
+        format: uri
+`
+	v := NewValuesValidator()
+	err := v.AddModuleValuesSchemas("module-one", []byte(configSchema), nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	err = v.ValidateModuleConfigValues("module-one", utils.Values{
+		"moduleOne": map[string]interface{}{
+			"email":    "not-an-email",
+			"password": "qwerty-secret",
+			"db": map[string]interface{}{
+				"url": "::db-secret",
+			},
+		},
+	})
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(err.Error()).Should(ContainSubstring("not-an-email"))
+	g.Expect(err.Error()).Should(ContainSubstring("moduleOne.password"))
+	g.Expect(err.Error()).Should(ContainSubstring(utils.RedactedValue))
+	g.Expect(err.Error()).ShouldNot(ContainSubstring("qwerty-secret"))
+	g.Expect(err.Error()).ShouldNot(ContainSubstring("db-secret"))
+}
@@ -0,0 +1,203 @@
+package values_validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-openapi/spec"
+	"sigs.k8s.io/yaml"
+
+	"github.com/flant/shell-operator/pkg/hook/config"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// SchemaType is a type of values that schema describes.
+type SchemaType string
+
+const (
+	// ConfigValuesSchema describes values that can be set in the ConfigMap (openapi/config-values.yaml).
+	ConfigValuesSchema SchemaType = "config"
+	// ValuesSchema describes effective values that hooks and helm receive (openapi/values.yaml).
+	ValuesSchema SchemaType = "values"
+)
+
+// Schema files are located in the 'openapi' directory of the module
+// or in the 'openapi' directory of the global hooks directory.
+const (
+	SchemasDir             = "openapi"
+	ConfigValuesSchemaFile = "config-values.yaml"
+	ValuesSchemaFile       = "values.yaml"
+)
+
+// ValuesValidator stores OpenAPI schemas for global values and for modules
+// and validates values against them.
+type ValuesValidator struct {
+	GlobalSchemas map[SchemaType]*spec.Schema
+	ModuleSchemas map[string]map[SchemaType]*spec.Schema
+}
+
+func NewValuesValidator() *ValuesValidator {
+	return &ValuesValidator{
+		GlobalSchemas: make(map[SchemaType]*spec.Schema),
+		ModuleSchemas: make(map[string]map[SchemaType]*spec.Schema),
+	}
+}
+
+// AddGlobalValuesSchemas loads schemas for the global section. Empty input means no schema.
+func (v *ValuesValidator) AddGlobalValuesSchemas(configBytes, valuesBytes []byte) error {
+	schemas, err := loadSchemas(configBytes, valuesBytes)
+	if err != nil {
+		return fmt.Errorf("load global schemas: %s", err)
+	}
+	v.GlobalSchemas = schemas
+	return nil
+}
+
+// AddModuleValuesSchemas loads schemas for the module section. Empty input means no schema.
+func (v *ValuesValidator) AddModuleValuesSchemas(moduleName string, configBytes, valuesBytes []byte) error {
+	schemas, err := loadSchemas(configBytes, valuesBytes)
+	if err != nil {
+		return fmt.Errorf("load module '%s' schemas: %s", moduleName, err)
+	}
+	v.ModuleSchemas[moduleName] = schemas
+	return nil
+}
+
+func (v *ValuesValidator) GetGlobalValuesSchema(schemaType SchemaType) *spec.Schema {
+	return v.GlobalSchemas[schemaType]
+}
+
+func (v *ValuesValidator) GetModuleValuesSchema(moduleName string, schemaType SchemaType) *spec.Schema {
+	schemas, ok := v.ModuleSchemas[moduleName]
+	if !ok {
+		return nil
+	}
+	return schemas[schemaType]
+}
+
+// ValidateGlobalConfigValues validates 'global' section of values against the config-values schema.
+func (v *ValuesValidator) ValidateGlobalConfigValues(values utils.Values) error {
+	return validateSection(values, utils.GlobalValuesKey, v.GlobalSchemas, ConfigValuesSchema)
+}
+
+// ValidateGlobalValues validates 'global' section of effective values against the values schema.
+func (v *ValuesValidator) ValidateGlobalValues(values utils.Values) error {
+	return validateSection(values, utils.GlobalValuesKey, v.GlobalSchemas, ValuesSchema)
+}
+
+// ValidateModuleConfigValues validates module section of values against the config-values schema.
+func (v *ValuesValidator) ValidateModuleConfigValues(moduleName string, values utils.Values) error {
+	return validateSection(values, utils.ModuleNameToValuesKey(moduleName), v.ModuleSchemas[moduleName], ConfigValuesSchema)
+}
+
+// ValidateModuleValues validates module section of effective values against the values schema.
+func (v *ValuesValidator) ValidateModuleValues(moduleName string, values utils.Values) error {
+	return validateSection(values, utils.ModuleNameToValuesKey(moduleName), v.ModuleSchemas[moduleName], ValuesSchema)
+}
+
+// validateSection validates a section of values under the key. Absent schema means valid values.
+// Absent section is validated as an empty object to check 'required' fields.
+// Sensitive values are redacted in the error, it is logged and returned by the debug server and the webhook.
+func validateSection(values utils.Values, key string, schemas map[SchemaType]*spec.Schema, schemaType SchemaType) error {
+	s := schemas[schemaType]
+	if s == nil {
+		return nil
+	}
+
+	obj, ok := values[key]
+	if !ok || obj == nil {
+		obj = map[string]interface{}{}
+	}
+
+	err := ValidateObject(obj, s, key)
+	if err != nil {
+		return redactError(err, key, obj, schemas)
+	}
+	return nil
+}
+
+// ValidateObject validates obj against schema. rootName is a prefix for paths in error messages.
+func ValidateObject(obj interface{}, s *spec.Schema, rootName string) error {
+	err := config.ValidateConfig(obj, s, rootName)
+	if err != nil {
+		return fmt.Errorf("'%s' values are not valid: %s", rootName, err)
+	}
+	return nil
+}
+
+func loadSchemas(configBytes, valuesBytes []byte) (map[SchemaType]*spec.Schema, error) {
+	res := make(map[SchemaType]*spec.Schema)
+
+	if len(configBytes) > 0 {
+		s, err := LoadSchema(configBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", ConfigValuesSchemaFile, err)
+		}
+		res[ConfigValuesSchema] = s
+	}
+
+	if len(valuesBytes) > 0 {
+		s, err := LoadSchema(valuesBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", ValuesSchemaFile, err)
+		}
+		res[ValuesSchema] = s
+	}
+
+	return res, nil
+}
+
+// LoadSchema returns spec.Schema object loaded from yaml bytes.
+func LoadSchema(data []byte) (*spec.Schema, error) {
+	d, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("yaml to json: %v", err)
+	}
+
+	s := new(spec.Schema)
+	if err := json.Unmarshal(d, s); err != nil {
+		return nil, fmt.Errorf("json unmarshal: %v", err)
+	}
+
+	err = spec.ExpandSchema(s, s, nil)
+	if err != nil {
+		return nil, fmt.Errorf("expand schema: %v", err)
+	}
+
+	for path, strategy := range MergeStrategiesFromSchema(s) {
+		if err := strategy.Validate(); err != nil {
+			return nil, fmt.Errorf("property '%s': %v", path, err)
+		}
+	}
+
+	return s, nil
+}
+
+// ReadSchemaFiles reads config-values.yaml and values.yaml from the directory.
+// Absent files are not an error, nil is returned for them.
+func ReadSchemaFiles(dir string) (configBytes []byte, valuesBytes []byte, err error) {
+	configBytes, err = readFileIfExists(filepath.Join(dir, ConfigValuesSchemaFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	valuesBytes, err = readFileIfExists(filepath.Join(dir, ValuesSchemaFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	return configBytes, valuesBytes, nil
+}
+
+func readFileIfExists(filePath string) ([]byte, error) {
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("read schema file '%s': %s", filePath, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,133 @@
+package values_validation
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func Test_Validate_ModuleValues(t *testing.T) {
+	g := NewWithT(t)
+
+	configSchema := `
+type: object
+additionalProperties: false
+required:
+- param1
+properties:
+  param1:
+    type: string
+    enum:
+    - val1
+  param2:
+    type: array
+    items:
+      type: integer
+`
+	valuesSchema := `
+type: object
+properties:
+  param1:
+    type: string
+  internal:
+    type: object
+    properties:
+      counter:
+        type: integer
+`
+
+	v := NewValuesValidator()
+	err := v.AddModuleValuesSchemas("module-one", []byte(configSchema), []byte(valuesSchema))
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	var values utils.Values
+
+	values, _ = utils.NewValuesFromBytes([]byte(`
+moduleOne:
+  param1: val1
+  param2: [1, 2]
+`))
+	err = v.ValidateModuleConfigValues("module-one", values)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	values, _ = utils.NewValuesFromBytes([]byte(`
+moduleOne:
+  param1: val2
+  param2: [1, "two"]
+  param3: true
+`))
+	err = v.ValidateModuleConfigValues("module-one", values)
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(err.Error()).Should(ContainSubstring("moduleOne.param1"))
+	g.Expect(err.Error()).Should(ContainSubstring("moduleOne.param2"))
+	g.Expect(err.Error()).Should(ContainSubstring("param3"))
+
+	// Absent section is validated as an empty object.
+	err = v.ValidateModuleConfigValues("module-one", utils.Values{})
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(err.Error()).Should(ContainSubstring("param1"))
+
+	values, _ = utils.NewValuesFromBytes([]byte(`
+moduleOne:
+  param1: val2
+  internal:
+    counter: 1
+`))
+	err = v.ValidateModuleValues("module-one", values)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	values, _ = utils.NewValuesFromBytes([]byte(`
+moduleOne:
+  internal:
+    counter: one
+`))
+	err = v.ValidateModuleValues("module-one", values)
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(err.Error()).Should(ContainSubstring("moduleOne.internal.counter"))
+}
+
+func Test_Validate_NoSchema(t *testing.T) {
+	g := NewWithT(t)
+
+	v := NewValuesValidator()
+
+	values, _ := utils.NewValuesFromBytes([]byte(`
+global:
+  param1: 1
+moduleOne:
+  param1: 1
+`))
+	g.Expect(v.ValidateGlobalConfigValues(values)).ShouldNot(HaveOccurred())
+	g.Expect(v.ValidateGlobalValues(values)).ShouldNot(HaveOccurred())
+	g.Expect(v.ValidateModuleConfigValues("module-one", values)).ShouldNot(HaveOccurred())
+	g.Expect(v.ValidateModuleValues("module-one", values)).ShouldNot(HaveOccurred())
+}
+
+func Test_Validate_GlobalConfigValues(t *testing.T) {
+	g := NewWithT(t)
+
+	v := NewValuesValidator()
+	err := v.AddGlobalValuesSchemas([]byte(`
+type: object
+properties:
+  logLevel:
+    type: string
+    enum: [Debug, Info]
+`), nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(v.GetGlobalValuesSchema(ValuesSchema)).Should(BeNil())
+
+	values, _ := utils.NewValuesFromBytes([]byte(`
+global:
+  logLevel: Trace
+`))
+	err = v.ValidateGlobalConfigValues(values)
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(err.Error()).Should(ContainSubstring("global.logLevel"))
+
+	// Bad schema is an error.
+	err = v.AddGlobalValuesSchemas([]byte(`type: [`), nil)
+	g.Expect(err).Should(HaveOccurred())
+}
@@ -13,17 +13,24 @@ func initRegistry() bool {
 		Registry().Add(h)
 		return true
 	}
+	RegisterEnabledFunc = func(moduleName string, fn EnabledFunc) bool {
+		Registry().AddEnabledFunc(moduleName, fn)
+		return true
+	}
 	return true
 }
 
 type HookRegistry interface {
 	Hooks() []GoHook
 	Add(hook GoHook)
+	EnabledFunc(moduleName string) EnabledFunc
+	AddEnabledFunc(moduleName string, fn EnabledFunc)
 }
 
 type hookRegistry struct {
-	hooks []GoHook
-	m     sync.Mutex
+	hooks        []GoHook
+	enabledFuncs map[string]EnabledFunc
+	m            sync.Mutex
 }
 
 var instance *hookRegistry
@@ -49,3 +56,20 @@ func (h *hookRegistry) Add(hook GoHook) {
 	defer h.m.Unlock()
 	h.hooks = append(h.hooks, hook)
 }
+
+// EnabledFunc returns the enabled function of the module or nil if the function is not registered.
+func (h *hookRegistry) EnabledFunc(moduleName string) EnabledFunc {
+	h.m.Lock()
+	defer h.m.Unlock()
+	return h.enabledFuncs[moduleName]
+}
+
+// AddEnabledFunc registers the enabled function of the module. The last function wins.
+func (h *hookRegistry) AddEnabledFunc(moduleName string, fn EnabledFunc) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	if h.enabledFuncs == nil {
+		h.enabledFuncs = make(map[string]EnabledFunc)
+	}
+	h.enabledFuncs[moduleName] = fn
+}
@@ -149,6 +149,26 @@ type GoHook interface {
 //   var _ =
 var Register = func(_ GoHook) bool { return false }
 
+// EnabledInput is an input for the enabled function of the module. It contains
+// the same values as files for the enabled script.
+type EnabledInput struct {
+	// Values of the module with a list of preceding enabled modules in global.enabledModules.
+	Values       utils.Values
+	ConfigValues utils.Values
+	// EnabledModules is a list of preceding enabled modules.
+	EnabledModules []string
+	LogLabels      map[string]string
+	LogEntry       *log.Entry
+}
+
+// EnabledFunc returns the status of the module like the enabled script.
+type EnabledFunc func(input *EnabledInput) (bool, error)
+
+// RegisterEnabledFunc is a method to define a go enabled function for the module.
+// return value is for trick with
+//   var _ =
+var RegisterEnabledFunc = func(_ string, _ EnabledFunc) bool { return false }
+
 type HookLoader interface {
 	Load()
 }